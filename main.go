@@ -18,16 +18,24 @@ package main
 // For more information, see https://github.com/benoitpetit/prompt-my-project
 import (
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"runtime"
+	"sort"
+	"strconv"
 	"strings"
+	"text/tabwriter"
 	"time"
 
 	"github.com/benoitpetit/prompt-my-project/pkg/analyzer"
-	"github.com/benoitpetit/prompt-my-project/pkg/binary"
 	"github.com/benoitpetit/prompt-my-project/pkg/config"
 	"github.com/benoitpetit/prompt-my-project/pkg/formatter"
+	"github.com/benoitpetit/prompt-my-project/pkg/secrets"
+	"github.com/benoitpetit/prompt-my-project/pkg/source"
+	"github.com/benoitpetit/prompt-my-project/pkg/strip"
+	"github.com/benoitpetit/prompt-my-project/pkg/task"
+	"github.com/benoitpetit/prompt-my-project/pkg/truncate"
 	"github.com/benoitpetit/prompt-my-project/pkg/utils"
 	"github.com/dustin/go-humanize"
 	"github.com/fatih/color"
@@ -143,29 +151,6 @@ func parseInt64(s string) (int64, error) {
 	return n, err
 }
 
-// Load .gitignore patterns
-func loadGitignorePatterns(rootDir string) ([]string, error) {
-	gitignorePath := filepath.Join(rootDir, ".gitignore")
-	if _, err := os.Stat(gitignorePath); os.IsNotExist(err) {
-		return nil, nil
-	}
-
-	content, err := os.ReadFile(gitignorePath)
-	if err != nil {
-		return nil, err
-	}
-
-	var patterns []string
-	for _, line := range strings.Split(string(content), "\n") {
-		line = strings.TrimSpace(line)
-		if line != "" && !strings.HasPrefix(line, "#") {
-			patterns = append(patterns, line)
-		}
-	}
-
-	return patterns, nil
-}
-
 // Make sure the output directory is in .gitignore
 func ensureGitignoreEntry(projectDir, entry string) error {
 	gitignorePath := filepath.Join(projectDir, ".gitignore")
@@ -220,15 +205,198 @@ func printStatistics(stats analyzer.StatsResult, format string) {
 	fmt.Fprintln(os.Stderr)
 	fmt.Fprintln(os.Stderr, bold("=== Project Analysis Complete ==="))
 	fmt.Fprintf(os.Stderr, "Files processed: %s\n", green(stats.FileCount))
+	if stats.SummarizedCount > 0 {
+		fmt.Fprintf(os.Stderr, "Files summarized: %s\n", green(stats.SummarizedCount))
+	}
 	fmt.Fprintf(os.Stderr, "Total file size: %s\n", green(humanize.Bytes(uint64(stats.TotalSize))))
 	fmt.Fprintf(os.Stderr, "Estimated tokens: %s\n", green(stats.TokenCount))
+	if stats.PromptTokens > 0 {
+		fmt.Fprintf(os.Stderr, "Prompt tokens (with structure): %s\n", green(stats.PromptTokens))
+	}
+	if stats.StrippedTokens > 0 {
+		fmt.Fprintf(os.Stderr, "Tokens saved by --strip: %s (%d files)\n", green(stats.StrippedTokens), len(stats.StrippedFiles))
+		for _, file := range topStrippedFiles(stats.StrippedFiles, 5) {
+			fmt.Fprintf(os.Stderr, "  %s: %s\n", file, green(stats.StrippedFiles[file]))
+		}
+	}
+	if stats.TruncatedFiles > 0 {
+		fmt.Fprintf(os.Stderr, "Files truncated: %s\n", green(stats.TruncatedFiles))
+	}
+	if stats.RedactedFiles > 0 {
+		redacted := 0
+		for _, count := range stats.Redactions {
+			redacted += count
+		}
+		fmt.Fprintf(os.Stderr, "Secrets redacted: %s (%d files)\n", green(redacted), stats.RedactedFiles)
+	}
+	if len(stats.OmittedFiles) > 0 {
+		fmt.Fprintf(os.Stderr, "Files omitted (token budget): %s\n", green(len(stats.OmittedFiles)))
+	}
 	fmt.Fprintf(os.Stderr, "Characters: %s\n", green(stats.CharCount))
 	fmt.Fprintf(os.Stderr, "Processing time: %s\n", green(stats.ProcessTime.Round(time.Millisecond)))
 	fmt.Fprintf(os.Stderr, "Files per second: %s\n", green(fmt.Sprintf("%.1f", stats.FilesPerSec)))
-	fmt.Fprintf(os.Stderr, "Output file: %s\n", green(stats.OutputPath))
+	if len(stats.OutputParts) > 0 {
+		fmt.Fprintf(os.Stderr, "Output parts: %s\n", green(len(stats.OutputParts)))
+		for _, part := range stats.OutputParts {
+			fmt.Fprintf(os.Stderr, "  %s\n", green(part))
+		}
+	} else {
+		fmt.Fprintf(os.Stderr, "Output file: %s\n", green(stats.OutputPath))
+	}
+	if stats.ManifestPath != "" {
+		fmt.Fprintf(os.Stderr, "Manifest: %s\n", green(stats.ManifestPath))
+	}
+	for _, path := range stats.ReplacedFiles {
+		fmt.Fprintf(os.Stderr, "Notice: %s already existed and was replaced\n", path)
+	}
 	fmt.Fprintln(os.Stderr)
 }
 
+// sourceDateEpoch returns the time given by the SOURCE_DATE_EPOCH environment variable
+// (https://reproducible-builds.org/specs/source-date-epoch/), or the Unix epoch and
+// false when it is not set
+func sourceDateEpoch() (time.Time, bool, error) {
+	value := strings.TrimSpace(os.Getenv("SOURCE_DATE_EPOCH"))
+	if value == "" {
+		return time.Unix(0, 0), false, nil
+	}
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("invalid SOURCE_DATE_EPOCH %q: %w", value, err)
+	}
+	return time.Unix(seconds, 0), true, nil
+}
+
+// patternSources labels the patterns added after the n first ones with where they come from
+func patternSources(sources []string, n int, source string) []string {
+	for len(sources) < n {
+		sources = append(sources, source)
+	}
+	return sources
+}
+
+// printDryRun prints what the prompt would contain, without writing it: a table of
+// every candidate file with the rule that decided and the projected tokens, or the
+// explanation of the paths given with --explain
+func printDryRun(pa *analyzer.ProjectAnalyzer, format string, explainPaths []string) error {
+	if strings.HasPrefix(format, "stdout") {
+		format = stdoutSubformat(format, "txt")
+	}
+	stats, err := pa.DryRun(format)
+	if err != nil {
+		return err
+	}
+
+	if len(explainPaths) > 0 {
+		for i, path := range explainPaths {
+			if i > 0 {
+				fmt.Println()
+			}
+			printExplanation(pa, path)
+		}
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "STATUS\tTOKENS\tSIZE\tPATH\tRULE")
+	counts := make(map[string]int)
+	dirs, searched, contentTokens := 0, 0, 0
+	for _, c := range pa.Candidates {
+		tokens, size := "-", "-"
+		if c.Tokens > 0 {
+			tokens = humanize.Comma(int64(c.Tokens))
+		}
+		if c.Dir && c.Searched {
+			searched++
+		} else if c.Dir {
+			dirs++
+		} else {
+			size = humanize.Bytes(uint64(c.Size))
+			counts[c.Status]++
+		}
+		if c.Status == analyzer.StatusIncluded || c.Status == analyzer.StatusSummarized {
+			contentTokens += c.Tokens
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", c.Status, tokens, size, c.Path, pa.Rule(c))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Println()
+	fmt.Printf("Included: %d files (%d summarized)\n",
+		counts[analyzer.StatusIncluded]+counts[analyzer.StatusSummarized], counts[analyzer.StatusSummarized])
+	if counts[analyzer.StatusOmitted] > 0 {
+		fmt.Printf("Omitted (token budget): %d files\n", counts[analyzer.StatusOmitted])
+	}
+	fmt.Printf("Excluded: %d files, %d directories not walked", counts[analyzer.StatusExcluded], dirs)
+	if searched > 0 {
+		fmt.Printf(", %d only searched for the files forced in", searched)
+	}
+	fmt.Println()
+	fmt.Printf("Projected tokens: ~%s in file contents, ~%s in the whole prompt\n",
+		humanize.Comma(int64(contentTokens)), humanize.Comma(int64(stats.PromptTokens)))
+	return nil
+}
+
+// printExplanation prints whether a file would be included and which rule decided.
+// The path is relative to the project directory, or to the working directory when
+// it names a file of the project from there.
+func printExplanation(pa *analyzer.ProjectAnalyzer, path string) {
+	relPath := path
+	if abs, err := filepath.Abs(path); err == nil {
+		if rel, err := filepath.Rel(pa.Dir, abs); err == nil && !strings.HasPrefix(rel, "..") {
+			if _, err := os.Stat(abs); err == nil {
+				relPath = rel
+			}
+		}
+	}
+
+	c := pa.Explain(relPath)
+	if c == nil {
+		fmt.Printf("%s: not found in the project\n", filepath.ToSlash(relPath))
+		return
+	}
+	if c.Dir && c.Searched {
+		fmt.Printf("%s: excluded, directory %s only searched for the files forced in\n", filepath.ToSlash(relPath), c.Path)
+	} else if c.Dir {
+		fmt.Printf("%s: excluded, directory %s not walked\n", filepath.ToSlash(relPath), c.Path)
+	} else {
+		fmt.Printf("%s: %s\n", c.Path, c.Status)
+	}
+	fmt.Printf("  rule:   %s\n", pa.Rule(*c))
+	if c.Binary != nil && c.Reason != analyzer.ReasonBinary {
+		fmt.Printf("  binary: %s\n", c.Binary)
+	}
+	if !c.Dir {
+		fmt.Printf("  size:   %s\n", humanize.Bytes(uint64(c.Size)))
+	}
+	if c.Tokens > 0 {
+		fmt.Printf("  tokens: %s\n", humanize.Comma(int64(c.Tokens)))
+	}
+	if c.Truncated != nil {
+		fmt.Printf("  truncated: %d of %d lines omitted (%s)\n", c.Truncated.OmittedLines, c.Truncated.Lines, c.Truncated.Mode)
+	}
+}
+
+// topStrippedFiles returns the files where --strip saved the most tokens
+func topStrippedFiles(saved map[string]int, n int) []string {
+	files := make([]string, 0, len(saved))
+	for file := range saved {
+		files = append(files, file)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if saved[files[i]] != saved[files[j]] {
+			return saved[files[i]] > saved[files[j]]
+		}
+		return files[i] < files[j]
+	})
+	if len(files) > n {
+		files = files[:n]
+	}
+	return files
+}
+
 func main() {
 	var rootCmd = &cobra.Command{
 		Use:   "pmp",
@@ -256,16 +424,21 @@ For more examples and documentation, visit:
 
 	// PROMPT COMMAND
 	var promptCmd = &cobra.Command{
-		Use:   "prompt [project path]",
+		Use:   "prompt [directory | archive | git URL]",
 		Short: "Generate AI-ready prompts from your codebase",
 		Long: `Generate structured prompts from your project's source code, optimized for AI assistants like ChatGPT, Claude, and Gemini.
 
 This command analyzes your project files, extracts meaningful content, and formats it into
 a comprehensive prompt that provides AI assistants with complete context about your codebase.
 
+The project is read from a directory, a .zip, .tar.gz, .tgz or .tar archive (in place,
+without extracting it, or a directory inside it with archive!/path) or a git URL
+(cloned in memory). Use --ref to read a commit, branch or tag of a git repository
+instead of its working tree.
+
 Key features:
   • Smart filtering: Automatically excludes binary files and respects .gitignore
-  • Multiple formats: Output as TXT, JSON, XML, or directly to stdout
+  • Multiple formats: Output as TXT, JSON, XML, Markdown, or directly to stdout
   • Performance controls: Configurable limits for files, sizes, and parallel workers
   • Technology detection: Automatically identifies languages, frameworks, and tools
 
@@ -274,246 +447,23 @@ Examples:
   pmp prompt . --format stdout:txt               # Output to stdout for piping
   pmp prompt . --include "*.go" --exclude "test" # Focus on Go files, exclude tests
   pmp prompt . --format json --output /tmp       # Save as JSON in custom location
-  pmp prompt . --max-files 100 --workers 4       # Limit files and workers for large projects`,
+  pmp prompt . --max-files 100 --workers 4       # Limit files and workers for large projects
+  pmp prompt release.tar.gz                      # Read an archive in place
+  pmp prompt 'release.tar.gz!/src'               # Read a directory of an archive
+  pmp prompt https://github.com/user/repo        # Read a remote repository`,
 		Args: cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			// Path
-			dir := args[0]
-			if !filepath.IsAbs(dir) {
-				absDir, err := filepath.Abs(dir)
-				if err == nil {
-					dir = absDir
-				}
-			}
-
-			// Load configuration from .pmprc, environment variables, and command-line flags
-			cfg, err := config.LoadConfig(dir)
-			if err != nil {
-				fmt.Printf("Warning: error loading .pmprc: %v\n", err)
-				cfg = config.DefaultConfig()
-			}
-
-			// Merge with environment variables
-			envCfg := config.GetEnvironmentConfig()
-			if len(envCfg.Exclude) > 0 {
-				cfg.Exclude = envCfg.Exclude
-			}
-			if len(envCfg.Include) > 0 {
-				cfg.Include = envCfg.Include
-			}
-			if envCfg.MinSize != "" {
-				cfg.MinSize = envCfg.MinSize
-			}
-			if envCfg.MaxSize != "" {
-				cfg.MaxSize = envCfg.MaxSize
-			}
-			if envCfg.MaxFiles > 0 {
-				cfg.MaxFiles = envCfg.MaxFiles
-			}
-			if envCfg.MaxTotalSize != "" {
-				cfg.MaxTotalSize = envCfg.MaxTotalSize
-			}
-			if envCfg.Format != "" {
-				cfg.Format = envCfg.Format
-			}
-			if envCfg.OutputDir != "" {
-				cfg.OutputDir = envCfg.OutputDir
-			}
-			if envCfg.Workers > 0 {
-				cfg.Workers = envCfg.Workers
-			}
-			if envCfg.NoGitignore {
-				cfg.NoGitignore = envCfg.NoGitignore
-			}
-
-			// Get command-line flags
-			excludePatterns, _ := cmd.Flags().GetStringSlice("exclude")
-			includePatterns, _ := cmd.Flags().GetStringSlice("include")
-			minSizeStr, _ := cmd.Flags().GetString("min-size")
-			maxSizeStr, _ := cmd.Flags().GetString("max-size")
-			noGitignore, _ := cmd.Flags().GetBool("no-gitignore")
-			outputDir, _ := cmd.Flags().GetString("output")
-			workers, _ := cmd.Flags().GetInt("workers")
-			maxFiles, _ := cmd.Flags().GetInt("max-files")
-			maxTotalSizeStr, _ := cmd.Flags().GetString("max-total-size")
-			format, _ := cmd.Flags().GetString("format")
-			// Smart Context flags
-			summaryOnly, _ := cmd.Flags().GetBool("summary-only")
-			focusChanges, _ := cmd.Flags().GetBool("focus-changes")
-			recentCommits, _ := cmd.Flags().GetInt("recent-commits")
-			summaryPatterns, _ := cmd.Flags().GetStringSlice("summary-patterns")
-
-			// Merge command-line flags with configuration (flags take precedence)
-			cfg.MergeWithFlags(
-				excludePatterns, includePatterns, summaryPatterns,
-				minSizeStr, maxSizeStr, maxTotalSizeStr, format, outputDir,
-				maxFiles, workers, recentCommits,
-				noGitignore, summaryOnly, focusChanges,
-			)
-
-			// Use final configuration values
-			excludePatterns = cfg.Exclude
-			includePatterns = cfg.Include
-			minSizeStr = cfg.MinSize
-			maxSizeStr = cfg.MaxSize
-			maxTotalSizeStr = cfg.MaxTotalSize
-			format = cfg.Format
-			outputDir = cfg.OutputDir
-			maxFiles = cfg.MaxFiles
-			workers = cfg.Workers
-			noGitignore = cfg.NoGitignore
-
-			// Parse sizes
-			minSize, err := parseSize(minSizeStr)
-			if err != nil {
-				return fmt.Errorf("invalid min-size: %w", err)
-			}
-			maxSize, err := parseSize(maxSizeStr)
-			if err != nil {
-				return fmt.Errorf("invalid max-size: %w", err)
-			}
-			var maxTotalSize int64
-			if maxTotalSizeStr != "0" && maxTotalSizeStr != "" {
-				maxTotalSize, err = parseSize(maxTotalSizeStr)
-				if err != nil {
-					return fmt.Errorf("invalid max-total-size: %w", err)
-				}
-			}
-
-			// Merge explicit excludes with default excludes
-			excludePatterns = append(excludePatterns, defaultExcludes...)
-			if !noGitignore {
-				patterns, err := loadGitignorePatterns(dir)
-				if err != nil {
-					fmt.Printf("Warning: error loading .gitignore: %v\n", err)
-				} else if patterns != nil {
-					excludePatterns = append(excludePatterns, patterns...)
-				}
-			}
-
-			// Create the project analyzer
-			projectAnalyzer := analyzer.New(
-				dir,
-				includePatterns,
-				excludePatterns,
-				minSize,
-				maxSize,
-				maxFiles,
-				maxTotalSize,
-				workers,
-			)
-
-			if err := projectAnalyzer.CollectFiles(); err != nil {
-				return err
-			}
-
-			// Output directory
-			if format != "stdout" {
-				if outputDir == "" {
-					outputDir = filepath.Join(dir, DefaultConfig.OutputDir)
-				} else if !filepath.IsAbs(outputDir) {
-					outputDir = filepath.Join(dir, outputDir)
-				}
-				// Check if outputDir exists and is not a directory
-				if info, err := os.Stat(outputDir); err == nil {
-					if !info.IsDir() {
-						return fmt.Errorf("output path exists and is not a directory: %s", outputDir)
-					}
-				} else if !os.IsNotExist(err) {
-					return fmt.Errorf("failed to stat output directory: %w", err)
-				}
-				if err := os.MkdirAll(outputDir, 0755); err != nil {
-					return fmt.Errorf("failed to create output directory: %w", err)
-				}
-				relPath, err := filepath.Rel(dir, outputDir)
-				if err == nil && !strings.HasPrefix(relPath, "..") {
-					gitignoreEntry := strings.TrimPrefix(relPath, string(filepath.Separator))
-					if err := ensureGitignoreEntry(dir, gitignoreEntry); err != nil {
-						fmt.Printf("Warning: unable to update .gitignore: %v\n", err)
-					}
-				}
-			}
-
-			// Process files and generate output
-			if strings.HasPrefix(format, "stdout") {
-				stdoutFormat := "txt"
-				if strings.Contains(format, ":") {
-					parts := strings.SplitN(format, ":", 2)
-					if len(parts) == 2 && parts[1] != "" {
-						stdoutFormat = parts[1]
-					}
-				}
-				t0 := time.Now()
-				// Build formatter and fill it as in ProcessFiles
-				fmtr := formatter.NewFormatter(stdoutFormat, "", dir)
-				// Detect technologies, key files, issues, file types
-				technologies := detectTechnologiesLocal(projectAnalyzer.Files)
-				keyFiles := identifyKeyFilesLocal(projectAnalyzer.Files)
-				issues := identifyPotentialIssuesLocal(projectAnalyzer.Files)
-				fileTypes := collectFileExtensionsLocal(projectAnalyzer.Files)
-				// Add files
-				for _, file := range projectAnalyzer.Files {
-					absPath := filepath.Join(dir, file)
-					fileInfo, err := os.Stat(absPath)
-					if err != nil {
-						continue
-					}
-					content, _ := os.ReadFile(absPath)
-					fmtr.AddFile(formatter.FileInfo{
-						Path:     file,
-						Size:     fileInfo.Size(),
-						Content:  string(content),
-						Language: detectFileLanguageLocal(file),
-					})
-				}
-				// Set stats and structure
-				structure, _ := projectAnalyzer.GenerateProjectStructure()
-				duration := time.Since(t0)
-				if duration == 0 {
-					duration = time.Second
-				}
-				fmtr.SetStatistics(len(projectAnalyzer.Files), projectAnalyzer.TotalSize, projectAnalyzer.TokenCount, projectAnalyzer.CharCount, duration)
-				fmtr.SetTechnologies(technologies)
-				fmtr.SetKeyFiles(keyFiles)
-				fmtr.SetIssues(issues)
-				fmtr.SetFileTypes(fileTypes)
-				fmtr.SetProjectStructure(structure)
-				output, err := fmtr.GetFormattedContent()
-				if err != nil {
-					return err
-				}
-				fmt.Print(output)
-				return nil
-			} else {
-				stats, err := projectAnalyzer.ProcessFiles(outputDir, format)
-				if err != nil {
-					return err
-				}
-				printStatistics(stats, format)
-				return nil
-			}
+			ref, _ := cmd.Flags().GetString("ref")
+			return runPrompt(cmd, args[0], ref)
 		},
 	}
 
-	promptCmd.Flags().StringSliceP("exclude", "e", nil, "Exclude files matching these patterns (e.g., *.md, src/)")
-	promptCmd.Flags().StringSliceP("include", "i", nil, "Include only files matching these patterns")
-	promptCmd.Flags().String("min-size", DefaultConfig.MinSize, "Minimum file size (e.g., 1KB, 500B)")
-	promptCmd.Flags().String("max-size", DefaultConfig.MaxSize, "Maximum file size (e.g., 100MB, 1GB)")
-	promptCmd.Flags().Bool("no-gitignore", !DefaultConfig.GitIgnore, "Ignore .gitignore file")
-	promptCmd.Flags().StringP("output", "o", DefaultConfig.OutputDir, "Output directory for the prompt file")
-	promptCmd.Flags().Int("workers", DefaultConfig.WorkerCount, "Number of parallel workers (default: number of CPUs)")
-	promptCmd.Flags().Int("max-files", DefaultConfig.MaxFiles, "Maximum number of files to process (default: 500, 0 = unlimited)")
-	promptCmd.Flags().String("max-total-size", DefaultConfig.MaxTotalSize, "Maximum total size of all files (e.g., 10MB, 0 = unlimited)")
-	promptCmd.Flags().StringP("format", "f", DefaultConfig.OutputFormat, "Output format (txt, json, xml, or stdout[:txt|json|xml])")
-	// Smart Context flags
-	promptCmd.Flags().Bool("summary-only", false, "Generate only function signatures and interfaces (AST-based summarization)")
-	promptCmd.Flags().Bool("focus-changes", false, "Prioritize recently modified files (Git-aware context)")
-	promptCmd.Flags().Int("recent-commits", 0, "Include files from last N commits (use with --focus-changes)")
-	promptCmd.Flags().StringSlice("summary-patterns", nil, "File patterns to summarize (e.g., vendor/**, node_modules/**)")
+	addPromptFlags(promptCmd)
+	promptCmd.Flags().String("ref", "", "Read the files of a git commit, branch or tag instead of the working tree (or the default branch of a git URL)")
 
 	// GRAPH COMMAND
 	var graphCmd = &cobra.Command{
-		Use:   "graph [project path]",
+		Use:   "graph [directory | archive | git URL]",
 		Short: "Generate visual dependency graphs and project structure",
 		Long: `Generate visual dependency graphs and project structure representations in multiple formats.
 
@@ -538,151 +488,12 @@ Examples:
   pmp graph . --output /tmp/graph.json           # Custom output location`,
 		Args: cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			format, _ := cmd.Flags().GetString("format")
-			outputArg, _ := cmd.Flags().GetString("output")
-			projectPath := args[0]
-			if !filepath.IsAbs(projectPath) {
-				absDir, err := filepath.Abs(projectPath)
-				if err == nil {
-					projectPath = absDir
-				}
-			}
-			an := analyzer.New(
-				projectPath,
-				[]string{},
-				append([]string{}, defaultExcludes...),
-				0, 0, 0, 0, 1,
-			)
-			if err := an.CollectFiles(); err != nil {
-				return err
-			}
-			structure, err := an.GenerateProjectStructure()
-			if err != nil {
-				return err
-			}
-			var ext, content string
-			var internalDeps, externalDeps int
-			t0 := time.Now()
-			// Handle stdout and subformats
-			if strings.HasPrefix(format, "stdout") {
-				stdoutFormat := "dot"
-				if strings.Contains(format, ":") {
-					parts := strings.SplitN(format, ":", 2)
-					if len(parts) == 2 && parts[1] != "" {
-						stdoutFormat = parts[1]
-					}
-				}
-				switch stdoutFormat {
-				case "dot":
-					tree := utils.BuildTree(an.Files, filepath.Base(projectPath))
-					content = utils.GenerateDotOutput(tree)
-				case "json":
-					tree := utils.BuildTree(an.Files, filepath.Base(projectPath))
-					content = utils.GenerateJSONTreeOutput(tree)
-				case "xml":
-					tree := utils.BuildTree(an.Files, filepath.Base(projectPath))
-					content = utils.GenerateXMLTreeOutput(tree)
-				case "txt":
-					content = structure
-				default:
-					return fmt.Errorf("unsupported stdout subformat: %s", stdoutFormat)
-				}
-				fmt.Print(content)
-				return nil
-			}
-			switch format {
-			case "dot":
-				ext = "dot"
-				tree := utils.BuildTree(an.Files, filepath.Base(projectPath))
-				content = utils.GenerateDotOutput(tree)
-				internalDeps = countDotEdges(content)
-			case "json":
-				ext = "json"
-				tree := utils.BuildTree(an.Files, filepath.Base(projectPath))
-				content = utils.GenerateJSONTreeOutput(tree)
-				internalDeps = countInternalDepsFromTree(tree)
-			case "xml":
-				ext = "xml"
-				tree := utils.BuildTree(an.Files, filepath.Base(projectPath))
-				content = utils.GenerateXMLTreeOutput(tree)
-				internalDeps = countInternalDepsFromTree(tree)
-			case "txt":
-				ext = "txt"
-				content = structure
-				internalDeps = countInternalDepsFromTree(utils.BuildTree(an.Files, filepath.Base(projectPath)))
-			default:
-				return fmt.Errorf("unsupported format: %s", format)
-			}
-			timestamp := time.Now().Format("20060102_150405")
-			var outputPath string
-			if outputArg == "" {
-				outputDir := filepath.Join(projectPath, DefaultConfig.OutputDir)
-				if info, err := os.Stat(outputDir); err == nil {
-					if !info.IsDir() {
-						return fmt.Errorf("output path exists and is not a directory: %s", outputDir)
-					}
-				} else if !os.IsNotExist(err) {
-					return fmt.Errorf("failed to stat output directory: %w", err)
-				}
-				if err := os.MkdirAll(outputDir, 0755); err != nil {
-					return fmt.Errorf("failed to create output directory: %w", err)
-				}
-				if err := ensureGitignoreEntry(projectPath, DefaultConfig.OutputDir); err != nil {
-					fmt.Printf("Warning: unable to update .gitignore: %v\n", err)
-				}
-				outputPath = filepath.Join(outputDir, fmt.Sprintf("graph_%s.%s", timestamp, ext))
-			} else {
-				info, err := os.Stat(outputArg)
-				if err == nil && info.IsDir() {
-					outputPath = filepath.Join(outputArg, fmt.Sprintf("graph_%s.%s", timestamp, ext))
-				} else if err == nil && !info.IsDir() {
-					outputPath = outputArg // treat as file
-				} else if os.IsNotExist(err) {
-					if strings.HasSuffix(outputArg, "."+ext) {
-						outputPath = outputArg
-					} else {
-						// Check if outputArg exists as a file (should not happen, but for safety)
-						if info, err := os.Stat(outputArg); err == nil && !info.IsDir() {
-							return fmt.Errorf("output path exists and is not a directory: %s", outputArg)
-						}
-						if err := os.MkdirAll(outputArg, 0755); err != nil {
-							return fmt.Errorf("failed to create output directory: %w", err)
-						}
-						outputPath = filepath.Join(outputArg, fmt.Sprintf("graph_%s.%s", timestamp, ext))
-					}
-				} else {
-					return fmt.Errorf("invalid output path: %w", err)
-				}
-			}
-			if err := os.WriteFile(outputPath, []byte(content), 0644); err != nil {
-				return fmt.Errorf("failed to write output file: %w", err)
-			}
-			// Dépendances externes : simple heuristique sur fichiers connus
-			externalDeps = countExternalDeps(projectPath)
-			// Statistiques
-			elapsed := time.Since(t0)
-			stats := analyzer.StatsResult{
-				FileCount:   len(an.Files),
-				TotalSize:   an.TotalSize,
-				ProcessTime: elapsed,
-				OutputPath:  outputPath,
-				FilesPerSec: float64(len(an.Files)) / elapsed.Seconds(),
-				TokenCount:  an.TokenCount,
-				CharCount:   an.CharCount,
-				KeyFiles:    []string{},
-				Issues:      []string{},
-				FileTypes:   map[string]int{},
-			}
-			fmt.Println()
-			printStatistics(stats, format)
-			fmt.Printf("Internal dependencies: %d\n", internalDeps)
-			fmt.Printf("External dependencies: %d\n", externalDeps)
-			fmt.Println()
-			return nil
+			ref, _ := cmd.Flags().GetString("ref")
+			return runGraph(cmd, args[0], ref)
 		},
 	}
-	graphCmd.Flags().StringP("format", "f", "dot", "Output format for the graph (dot, json, xml, txt, or stdout[:dot|json|xml|txt])")
-	graphCmd.Flags().StringP("output", "o", "", "Output directory or file for the graph (default: pmp_output/)")
+	addGraphFlags(graphCmd)
+	graphCmd.Flags().String("ref", "", "Read the files of a git commit, branch or tag instead of the working tree (or the default branch of a git URL)")
 
 	// GITHUB PROMPT COMMAND
 	var githubPromptCmd = &cobra.Command{
@@ -690,8 +501,8 @@ Examples:
 		Short: "Generate AI-ready prompts from a GitHub repository",
 		Long: `Clone and analyze a GitHub repository to generate structured prompts.
 
-This command clones a GitHub repository (using shallow clone for speed) and then
-generates a comprehensive prompt from its source code, exactly like the 'pmp prompt' command.
+This command clones a GitHub repository in memory (using shallow clone for speed) and then
+generates a comprehensive prompt from its source code, exactly like 'pmp prompt <url>'.
 
 Supported URL formats:
   • https://github.com/user/repo
@@ -705,240 +516,16 @@ Examples:
   pmp github prompt https://github.com/user/repo --include "*.go" --exclude "*test*"`,
 		Args: cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			repoURL := args[0]
-			branch, _ := cmd.Flags().GetString("branch")
-
-			// Create GitHub analyzer and clone
-			ghAnalyzer := analyzer.NewGitHubAnalyzer(repoURL, branch)
-			dir, err := ghAnalyzer.Clone()
-			if err != nil {
-				return fmt.Errorf("failed to clone repository: %w", err)
-			}
-			defer ghAnalyzer.Cleanup()
-
-			// Get repository info for naming
-			repoInfo, _ := ghAnalyzer.GetRepoInfo()
-			repoName := repoInfo.Name
-			if repoName == "" {
-				repoName = "github-repo"
-			}
-
-			// Get current working directory for output
-			cwd, err := os.Getwd()
-			if err != nil {
-				return fmt.Errorf("failed to get current directory: %w", err)
-			}
-
-			// === Copy exact logic from promptCmd ===
-			cfg, err := config.LoadConfig(dir)
-			if err != nil {
-				fmt.Printf("Warning: error loading .pmprc: %v\n", err)
-				cfg = config.DefaultConfig()
-			}
-
-			// Merge with environment variables
-			envCfg := config.GetEnvironmentConfig()
-			if len(envCfg.Exclude) > 0 {
-				cfg.Exclude = envCfg.Exclude
-			}
-			if len(envCfg.Include) > 0 {
-				cfg.Include = envCfg.Include
-			}
-			if envCfg.MinSize != "" {
-				cfg.MinSize = envCfg.MinSize
-			}
-			if envCfg.MaxSize != "" {
-				cfg.MaxSize = envCfg.MaxSize
-			}
-			if envCfg.MaxFiles > 0 {
-				cfg.MaxFiles = envCfg.MaxFiles
-			}
-			if envCfg.MaxTotalSize != "" {
-				cfg.MaxTotalSize = envCfg.MaxTotalSize
-			}
-			if envCfg.Format != "" {
-				cfg.Format = envCfg.Format
-			}
-			if envCfg.OutputDir != "" {
-				cfg.OutputDir = envCfg.OutputDir
-			}
-			if envCfg.Workers > 0 {
-				cfg.Workers = envCfg.Workers
-			}
-			if envCfg.NoGitignore {
-				cfg.NoGitignore = envCfg.NoGitignore
-			}
-
-			excludePatterns, _ := cmd.Flags().GetStringSlice("exclude")
-			includePatterns, _ := cmd.Flags().GetStringSlice("include")
-			minSizeStr, _ := cmd.Flags().GetString("min-size")
-			maxSizeStr, _ := cmd.Flags().GetString("max-size")
-			noGitignore, _ := cmd.Flags().GetBool("no-gitignore")
-			outputDir, _ := cmd.Flags().GetString("output")
-			workers, _ := cmd.Flags().GetInt("workers")
-			maxFiles, _ := cmd.Flags().GetInt("max-files")
-			maxTotalSizeStr, _ := cmd.Flags().GetString("max-total-size")
-			format, _ := cmd.Flags().GetString("format")
-			summaryOnly, _ := cmd.Flags().GetBool("summary-only")
-			focusChanges, _ := cmd.Flags().GetBool("focus-changes")
-			recentCommits, _ := cmd.Flags().GetInt("recent-commits")
-			summaryPatterns, _ := cmd.Flags().GetStringSlice("summary-patterns")
-
-			cfg.MergeWithFlags(
-				excludePatterns, includePatterns, summaryPatterns,
-				minSizeStr, maxSizeStr, maxTotalSizeStr, format, outputDir,
-				maxFiles, workers, recentCommits,
-				noGitignore, summaryOnly, focusChanges,
-			)
-
-			excludePatterns = cfg.Exclude
-			includePatterns = cfg.Include
-			minSizeStr = cfg.MinSize
-			maxSizeStr = cfg.MaxSize
-			maxTotalSizeStr = cfg.MaxTotalSize
-			format = cfg.Format
-			outputDir = cfg.OutputDir
-			maxFiles = cfg.MaxFiles
-			workers = cfg.Workers
-			noGitignore = cfg.NoGitignore
-
-			minSize, err := parseSize(minSizeStr)
-			if err != nil {
-				return fmt.Errorf("invalid min-size: %w", err)
-			}
-			maxSize, err := parseSize(maxSizeStr)
-			if err != nil {
-				return fmt.Errorf("invalid max-size: %w", err)
-			}
-			var maxTotalSize int64
-			if maxTotalSizeStr != "0" && maxTotalSizeStr != "" {
-				maxTotalSize, err = parseSize(maxTotalSizeStr)
-				if err != nil {
-					return fmt.Errorf("invalid max-total-size: %w", err)
-				}
-			}
-
-			excludePatterns = append(excludePatterns, defaultExcludes...)
-			if !noGitignore {
-				patterns, err := loadGitignorePatterns(dir)
-				if err != nil {
-					fmt.Printf("Warning: error loading .gitignore: %v\n", err)
-				} else if patterns != nil {
-					excludePatterns = append(excludePatterns, patterns...)
-				}
-			}
-
-			projectAnalyzer := analyzer.New(
-				dir,
-				includePatterns,
-				excludePatterns,
-				minSize,
-				maxSize,
-				maxFiles,
-				maxTotalSize,
-				workers,
-			)
-
-			// Set custom project name and file prefix for GitHub repos
-			projectAnalyzer.ProjectName = repoName
-			projectAnalyzer.FilePrefix = repoName
-
-			if err := projectAnalyzer.CollectFiles(); err != nil {
-				return err
-			}
-
-			if format != "stdout" {
-				// Use current working directory for output (not the temp clone directory)
-				if outputDir == "" {
-					outputDir = filepath.Join(cwd, DefaultConfig.OutputDir)
-				} else if !filepath.IsAbs(outputDir) {
-					outputDir = filepath.Join(cwd, outputDir)
-				}
-				if info, err := os.Stat(outputDir); err == nil {
-					if !info.IsDir() {
-						return fmt.Errorf("output path exists and is not a directory: %s", outputDir)
-					}
-				} else if !os.IsNotExist(err) {
-					return fmt.Errorf("failed to stat output directory: %w", err)
-				}
-				if err := os.MkdirAll(outputDir, 0755); err != nil {
-					return fmt.Errorf("failed to create output directory: %w", err)
-				}
-				// Note: We don't add to .gitignore in the temp directory
-			}
-
-			if strings.HasPrefix(format, "stdout") {
-				stdoutFormat := "txt"
-				if strings.Contains(format, ":") {
-					parts := strings.SplitN(format, ":", 2)
-					if len(parts) == 2 && parts[1] != "" {
-						stdoutFormat = parts[1]
-					}
-				}
-				t0 := time.Now()
-				fmtr := formatter.NewFormatter(stdoutFormat, "", dir)
-				fmtr.SetProjectName(repoName) // Use GitHub repo name instead of temp directory name
-				technologies := detectTechnologiesLocal(projectAnalyzer.Files)
-				keyFiles := identifyKeyFilesLocal(projectAnalyzer.Files)
-				issues := identifyPotentialIssuesLocal(projectAnalyzer.Files)
-				fileTypes := collectFileExtensionsLocal(projectAnalyzer.Files)
-				for _, file := range projectAnalyzer.Files {
-					absPath := filepath.Join(dir, file)
-					fileInfo, err := os.Stat(absPath)
-					if err != nil {
-						continue
-					}
-					content, _ := os.ReadFile(absPath)
-					fmtr.AddFile(formatter.FileInfo{
-						Path:     file,
-						Size:     fileInfo.Size(),
-						Content:  string(content),
-						Language: detectFileLanguageLocal(file),
-					})
-				}
-				structure, _ := projectAnalyzer.GenerateProjectStructure()
-				duration := time.Since(t0)
-				if duration == 0 {
-					duration = time.Second
-				}
-				fmtr.SetStatistics(len(projectAnalyzer.Files), projectAnalyzer.TotalSize, projectAnalyzer.TokenCount, projectAnalyzer.CharCount, duration)
-				fmtr.SetTechnologies(technologies)
-				fmtr.SetKeyFiles(keyFiles)
-				fmtr.SetIssues(issues)
-				fmtr.SetFileTypes(fileTypes)
-				fmtr.SetProjectStructure(structure)
-				output, err := fmtr.GetFormattedContent()
-				if err != nil {
-					return err
-				}
-				fmt.Print(output)
-				return nil
-			} else {
-				stats, err := projectAnalyzer.ProcessFiles(outputDir, format)
-				if err != nil {
-					return err
-				}
-				printStatistics(stats, format)
-				return nil
+			if !source.IsGitURL(args[0]) {
+				return fmt.Errorf("not a git repository URL: %s", args[0])
 			}
+			branch, _ := cmd.Flags().GetString("branch")
+			return runPrompt(cmd, args[0], branch)
 		},
 	}
 
-	githubPromptCmd.Flags().String("branch", "", "Branch to clone (default: main/master)")
-	githubPromptCmd.Flags().StringSliceP("exclude", "e", nil, "Exclude files matching these patterns (e.g., *.md, src/)")
-	githubPromptCmd.Flags().StringSliceP("include", "i", nil, "Include only files matching these patterns")
-	githubPromptCmd.Flags().String("min-size", DefaultConfig.MinSize, "Minimum file size (e.g., 1KB, 500B)")
-	githubPromptCmd.Flags().String("max-size", DefaultConfig.MaxSize, "Maximum file size (e.g., 100MB, 1GB)")
-	githubPromptCmd.Flags().Bool("no-gitignore", !DefaultConfig.GitIgnore, "Ignore .gitignore file")
-	githubPromptCmd.Flags().StringP("output", "o", DefaultConfig.OutputDir, "Output directory for the prompt file")
-	githubPromptCmd.Flags().Int("workers", DefaultConfig.WorkerCount, "Number of parallel workers (default: number of CPUs)")
-	githubPromptCmd.Flags().Int("max-files", DefaultConfig.MaxFiles, "Maximum number of files to process (default: 500, 0 = unlimited)")
-	githubPromptCmd.Flags().String("max-total-size", DefaultConfig.MaxTotalSize, "Maximum total size of all files (e.g., 10MB, 0 = unlimited)")
-	githubPromptCmd.Flags().StringP("format", "f", DefaultConfig.OutputFormat, "Output format (txt, json, xml, or stdout[:txt|json|xml])")
-	githubPromptCmd.Flags().Bool("summary-only", false, "Generate only function signatures and interfaces (AST-based summarization)")
-	githubPromptCmd.Flags().Bool("focus-changes", false, "Prioritize recently modified files (Git-aware context)")
-	githubPromptCmd.Flags().Int("recent-commits", 0, "Include files from last N commits (use with --focus-changes)")
-	githubPromptCmd.Flags().StringSlice("summary-patterns", nil, "File patterns to summarize (e.g., vendor/**, node_modules/**)")
+	githubPromptCmd.Flags().String("branch", "", "Branch or tag to clone (default: the default branch)")
+	addPromptFlags(githubPromptCmd)
 
 	// GITHUB GRAPH COMMAND
 	var githubGraphCmd = &cobra.Command{
@@ -946,8 +533,8 @@ Examples:
 		Short: "Generate dependency graphs from a GitHub repository",
 		Long: `Clone and analyze a GitHub repository to generate visual dependency graphs.
 
-This command clones a GitHub repository (using shallow clone for speed) and then
-generates dependency graphs, exactly like the 'pmp graph' command.
+This command clones a GitHub repository in memory (using shallow clone for speed) and then
+generates dependency graphs, exactly like 'pmp graph <url>'.
 
 Supported URL formats:
   • https://github.com/user/repo
@@ -961,171 +548,16 @@ Examples:
   pmp github graph https://github.com/user/repo --format stdout:dot | dot -Tpng > graph.png`,
 		Args: cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			repoURL := args[0]
-			branch, _ := cmd.Flags().GetString("branch")
-
-			// Create GitHub analyzer and clone
-			ghAnalyzer := analyzer.NewGitHubAnalyzer(repoURL, branch)
-			projectPath, err := ghAnalyzer.Clone()
-			if err != nil {
-				return fmt.Errorf("failed to clone repository: %w", err)
-			}
-			defer ghAnalyzer.Cleanup()
-
-			// Get repository info for naming
-			repoInfo, _ := ghAnalyzer.GetRepoInfo()
-			repoName := repoInfo.Name
-			if repoName == "" {
-				repoName = "github-repo"
-			}
-
-			// Get current working directory for output
-			cwd, err := os.Getwd()
-			if err != nil {
-				return fmt.Errorf("failed to get current directory: %w", err)
-			}
-
-			// === Copy exact logic from graphCmd ===
-			format, _ := cmd.Flags().GetString("format")
-			outputArg, _ := cmd.Flags().GetString("output")
-
-			an := analyzer.New(
-				projectPath,
-				[]string{},
-				append([]string{}, defaultExcludes...),
-				0, 0, 0, 0, 1,
-			)
-
-			// Set custom project name for GitHub repos
-			an.ProjectName = repoName
-
-			if err := an.CollectFiles(); err != nil {
-				return err
-			}
-			structure, err := an.GenerateProjectStructure()
-			if err != nil {
-				return err
-			}
-			var ext, content string
-			var internalDeps, externalDeps int
-			t0 := time.Now()
-			if strings.HasPrefix(format, "stdout") {
-				stdoutFormat := "dot"
-				if strings.Contains(format, ":") {
-					parts := strings.SplitN(format, ":", 2)
-					if len(parts) == 2 && parts[1] != "" {
-						stdoutFormat = parts[1]
-					}
-				}
-				switch stdoutFormat {
-				case "dot":
-					tree := utils.BuildTree(an.Files, repoName)
-					content = utils.GenerateDotOutput(tree)
-				case "json":
-					tree := utils.BuildTree(an.Files, repoName)
-					content = utils.GenerateJSONTreeOutput(tree)
-				case "xml":
-					tree := utils.BuildTree(an.Files, repoName)
-					content = utils.GenerateXMLTreeOutput(tree)
-				case "txt":
-					content = structure
-				default:
-					return fmt.Errorf("unsupported stdout subformat: %s", stdoutFormat)
-				}
-				fmt.Print(content)
-				return nil
-			}
-			switch format {
-			case "dot":
-				ext = "dot"
-				tree := utils.BuildTree(an.Files, repoName)
-				content = utils.GenerateDotOutput(tree)
-				internalDeps = countDotEdges(content)
-			case "json":
-				ext = "json"
-				tree := utils.BuildTree(an.Files, repoName)
-				content = utils.GenerateJSONTreeOutput(tree)
-				internalDeps = countInternalDepsFromTree(tree)
-			case "xml":
-				ext = "xml"
-				tree := utils.BuildTree(an.Files, repoName)
-				content = utils.GenerateXMLTreeOutput(tree)
-				internalDeps = countInternalDepsFromTree(tree)
-			case "txt":
-				ext = "txt"
-				content = structure
-				internalDeps = countInternalDepsFromTree(utils.BuildTree(an.Files, repoName))
-			default:
-				return fmt.Errorf("unsupported format: %s", format)
-			}
-			timestamp := time.Now().Format("20060102_150405")
-			var outputPath string
-			if outputArg == "" {
-				// Use current working directory for output
-				outputDir := filepath.Join(cwd, DefaultConfig.OutputDir)
-				if info, err := os.Stat(outputDir); err == nil {
-					if !info.IsDir() {
-						return fmt.Errorf("output path exists and is not a directory: %s", outputDir)
-					}
-				} else if !os.IsNotExist(err) {
-					return fmt.Errorf("failed to stat output directory: %w", err)
-				}
-				if err := os.MkdirAll(outputDir, 0755); err != nil {
-					return fmt.Errorf("failed to create output directory: %w", err)
-				}
-				// Use repo name in filename
-				outputPath = filepath.Join(outputDir, fmt.Sprintf("%s_graph_%s.%s", repoName, timestamp, ext))
-			} else {
-				info, err := os.Stat(outputArg)
-				if err == nil && info.IsDir() {
-					outputPath = filepath.Join(outputArg, fmt.Sprintf("%s_graph_%s.%s", repoName, timestamp, ext))
-				} else if err == nil && !info.IsDir() {
-					outputPath = outputArg
-				} else if os.IsNotExist(err) {
-					if strings.HasSuffix(outputArg, "."+ext) {
-						outputPath = outputArg
-					} else {
-						if info, err := os.Stat(outputArg); err == nil && !info.IsDir() {
-							return fmt.Errorf("output path exists and is not a directory: %s", outputArg)
-						}
-						if err := os.MkdirAll(outputArg, 0755); err != nil {
-							return fmt.Errorf("failed to create output directory: %w", err)
-						}
-						outputPath = filepath.Join(outputArg, fmt.Sprintf("%s_graph_%s.%s", repoName, timestamp, ext))
-					}
-				} else {
-					return fmt.Errorf("invalid output path: %w", err)
-				}
+			if !source.IsGitURL(args[0]) {
+				return fmt.Errorf("not a git repository URL: %s", args[0])
 			}
-			if err := os.WriteFile(outputPath, []byte(content), 0644); err != nil {
-				return fmt.Errorf("failed to write output file: %w", err)
-			}
-			externalDeps = countExternalDeps(projectPath)
-			elapsed := time.Since(t0)
-			stats := analyzer.StatsResult{
-				FileCount:   len(an.Files),
-				TotalSize:   an.TotalSize,
-				ProcessTime: elapsed,
-				OutputPath:  outputPath,
-				FilesPerSec: float64(len(an.Files)) / elapsed.Seconds(),
-				TokenCount:  an.TokenCount,
-				CharCount:   an.CharCount,
-				KeyFiles:    []string{},
-				Issues:      []string{},
-				FileTypes:   map[string]int{},
-			}
-			fmt.Println()
-			printStatistics(stats, format)
-			fmt.Printf("Internal dependencies: %d\n", internalDeps)
-			fmt.Printf("External dependencies: %d\n", externalDeps)
-			fmt.Println()
-			return nil
+			branch, _ := cmd.Flags().GetString("branch")
+			return runGraph(cmd, args[0], branch)
 		},
 	}
 
-	githubGraphCmd.Flags().String("branch", "", "Branch to clone (default: main/master)")
-	githubGraphCmd.Flags().StringP("format", "f", "dot", "Output format for the graph (dot, json, xml, txt, or stdout[:dot|json|xml|txt])")
-	githubGraphCmd.Flags().StringP("output", "o", "", "Output directory or file for the graph (default: pmp_output/)")
+	githubGraphCmd.Flags().String("branch", "", "Branch or tag to clone (default: the default branch)")
+	addGraphFlags(githubGraphCmd)
 
 	// Créer une commande parente "github" pour grouper les sous-commandes
 	var githubCmd = &cobra.Command{
@@ -1137,7 +569,8 @@ Available commands:
   prompt - Generate AI-ready prompts from a GitHub repository
   graph  - Generate dependency graphs from a GitHub repository
 
-These commands use shallow cloning for speed and automatically clean up temporary files.`,
+These commands use shallow cloning in memory for speed and leave no temporary files.
+They are equivalent to 'pmp prompt <url>' and 'pmp graph <url>', with --ref for --branch.`,
 	}
 
 	githubCmd.AddCommand(githubPromptCmd)
@@ -1185,21 +618,53 @@ PowerShell:
 		},
 	}
 
+	// Built-in output templates, to be copied and adapted with --template
+	var templatesCmd = &cobra.Command{
+		Use:   "templates [name]",
+		Short: "List the built-in output templates or print one of them",
+		Long: `List the built-in output templates or print the source of one of them.
+
+The textual output formats (txt, md, xml-docs) are Go text/template files shipped
+inside the binary. Copy one, adapt it and use it with --template:
+
+  pmp templates                          # List built-in templates
+  pmp templates md > prompt.md.tmpl      # Copy the Markdown template
+  pmp prompt . --template prompt.md.tmpl # Render with the adapted template
+
+Templates receive the report (.ProjectInfo, .Technologies, .KeyFiles, .Issues,
+.Statistics, .RecentChanges, .OmittedFiles, .Part, .Instructions, .Question),
+.Structure, .FileTypeSummary and .Files (each with .Path, .Content, .Language,
+.Size, .Index, .Notes...). Helpers: fence, lang, tokens, truncate, indent, relpath, join, add,
+cdata, cdatatext, xmlescape. Defining a "file" template lets --split-tokens
+measure files precisely.
+
+The json, xml, jsonl, chunks and html formats are encoded by pmp itself, with a
+fixed schema, and have no template to copy. A template can still produce XML of
+its own with the cdata and xmlescape helpers (report.xml.tmpl writes .xml files).`,
+		Args:      cobra.MaximumNArgs(1),
+		ValidArgs: formatter.BuiltinTemplateNames(),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				for _, name := range formatter.BuiltinTemplateNames() {
+					fmt.Println(name)
+				}
+				return nil
+			}
+
+			content, err := formatter.BuiltinTemplate(args[0])
+			if err != nil {
+				return err
+			}
+			fmt.Print(content)
+			return nil
+		},
+	}
+
 	rootCmd.AddCommand(promptCmd)
 	rootCmd.AddCommand(graphCmd)
 	rootCmd.AddCommand(githubCmd)
 	rootCmd.AddCommand(completionCmd)
-
-	// Binary cache init/save
-	binaryCache := binary.NewCache()
-	if err := binaryCache.Load(); err != nil {
-		fmt.Printf("Warning: error loading binary cache: %v\n", err)
-	}
-	defer func() {
-		if err := binaryCache.Save(); err != nil {
-			fmt.Printf("Warning: error saving binary cache: %v\n", err)
-		}
-	}()
+	rootCmd.AddCommand(templatesCmd)
 
 	if err := rootCmd.Execute(); err != nil {
 		color.Red("❌ Error: %v", err)
@@ -1207,8 +672,534 @@ PowerShell:
 	}
 }
 
-// Fonctions utilitaires pour compter les dépendances internes/externes
-// (à placer en bas du fichier)
+// addPromptFlags registers the flags of the prompt commands
+func addPromptFlags(cmd *cobra.Command) {
+	cmd.Flags().StringSliceP("exclude", "e", nil, "Exclude files matching these patterns (e.g., *.md, src/)")
+	cmd.Flags().StringSliceP("include", "i", nil, "Include only files matching these patterns")
+	cmd.Flags().String("min-size", DefaultConfig.MinSize, "Minimum file size (e.g., 1KB, 500B)")
+	cmd.Flags().String("max-size", DefaultConfig.MaxSize, "Maximum file size (e.g., 100MB, 1GB)")
+	cmd.Flags().Bool("no-gitignore", !DefaultConfig.GitIgnore, "Include files ignored by git (.gitignore files, .git/info/exclude, core.excludesFile)")
+	cmd.Flags().StringP("output", "o", DefaultConfig.OutputDir, "Output directory for the prompt file")
+	cmd.Flags().Int("workers", DefaultConfig.WorkerCount, "Number of parallel workers (default: number of CPUs)")
+	cmd.Flags().Int("max-files", DefaultConfig.MaxFiles, "Maximum number of files to process (default: 500, 0 = unlimited)")
+	cmd.Flags().String("max-total-size", DefaultConfig.MaxTotalSize, "Maximum total size of all files (e.g., 10MB, 0 = unlimited)")
+	cmd.Flags().StringP("format", "f", DefaultConfig.OutputFormat, "Output format (txt, json, jsonl, chunks, xml, xml-docs, md, html, or stdout[:txt|json|jsonl|chunks|xml|xml-docs|md|html])")
+	// Smart Context flags
+	cmd.Flags().Bool("summary-only", false, "Generate only function signatures and interfaces (AST-based summarization)")
+	cmd.Flags().Bool("focus-changes", false, "Prioritize recently modified files (Git-aware context)")
+	cmd.Flags().Int("recent-commits", 0, "Include files from last N commits (use with --focus-changes; 0 = recentCommits from .pmprc, default 3)")
+	cmd.Flags().StringSlice("summary-patterns", nil, "File patterns to summarize (e.g., vendor/**, node_modules/**)")
+	cmd.Flags().Int("max-tokens", 0, "Token budget for the whole prompt: files are kept, summarized or omitted by priority (0 = unlimited)")
+	cmd.Flags().Int("split-tokens", 0, "Split the prompt into numbered parts of at most N tokens each (0 = single file)")
+	cmd.Flags().String("template", "", "Render the prompt with a Go text/template file instead of the output format (see 'pmp templates')")
+	cmd.Flags().String("task", "", "Prepend instructions for a task: "+strings.Join(task.Names(nil), ", "))
+	cmd.Flags().String("instructions", "", "Prepend the instructions of a file (after the --task preset)")
+	cmd.Flags().String("question", "", "Append a question after the file contents")
+	cmd.Flags().Bool("line-numbers", false, "Prefix file contents with line numbers (lines array with start_line in JSON/XML)")
+	cmd.Flags().Int("chunk-overlap", 0, "Lines of context repeated before each chunk of the chunks format")
+	cmd.Flags().StringSlice("strip", []string{}, "Remove from file contents: comments, doc-comments, blank-lines, license-headers")
+	cmd.Flags().Int("max-file-tokens", 0, "Truncate files over N tokens, keeping their first and last lines (or eliding long function bodies in Go and Python)")
+	cmd.Flags().Int("max-file-lines", 0, "Truncate files over N lines, keeping their first and last lines (or eliding long function bodies in Go and Python)")
+	cmd.Flags().String("on-secret", "", "What to do with secrets found in file contents: redact (default, replaced with [REDACTED:<type>]) or block (abort)")
+	cmd.Flags().Bool("allow-secrets", false, "Keep secrets found in file contents as is")
+	cmd.Flags().Bool("reproducible", false, "Byte-identical output for the same files: no host, timestamps pinned to SOURCE_DATE_EPOCH (or 1970-01-01); the output file name is pinned too, so each run overwrites the previous output")
+	cmd.Flags().Bool("dry-run", false, "Print which files would be included, the rule that decided for each of them and the projected tokens, without writing the prompt")
+	cmd.Flags().StringSlice("explain", nil, "Print whether a file would be included and which rule decided, without writing the prompt")
+}
+
+// addGraphFlags registers the flags of the graph commands
+func addGraphFlags(cmd *cobra.Command) {
+	cmd.Flags().StringP("format", "f", "dot", "Output format for the graph (dot, json, xml, txt, or stdout[:dot|json|xml|txt])")
+	cmd.Flags().StringP("output", "o", "", "Output directory or file for the graph (default: pmp_output/)")
+}
+
+// openSource opens the project to analyze: a directory, the tree of a git revision
+// when ref is set, an archive or a remote git repository
+func openSource(target, ref string) (source.Source, error) {
+	if !source.IsGitURL(target) {
+		if absTarget, err := filepath.Abs(target); err == nil {
+			target = absTarget
+		}
+	}
+	return source.Open(target, ref)
+}
+
+// outputBaseDir returns the directory relative output paths are resolved against:
+// the project directory, or the current directory for archives and remote repositories
+func outputBaseDir(dir string) (string, error) {
+	if dir != "" {
+		return dir, nil
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("failed to get current directory: %w", err)
+	}
+	return cwd, nil
+}
+
+// runPrompt generates the prompt of a project, whatever its source
+func runPrompt(cmd *cobra.Command, target, ref string) error {
+	src, err := openSource(target, ref)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dir := src.Dir()
+
+	// Load configuration from .pmprc, environment variables, and command-line flags.
+	// The .pmprc is read from the source, so that of a git revision, an archive or a
+	// remote repository applies to it.
+	cfg, err := config.LoadConfigFS(src, dir)
+	if err != nil {
+		fmt.Printf("Warning: error loading .pmprc: %v\n", err)
+		cfg = config.DefaultConfig()
+	}
+
+	// Merge with environment variables
+	envCfg := config.GetEnvironmentConfig()
+	if len(envCfg.Exclude) > 0 {
+		cfg.Exclude = envCfg.Exclude
+	}
+	if len(envCfg.Include) > 0 {
+		cfg.Include = envCfg.Include
+	}
+	if envCfg.MinSize != "" {
+		cfg.MinSize = envCfg.MinSize
+	}
+	if envCfg.MaxSize != "" {
+		cfg.MaxSize = envCfg.MaxSize
+	}
+	if envCfg.MaxFiles > 0 {
+		cfg.MaxFiles = envCfg.MaxFiles
+	}
+	if envCfg.MaxTotalSize != "" {
+		cfg.MaxTotalSize = envCfg.MaxTotalSize
+	}
+	if envCfg.Format != "" {
+		cfg.Format = envCfg.Format
+	}
+	if envCfg.OutputDir != "" {
+		cfg.OutputDir = envCfg.OutputDir
+	}
+	if envCfg.Workers > 0 {
+		cfg.Workers = envCfg.Workers
+	}
+	if envCfg.NoGitignore {
+		cfg.NoGitignore = envCfg.NoGitignore
+	}
+	if envCfg.MaxTokens > 0 {
+		cfg.MaxTokens = envCfg.MaxTokens
+	}
+	if envCfg.SplitTokens > 0 {
+		cfg.SplitTokens = envCfg.SplitTokens
+	}
+	if envCfg.Template != "" {
+		cfg.Template = envCfg.Template
+	}
+
+	// Get command-line flags
+	excludePatterns, _ := cmd.Flags().GetStringSlice("exclude")
+	includePatterns, _ := cmd.Flags().GetStringSlice("include")
+	minSizeStr, _ := cmd.Flags().GetString("min-size")
+	maxSizeStr, _ := cmd.Flags().GetString("max-size")
+	noGitignore, _ := cmd.Flags().GetBool("no-gitignore")
+	outputDir, _ := cmd.Flags().GetString("output")
+	workers, _ := cmd.Flags().GetInt("workers")
+	maxFiles, _ := cmd.Flags().GetInt("max-files")
+	maxTotalSizeStr, _ := cmd.Flags().GetString("max-total-size")
+	format, _ := cmd.Flags().GetString("format")
+	// Smart Context flags
+	summaryOnly, _ := cmd.Flags().GetBool("summary-only")
+	focusChanges, _ := cmd.Flags().GetBool("focus-changes")
+	recentCommits, _ := cmd.Flags().GetInt("recent-commits")
+	summaryPatterns, _ := cmd.Flags().GetStringSlice("summary-patterns")
+	maxTokens, _ := cmd.Flags().GetInt("max-tokens")
+	splitTokens, _ := cmd.Flags().GetInt("split-tokens")
+	templatePath, _ := cmd.Flags().GetString("template")
+	taskName, _ := cmd.Flags().GetString("task")
+	instructionsPath, _ := cmd.Flags().GetString("instructions")
+	question, _ := cmd.Flags().GetString("question")
+	lineNumbers, _ := cmd.Flags().GetBool("line-numbers")
+	chunkOverlap, _ := cmd.Flags().GetInt("chunk-overlap")
+	stripValues, _ := cmd.Flags().GetStringSlice("strip")
+	maxFileTokens, _ := cmd.Flags().GetInt("max-file-tokens")
+	maxFileLines, _ := cmd.Flags().GetInt("max-file-lines")
+	onSecret, _ := cmd.Flags().GetString("on-secret")
+	allowSecrets, _ := cmd.Flags().GetBool("allow-secrets")
+	reproducible, _ := cmd.Flags().GetBool("reproducible")
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+	explainPaths, _ := cmd.Flags().GetStringSlice("explain")
+
+	// Merge command-line flags with configuration (flags take precedence)
+	cfg.MergeWithFlags(
+		excludePatterns, includePatterns, summaryPatterns,
+		minSizeStr, maxSizeStr, maxTotalSizeStr, format, outputDir,
+		maxFiles, workers, recentCommits,
+		noGitignore, summaryOnly, focusChanges,
+	)
+	if maxTokens > 0 {
+		cfg.MaxTokens = maxTokens
+	}
+	if splitTokens > 0 {
+		cfg.SplitTokens = splitTokens
+	}
+	if templatePath != "" {
+		cfg.Template = templatePath
+	}
+	if taskName != "" {
+		cfg.Task = taskName
+	}
+	if instructionsPath != "" {
+		cfg.Instructions = instructionsPath
+	}
+	if question != "" {
+		cfg.Question = question
+	}
+	if lineNumbers {
+		cfg.LineNumbers = true
+	}
+	if chunkOverlap > 0 {
+		cfg.ChunkOverlap = chunkOverlap
+	}
+	if len(stripValues) > 0 {
+		cfg.Strip = stripValues
+	}
+	if maxFileTokens > 0 {
+		cfg.MaxFileTokens = maxFileTokens
+	}
+	if maxFileLines > 0 {
+		cfg.MaxFileLines = maxFileLines
+	}
+	if onSecret != "" {
+		cfg.OnSecret = onSecret
+	}
+	if allowSecrets {
+		cfg.AllowSecrets = true
+	}
+	if reproducible {
+		cfg.Reproducible = true
+	}
+
+	// Use final configuration values
+	excludePatterns = cfg.Exclude
+	includePatterns = cfg.Include
+	minSizeStr = cfg.MinSize
+	maxSizeStr = cfg.MaxSize
+	maxTotalSizeStr = cfg.MaxTotalSize
+	format = cfg.Format
+	outputDir = cfg.OutputDir
+	maxFiles = cfg.MaxFiles
+	workers = cfg.Workers
+	noGitignore = cfg.NoGitignore
+	summaryOnly = cfg.SummaryOnly
+	summaryPatterns = cfg.SummaryPatterns
+	focusChanges = cfg.FocusChanges
+	recentCommits = cfg.RecentCommits
+	maxTokens = cfg.MaxTokens
+	splitTokens = cfg.SplitTokens
+	templatePath = cfg.Template
+	question = cfg.Question
+	lineNumbers = cfg.LineNumbers
+	chunkOverlap = cfg.ChunkOverlap
+	stripOptions, err := strip.ParseOptions(cfg.Strip)
+	if err != nil {
+		return err
+	}
+	secretMode, err := secrets.ParseMode(cfg.OnSecret)
+	if err != nil {
+		return err
+	}
+	if cfg.AllowSecrets {
+		secretMode = secrets.Allow
+	}
+	sourceDate, sourceDateSet, err := sourceDateEpoch()
+	if err != nil {
+		return err
+	}
+	reproducible = cfg.Reproducible || sourceDateSet
+
+	// Build the instructions written before the project structure
+	instructions, err := task.Instructions(cfg.Task, cfg.Instructions, cfg.Tasks)
+	if err != nil {
+		return err
+	}
+
+	// Parse sizes
+	minSize, err := parseSize(minSizeStr)
+	if err != nil {
+		return fmt.Errorf("invalid min-size: %w", err)
+	}
+	maxSize, err := parseSize(maxSizeStr)
+	if err != nil {
+		return fmt.Errorf("invalid max-size: %w", err)
+	}
+	var maxTotalSize int64
+	if maxTotalSizeStr != "0" && maxTotalSizeStr != "" {
+		maxTotalSize, err = parseSize(maxTotalSizeStr)
+		if err != nil {
+			return fmt.Errorf("invalid max-total-size: %w", err)
+		}
+	}
+
+	// Merge explicit excludes with default excludes, remembering where each
+	// pattern comes from to explain exclusions
+	excludeSource := ".pmprc"
+	if cmd.Flags().Changed("exclude") {
+		excludeSource = "--exclude"
+	}
+	excludeSources := patternSources(nil, len(excludePatterns), excludeSource)
+	excludePatterns = append(excludePatterns, defaultExcludes...)
+	excludeSources = patternSources(excludeSources, len(excludePatterns), analyzer.DefaultExcludesSource)
+
+	// Create the project analyzer
+	projectAnalyzer := analyzer.New(
+		dir,
+		includePatterns,
+		excludePatterns,
+		minSize,
+		maxSize,
+		maxFiles,
+		maxTotalSize,
+		workers,
+	)
+	projectAnalyzer.SummaryOnly = summaryOnly
+	projectAnalyzer.SummaryPatterns = summaryPatterns
+	projectAnalyzer.FocusChanges = focusChanges
+	projectAnalyzer.RecentCommits = recentCommits
+	projectAnalyzer.MaxTokens = maxTokens
+	projectAnalyzer.SplitTokens = splitTokens
+	projectAnalyzer.Template = templatePath
+	projectAnalyzer.Instructions = instructions
+	projectAnalyzer.Question = question
+	projectAnalyzer.LineNumbers = lineNumbers
+	projectAnalyzer.ChunkOverlap = chunkOverlap
+	projectAnalyzer.Strip = stripOptions
+	projectAnalyzer.Truncate = truncate.Options{MaxTokens: cfg.MaxFileTokens, MaxLines: cfg.MaxFileLines}
+	projectAnalyzer.OnSecret = secretMode
+	projectAnalyzer.Reproducible = reproducible
+	projectAnalyzer.SourceDate = sourceDate
+	projectAnalyzer.ExcludeSources = excludeSources
+	projectAnalyzer.Gitignore = !noGitignore
+	projectAnalyzer.PmpFiles = true
+
+	projectAnalyzer.Source = src
+	if _, local := src.(*source.Dir); focusChanges && !local {
+		return fmt.Errorf("--focus-changes compares the working tree with HEAD and cannot be used with --ref, archives or remote repositories")
+	}
+	if dir == "" {
+		// Name the output after the archive or repository
+		projectAnalyzer.FilePrefix = src.Name()
+	}
+
+	if err := projectAnalyzer.CollectFiles(); err != nil {
+		return err
+	}
+
+	// Report what the prompt would contain instead of writing it
+	if dryRun || len(explainPaths) > 0 {
+		return printDryRun(projectAnalyzer, format, explainPaths)
+	}
+
+	// Output directory, in the project or in the current directory for archives and
+	// remote repositories
+	if format != "stdout" {
+		baseDir, err := outputBaseDir(dir)
+		if err != nil {
+			return err
+		}
+		if outputDir == "" {
+			outputDir = filepath.Join(baseDir, DefaultConfig.OutputDir)
+		} else if !filepath.IsAbs(outputDir) {
+			outputDir = filepath.Join(baseDir, outputDir)
+		}
+		// Check if outputDir exists and is not a directory
+		if info, err := os.Stat(outputDir); err == nil {
+			if !info.IsDir() {
+				return fmt.Errorf("output path exists and is not a directory: %s", outputDir)
+			}
+		} else if !os.IsNotExist(err) {
+			return fmt.Errorf("failed to stat output directory: %w", err)
+		}
+		if err := os.MkdirAll(outputDir, 0755); err != nil {
+			return fmt.Errorf("failed to create output directory: %w", err)
+		}
+		relPath, err := filepath.Rel(dir, outputDir)
+		if dir != "" && err == nil && !strings.HasPrefix(relPath, "..") {
+			gitignoreEntry := strings.TrimPrefix(relPath, string(filepath.Separator))
+			if err := ensureGitignoreEntry(dir, gitignoreEntry); err != nil {
+				fmt.Printf("Warning: unable to update .gitignore: %v\n", err)
+			}
+		}
+	}
+
+	// Process files and generate output
+	if strings.HasPrefix(format, "stdout") {
+		_, err := projectAnalyzer.ProcessFilesToStdout(stdoutSubformat(format, "txt"))
+		return err
+	} else {
+		stats, err := projectAnalyzer.ProcessFiles(outputDir, format)
+		if err != nil {
+			return err
+		}
+		printStatistics(stats, format)
+		return nil
+	}
+}
+
+// runGraph generates the structure graph of a project, whatever its source
+func runGraph(cmd *cobra.Command, target, ref string) error {
+	format, _ := cmd.Flags().GetString("format")
+	outputArg, _ := cmd.Flags().GetString("output")
+	src, err := openSource(target, ref)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	an := analyzer.New(
+		src.Dir(),
+		[]string{},
+		append([]string{}, defaultExcludes...),
+		0, 0, 0, 0, 1,
+	)
+	an.Source = src
+	if err := an.CollectFiles(); err != nil {
+		return err
+	}
+	structure, err := an.GenerateProjectStructure()
+	if err != nil {
+		return err
+	}
+	var ext, content string
+	var internalDeps, externalDeps int
+	t0 := time.Now()
+	// Handle stdout and subformats
+	if strings.HasPrefix(format, "stdout") {
+		stdoutFormat := "dot"
+		if strings.Contains(format, ":") {
+			parts := strings.SplitN(format, ":", 2)
+			if len(parts) == 2 && parts[1] != "" {
+				stdoutFormat = parts[1]
+			}
+		}
+		switch stdoutFormat {
+		case "dot":
+			tree := utils.BuildTree(an.Files, src.Name())
+			content = utils.GenerateDotOutput(tree)
+		case "json":
+			tree := utils.BuildTree(an.Files, src.Name())
+			content = utils.GenerateJSONTreeOutput(tree)
+		case "xml":
+			tree := utils.BuildTree(an.Files, src.Name())
+			content = utils.GenerateXMLTreeOutput(tree)
+		case "txt":
+			content = structure
+		default:
+			return fmt.Errorf("unsupported stdout subformat: %s", stdoutFormat)
+		}
+		fmt.Print(content)
+		return nil
+	}
+	switch format {
+	case "dot":
+		ext = "dot"
+		tree := utils.BuildTree(an.Files, src.Name())
+		content = utils.GenerateDotOutput(tree)
+		internalDeps = countDotEdges(content)
+	case "json":
+		ext = "json"
+		tree := utils.BuildTree(an.Files, src.Name())
+		content = utils.GenerateJSONTreeOutput(tree)
+		internalDeps = countInternalDepsFromTree(tree)
+	case "xml":
+		ext = "xml"
+		tree := utils.BuildTree(an.Files, src.Name())
+		content = utils.GenerateXMLTreeOutput(tree)
+		internalDeps = countInternalDepsFromTree(tree)
+	case "txt":
+		ext = "txt"
+		content = structure
+		internalDeps = countInternalDepsFromTree(utils.BuildTree(an.Files, src.Name()))
+	default:
+		return fmt.Errorf("unsupported format: %s", format)
+	}
+	timestamp := time.Now().Format("20060102_150405")
+	fileName := fmt.Sprintf("graph_%s.%s", timestamp, ext)
+	if src.Dir() == "" {
+		// Name the graph after the archive or repository
+		fileName = src.Name() + "_" + fileName
+	}
+	var outputPath string
+	if outputArg == "" {
+		baseDir, err := outputBaseDir(src.Dir())
+		if err != nil {
+			return err
+		}
+		outputDir := filepath.Join(baseDir, DefaultConfig.OutputDir)
+		if info, err := os.Stat(outputDir); err == nil {
+			if !info.IsDir() {
+				return fmt.Errorf("output path exists and is not a directory: %s", outputDir)
+			}
+		} else if !os.IsNotExist(err) {
+			return fmt.Errorf("failed to stat output directory: %w", err)
+		}
+		if err := os.MkdirAll(outputDir, 0755); err != nil {
+			return fmt.Errorf("failed to create output directory: %w", err)
+		}
+		if src.Dir() != "" {
+			if err := ensureGitignoreEntry(src.Dir(), DefaultConfig.OutputDir); err != nil {
+				fmt.Printf("Warning: unable to update .gitignore: %v\n", err)
+			}
+		}
+		outputPath = filepath.Join(outputDir, fileName)
+	} else {
+		info, err := os.Stat(outputArg)
+		if err == nil && info.IsDir() {
+			outputPath = filepath.Join(outputArg, fileName)
+		} else if err == nil && !info.IsDir() {
+			outputPath = outputArg // treat as file
+		} else if os.IsNotExist(err) {
+			if strings.HasSuffix(outputArg, "."+ext) {
+				outputPath = outputArg
+			} else {
+				// Check if outputArg exists as a file (should not happen, but for safety)
+				if info, err := os.Stat(outputArg); err == nil && !info.IsDir() {
+					return fmt.Errorf("output path exists and is not a directory: %s", outputArg)
+				}
+				if err := os.MkdirAll(outputArg, 0755); err != nil {
+					return fmt.Errorf("failed to create output directory: %w", err)
+				}
+				outputPath = filepath.Join(outputArg, fileName)
+			}
+		} else {
+			return fmt.Errorf("invalid output path: %w", err)
+		}
+	}
+	if err := os.WriteFile(outputPath, []byte(content), 0644); err != nil {
+		return fmt.Errorf("failed to write output file: %w", err)
+	}
+	// Dépendances externes : simple heuristique sur fichiers connus
+	externalDeps = countExternalDeps(an.Source)
+	// Statistiques
+	elapsed := time.Since(t0)
+	stats := analyzer.StatsResult{
+		FileCount:   len(an.Files),
+		TotalSize:   an.TotalSize,
+		ProcessTime: elapsed,
+		OutputPath:  outputPath,
+		FilesPerSec: float64(len(an.Files)) / elapsed.Seconds(),
+		TokenCount:  an.TokenCount,
+		CharCount:   an.CharCount,
+		KeyFiles:    []string{},
+		Issues:      []string{},
+		FileTypes:   map[string]int{},
+	}
+	fmt.Println()
+	printStatistics(stats, format)
+	fmt.Printf("Internal dependencies: %d\n", internalDeps)
+	fmt.Printf("External dependencies: %d\n", externalDeps)
+	fmt.Println()
+	return nil
+}
 
 // Compte les arêtes dans le DOT (dépendances internes)
 func countDotEdges(dot string) int {
@@ -1232,14 +1223,13 @@ func countInternalDepsFromTree(tree *utils.Directory) int {
 }
 
 // Compte les dépendances externes (heuristique simple)
-func countExternalDeps(projectPath string) int {
+func countExternalDeps(fsys fs.FS) int {
 	count := 0
 	depFiles := []string{"go.mod", "package.json", "requirements.txt"}
 	for _, depFile := range depFiles {
-		path := filepath.Join(projectPath, depFile)
-		if _, err := os.Stat(path); err == nil {
+		if _, err := fs.Stat(fsys, depFile); err == nil {
 			// Compter les dépendances dans le fichier
-			lines, err := os.ReadFile(path)
+			lines, err := fs.ReadFile(fsys, depFile)
 			if err == nil {
 				for _, line := range strings.Split(string(lines), "\n") {
 					line = strings.TrimSpace(line)
@@ -1259,136 +1249,10 @@ func countExternalDeps(projectPath string) int {
 	return count
 }
 
-// Local copies of analyzer helpers for stdout output (since originals are not exported)
-func detectTechnologiesLocal(files []string) []string {
-	technologies := make(map[string]bool)
-	for _, file := range files {
-		switch {
-		case strings.HasSuffix(file, ".go"):
-			technologies["Go"] = true
-		case strings.HasSuffix(file, ".js"):
-			technologies["JavaScript"] = true
-		case strings.HasSuffix(file, ".ts"):
-			technologies["TypeScript"] = true
-		case strings.HasSuffix(file, ".py"):
-			technologies["Python"] = true
-		case strings.HasSuffix(file, ".java"):
-			technologies["Java"] = true
-		case strings.HasSuffix(file, ".rb"):
-			technologies["Ruby"] = true
-		case strings.HasSuffix(file, ".php"):
-			technologies["PHP"] = true
-		case strings.HasSuffix(file, ".cs"):
-			technologies["C#"] = true
-		case strings.HasSuffix(file, ".c"), strings.HasSuffix(file, ".cpp"), strings.HasSuffix(file, ".h"):
-			technologies["C/C++"] = true
-		case strings.HasSuffix(file, ".html"):
-			technologies["HTML"] = true
-		case strings.HasSuffix(file, ".css"):
-			technologies["CSS"] = true
-		}
-		switch filepath.Base(file) {
-		case "package.json":
-			technologies["Node.js"] = true
-		case "go.mod":
-			technologies["Go"] = true
-		case "requirements.txt":
-			technologies["Python"] = true
-		case "Gemfile":
-			technologies["Ruby"] = true
-		case "composer.json":
-			technologies["PHP"] = true
-		}
-	}
-	result := make([]string, 0, len(technologies))
-	for tech := range technologies {
-		result = append(result, tech)
-	}
-	return result
-}
-
-func identifyKeyFilesLocal(files []string) []string {
-	keyFiles := make([]string, 0)
-	for _, file := range files {
-		basename := filepath.Base(file)
-		switch basename {
-		case "main.go", "app.js", "index.js", "package.json", "go.mod", "requirements.txt",
-			"setup.py", "Makefile", "Dockerfile", "docker-compose.yml", "README.md":
-			keyFiles = append(keyFiles, file)
-		}
-	}
-	return keyFiles
-}
-
-func identifyPotentialIssuesLocal(files []string) []string {
-	issues := make([]string, 0)
-	hasReadme := false
-	for _, file := range files {
-		if strings.Contains(strings.ToLower(filepath.Base(file)), "readme") {
-			hasReadme = true
-			break
-		}
-	}
-	if !hasReadme {
-		issues = append(issues, "Missing README file")
-	}
-	return issues
-}
-
-func collectFileExtensionsLocal(files []string) map[string]int {
-	extensions := make(map[string]int)
-	for _, file := range files {
-		ext := filepath.Ext(file)
-		if ext == "" {
-			ext = "(no extension)"
-		}
-		extensions[ext]++
-	}
-	return extensions
-}
-
-func detectFileLanguageLocal(filename string) string {
-	ext := filepath.Ext(filename)
-	switch strings.ToLower(ext) {
-	case ".go":
-		return "Go"
-	case ".js":
-		return "JavaScript"
-	case ".ts":
-		return "TypeScript"
-	case ".py":
-		return "Python"
-	case ".java":
-		return "Java"
-	case ".rb":
-		return "Ruby"
-	case ".php":
-		return "PHP"
-	case ".cs":
-		return "C#"
-	case ".c":
-		return "C"
-	case ".cpp", ".cc":
-		return "C++"
-	case ".h":
-		return "C/C++ Header"
-	case ".html", ".htm":
-		return "HTML"
-	case ".css":
-		return "CSS"
-	case ".json":
-		return "JSON"
-	case ".xml":
-		return "XML"
-	case ".md":
-		return "Markdown"
-	case ".sh":
-		return "Shell"
-	case ".bat", ".cmd":
-		return "Batch"
-	case ".sql":
-		return "SQL"
-	default:
-		return "Plain Text"
+// stdoutSubformat extracts the subformat of a "stdout[:format]" value
+func stdoutSubformat(format, fallback string) string {
+	if parts := strings.SplitN(format, ":", 2); len(parts) == 2 && parts[1] != "" {
+		return parts[1]
 	}
+	return fallback
 }
@@ -1,15 +1,25 @@
 package analyzer
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"io"
 	"io/fs"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/benoitpetit/prompt-my-project/pkg/binary"
 	"github.com/benoitpetit/prompt-my-project/pkg/formatter"
+	gitchanges "github.com/benoitpetit/prompt-my-project/pkg/git"
+	"github.com/benoitpetit/prompt-my-project/pkg/secrets"
+	"github.com/benoitpetit/prompt-my-project/pkg/source"
+	"github.com/benoitpetit/prompt-my-project/pkg/strip"
+	"github.com/benoitpetit/prompt-my-project/pkg/summarizer"
+	"github.com/benoitpetit/prompt-my-project/pkg/truncate"
 	"github.com/benoitpetit/prompt-my-project/pkg/utils"
 	"github.com/benoitpetit/prompt-my-project/pkg/worker"
 	"github.com/bmatcuk/doublestar/v4"
@@ -19,9 +29,21 @@ import (
 
 // ProjectAnalyzer analyzes a project directory
 type ProjectAnalyzer struct {
-	Dir             string
+	Dir string
+	// Source provides the files of the project: the directory Dir, or its tree at a
+	// git revision
+	Source          source.Source
 	IncludePatterns []string
 	ExcludePatterns []string
+	// ExcludeSources tells where each exclude pattern comes from (--exclude, .pmprc,
+	// default excludes...) to explain why a file is excluded; it may be empty
+	ExcludeSources []string
+	// Gitignore skips the files ignored by git: .gitignore files of every directory,
+	// .git/info/exclude and core.excludesFile
+	Gitignore bool
+	// PmpFiles applies the .pmpignore files of every directory and the .pmpinclude
+	// file of the project
+	PmpFiles        bool
 	MinSize         int64
 	MaxSize         int64
 	MaxFiles        int
@@ -32,8 +54,48 @@ type ProjectAnalyzer struct {
 	TokenCount      int
 	CharCount       int
 	BinaryCache     *binary.Cache
-	FilePrefix      string // Optional prefix for output filename (e.g., repo name for GitHub)
-	ProjectName     string // Optional custom project name (e.g., for GitHub repos)
+	FilePrefix      string   // Optional prefix for output filename (e.g., repo name for GitHub)
+	ProjectName     string   // Optional custom project name (e.g., for GitHub repos)
+	SummaryOnly     bool     // Replace every file by its summary (signatures only)
+	SummaryPatterns []string // Replace files matching these patterns by their summary
+	FocusChanges    bool     // Put files changed in git first and never drop them
+	RecentCommits   int      // Also treat files from the last N commits as changed
+	// RecentChanges lists the changed files found when FocusChanges is set
+	// (paths relative to Dir)
+	RecentChanges []gitchanges.FileChange
+	// MaxTokens is the token budget of the rendered prompt (0 = unlimited)
+	MaxTokens int
+	// SplitTokens splits the prompt into parts of at most this many tokens (0 = single file)
+	SplitTokens int
+	// Template is a text/template file used instead of the output format
+	Template string
+	// Instructions are written before the project structure (task preset, instructions file)
+	Instructions string
+	// Question is written after the file contents
+	Question string
+	// LineNumbers prefixes file contents with their line numbers
+	LineNumbers bool
+	// ChunkOverlap repeats this many lines before each chunk of the chunks format
+	ChunkOverlap int
+	// Strip removes comments, blank lines or license headers from file contents
+	Strip strip.Options
+	// Truncate keeps the head and tail (or the declarations) of files over a number
+	// of tokens or lines
+	Truncate truncate.Options
+	// OnSecret is what happens to the secrets found in file contents (redacted by default)
+	OnSecret secrets.Mode
+	// Reproducible makes the output depend only on the files: timestamps are pinned
+	// to SourceDate and the host and the processing speed are omitted
+	Reproducible bool
+	SourceDate   time.Time
+	// Candidates lists every file seen by CollectFiles and what became of it, in
+	// walking order; it is written as a manifest next to the prompt
+	Candidates     []Candidate
+	candidateIndex map[string]int
+	// lastCommits holds the last commit of each file for the structured formats
+	lastCommits map[string]*formatter.CommitInfo
+	// forced holds the collected files that .pmpinclude forces in
+	forced map[string]bool
 }
 
 // StatsResult represents statistics from project analysis
@@ -49,6 +111,30 @@ type StatsResult struct {
 	KeyFiles     []string
 	Issues       []string
 	FileTypes    map[string]int
+	// SummarizedCount is the number of files replaced by their summary
+	SummarizedCount int
+	// PromptTokens is the estimated size of the rendered prompt when a token budget is set
+	PromptTokens int
+	// OmittedFiles lists the files left out to respect the token budget
+	OmittedFiles []string
+	// OutputParts lists the files written when the prompt is split into parts
+	OutputParts []string
+	// StrippedTokens is the estimated number of tokens removed by Strip
+	StrippedTokens int
+	// StrippedFiles gives the estimated number of tokens removed by Strip per file
+	StrippedFiles map[string]int
+	// TruncatedFiles is the number of files cut to fit the per-file limits
+	TruncatedFiles int
+	// Redactions counts the secrets replaced in file contents by type
+	Redactions map[string]int
+	// RedactedFiles is the number of files where secrets were replaced
+	RedactedFiles int
+	// ManifestPath is the manifest listing every candidate file, next to the output
+	ManifestPath string
+	// ReplacedFiles lists the output files that existed and were overwritten
+	ReplacedFiles []string
+
+	startTime time.Time
 }
 
 // New creates a new project analyzer
@@ -62,6 +148,7 @@ func New(
 ) *ProjectAnalyzer {
 	return &ProjectAnalyzer{
 		Dir:             dir,
+		Source:          source.NewDir(dir),
 		IncludePatterns: includePatterns,
 		ExcludePatterns: excludePatterns,
 		MinSize:         minSize,
@@ -90,17 +177,43 @@ func (pa *ProjectAnalyzer) CollectFiles() error {
 		return fmt.Errorf("error collecting files: %w", err)
 	}
 
-	// Limit the number of files
-	if pa.MaxFiles > 0 && len(files) > pa.MaxFiles {
-		fmt.Fprintf(os.Stderr, "Limiting to %d files (from %d total)\n", pa.MaxFiles, len(files))
-		files = files[:pa.MaxFiles]
+	// Put changed files first so that they survive truncation
+	changed := make(map[string]bool)
+	if pa.FocusChanges {
+		pa.loadRecentChanges(files)
+		for _, change := range pa.RecentChanges {
+			changed[change.Path] = true
+		}
+		files = prioritizeChangedFiles(files, changed)
+	}
+
+	// Changed files and files forced in by .pmpinclude are never dropped by the limits
+	pinned := make(map[string]bool, len(changed)+len(pa.forced))
+	for file := range changed {
+		pinned[file] = true
+	}
+	for file := range pa.forced {
+		pinned[file] = true
+	}
+
+	// Limit the number of files, keeping the highest priority ones and always keeping pinned files
+	if limit := max(pa.MaxFiles, countChanged(files, pinned)); pa.MaxFiles > 0 && len(files) > limit {
+		fmt.Fprintf(os.Stderr, "Limiting to %d files (from %d total)\n", limit, len(files))
+		keep := make(map[string]bool, limit)
+		for _, file := range pa.sortByPriority(files, pinned)[:limit] {
+			keep[file] = true
+		}
+		pa.excludeDropped(files, keep, ReasonMaxFiles)
+		files = keepInOrder(files, keep)
 	}
 
 	// Calculate total size
+	sizes := make(map[string]int64, len(files))
 	var totalSize int64
 	for _, file := range files {
-		info, err := os.Stat(filepath.Join(pa.Dir, file))
+		info, err := fs.Stat(pa.projectSource(), filepath.ToSlash(file))
 		if err == nil {
+			sizes[file] = info.Size()
 			totalSize += info.Size()
 		}
 	}
@@ -111,135 +224,359 @@ func (pa *ProjectAnalyzer) CollectFiles() error {
 			humanize.Bytes(uint64(totalSize)),
 			humanize.Bytes(uint64(pa.MaxTotalSize)))
 
-		// Sort files by size and keep only those that fit the limit
-		type FileWithSize struct {
-			Path string
-			Size int64
-		}
-
-		var filesWithSize []FileWithSize
+		// Keep pinned files, then the highest priority files that still fit the limit
+		keep := make(map[string]bool, len(files))
+		var currentSize int64
 		for _, file := range files {
-			info, err := os.Stat(filepath.Join(pa.Dir, file))
-			if err == nil {
-				filesWithSize = append(filesWithSize, FileWithSize{
-					Path: file,
-					Size: info.Size(),
-				})
+			if pinned[file] {
+				keep[file] = true
+				currentSize += sizes[file]
 			}
 		}
-
-		// Sort by size (smallest first) to maximize file count
-		for i := 0; i < len(filesWithSize)-1; i++ {
-			for j := i + 1; j < len(filesWithSize); j++ {
-				if filesWithSize[i].Size > filesWithSize[j].Size {
-					filesWithSize[i], filesWithSize[j] = filesWithSize[j], filesWithSize[i]
-				}
+		for _, file := range pa.sortByPriority(files, pinned) {
+			if keep[file] {
+				continue
 			}
-		}
-
-		// Keep files that fit within the limit
-		files = []string{}
-		var currentSize int64
-		for _, fileWithSize := range filesWithSize {
-			if currentSize+fileWithSize.Size <= pa.MaxTotalSize {
-				files = append(files, fileWithSize.Path)
-				currentSize += fileWithSize.Size
-			} else {
-				break
+			if size, ok := sizes[file]; ok && currentSize+size <= pa.MaxTotalSize {
+				keep[file] = true
+				currentSize += size
 			}
 		}
 
-		fmt.Fprintf(os.Stderr, "Reduced file count from %d to %d to fit size limit\n", len(filesWithSize), len(files))
+		fmt.Fprintf(os.Stderr, "Reduced file count from %d to %d to fit size limit\n", len(files), len(keep))
+		pa.excludeDropped(files, keep, ReasonMaxTotalSize)
+		files = keepInOrder(files, keep)
 	}
 
 	pa.Files = files
 	return nil
 }
 
+// excludeDropped records the files left out of the keep set by a limit
+func (pa *ProjectAnalyzer) excludeDropped(files []string, keep map[string]bool, reason string) {
+	for _, file := range files {
+		if !keep[file] {
+			pa.setStatus(file, StatusExcluded, reason, "")
+		}
+	}
+}
+
+// loadRecentChanges records the git changes that affect the collected files.
+// Deleted files are kept so that they can be reported even though they have no content.
+func (pa *ProjectAnalyzer) loadRecentChanges(files []string) {
+	pa.RecentChanges = nil
+	if pa.Dir == "" {
+		fmt.Fprintf(os.Stderr, "Warning: --focus-changes ignored: %s is not a local directory\n", pa.projectSource().Name())
+		return
+	}
+
+	changesAnalyzer, err := gitchanges.NewChangesAnalyzer(pa.Dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: --focus-changes ignored: %v\n", err)
+		return
+	}
+
+	changes, err := changesAnalyzer.GetAllChangedFiles(pa.RecentCommits > 0, pa.RecentCommits)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: unable to read git changes: %v\n", err)
+		return
+	}
+
+	collected := make(map[string]bool, len(files))
+	for _, file := range files {
+		collected[file] = true
+	}
+
+	// Resolve symlinks so that paths are comparable with the worktree root
+	projectDir := pa.Dir
+	if resolved, err := filepath.EvalSymlinks(projectDir); err == nil {
+		projectDir = resolved
+	}
+
+	for _, change := range changes {
+		relPath, err := filepath.Rel(projectDir, change.Path)
+		if err != nil || strings.HasPrefix(relPath, "..") {
+			continue // Outside of the analyzed directory
+		}
+		if !collected[relPath] && change.ChangeType != gitchanges.ChangeTypeDeleted {
+			continue // Filtered out (excluded, binary, size limits...)
+		}
+		change.Path = relPath
+		pa.RecentChanges = append(pa.RecentChanges, change)
+	}
+
+	fmt.Fprintf(os.Stderr, "Focusing on %d changed file(s)\n", len(pa.RecentChanges))
+}
+
+// loadLastCommits finds the last commit that changed each collected file, for the
+// file metadata of the structured formats. Outside of a git repository, files have
+// no last commit, as well as in archives and remote repositories.
+func (pa *ProjectAnalyzer) loadLastCommits() {
+	pa.lastCommits = nil
+	if pa.Dir == "" {
+		return
+	}
+
+	changesAnalyzer, err := gitchanges.NewChangesAnalyzer(pa.Dir)
+	if err != nil {
+		return
+	}
+
+	// Resolve symlinks so that paths are comparable with the worktree root
+	projectDir, err := filepath.Abs(pa.Dir)
+	if err != nil {
+		return
+	}
+	if resolved, err := filepath.EvalSymlinks(projectDir); err == nil {
+		projectDir = resolved
+	}
+
+	paths := make([]string, len(pa.Files))
+	for i, file := range pa.Files {
+		paths[i] = filepath.Join(projectDir, file)
+	}
+	rev := ""
+	if tree, ok := pa.projectSource().(*source.GitTree); ok {
+		rev = tree.Commit()
+	}
+	commits, err := changesAnalyzer.LastCommits(rev, paths)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: unable to read git history: %v\n", err)
+		return
+	}
+
+	pa.lastCommits = make(map[string]*formatter.CommitInfo, len(commits))
+	for i, path := range paths {
+		if commit, ok := commits[path]; ok {
+			pa.lastCommits[pa.Files[i]] = &formatter.CommitInfo{
+				Hash:   commit.Hash,
+				Author: commit.Author,
+				Date:   commit.Date,
+			}
+		}
+	}
+}
+
+// fileMetadataFormat reports whether the output format carries the git metadata of
+// files, which costs a walk of the history
+func (pa *ProjectAnalyzer) fileMetadataFormat(format string) bool {
+	switch formatter.OutputFormat(strings.ToLower(format)) {
+	case formatter.FormatJSON, formatter.FormatXML, formatter.FormatJSONL:
+		return true
+	}
+	return pa.Template != ""
+}
+
+// prioritizeChangedFiles moves changed files to the front, preserving the relative order
+func prioritizeChangedFiles(files []string, changed map[string]bool) []string {
+	result := make([]string, 0, len(files))
+	for _, file := range files {
+		if changed[file] {
+			result = append(result, file)
+		}
+	}
+	for _, file := range files {
+		if !changed[file] {
+			result = append(result, file)
+		}
+	}
+	return result
+}
+
+// countChanged counts the files present in the changed set
+func countChanged(files []string, changed map[string]bool) int {
+	count := 0
+	for _, file := range files {
+		if changed[file] {
+			count++
+		}
+	}
+	return count
+}
+
 // collectFiles collects files that match criteria
 func (pa *ProjectAnalyzer) collectFiles() ([]string, error) {
 	var result []string
 	var totalSize int64
-	var matcher gitignore.Matcher
+	pa.Candidates, pa.candidateIndex = nil, nil
+	pa.forced = make(map[string]bool)
+
+	// Parse exclude patterns (gitignore syntax)
+	patterns := make([]gitignore.Pattern, 0, len(pa.ExcludePatterns))
+	negated := false
+	for _, pattern := range pa.ExcludePatterns {
+		patterns = append(patterns, gitignore.ParsePattern(pattern, nil))
+		negated = negated || strings.HasPrefix(pattern, "!")
+	}
 
-	// Setup gitignore matcher if needed
-	if len(pa.ExcludePatterns) > 0 {
-		patterns := make([]gitignore.Pattern, 0, len(pa.ExcludePatterns))
-		for _, pattern := range pa.ExcludePatterns {
-			patterns = append(patterns, gitignore.ParsePattern(pattern, nil))
-		}
-		matcher = gitignore.NewMatcher(patterns)
+	src := pa.projectSource()
+	var ignored *ignoreRules
+	if pa.Gitignore {
+		ignored = newGitignoreRules(pa.Dir, src)
+	}
+	var pmpIgnored *ignoreRules
+	var forced *forceRules
+	if pa.PmpFiles {
+		pmpIgnored = newPmpIgnoreRules(pa.Dir, src)
+		forced = newForceRules(pa.Dir, src)
 	}
 
+	// Excluded directory walked only for the files that .pmpinclude forces in, and
+	// whether only the paths named under it are looked for
+	pruned := ""
+	prunedExplicit := false
+
 	fileCount := 0
 
 	// Walk the directory tree
-	err := filepath.WalkDir(pa.Dir, func(path string, d fs.DirEntry, err error) error {
+	err := fs.WalkDir(src, ".", func(name string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return nil // Skip errors
 		}
 
 		// Get relative path for matching
-		relPath, err := filepath.Rel(pa.Dir, path)
-		if err != nil {
-			return nil
+		relPath := filepath.FromSlash(name)
+		if pruned != "" && !strings.HasPrefix(relPath, pruned+string(filepath.Separator)) {
+			pruned = ""
 		}
 
 		// Skip directories
 		if d.IsDir() {
 			fileCount += 10 // Rough estimate for file counting
+			if relPath == "." {
+				return nil
+			}
 
-			// Check exclude patterns for directories
-			if matcher != nil && matcher.Match(strings.Split(relPath, string(filepath.Separator)), d.IsDir()) {
+			// Check exclude patterns for directories. A directory whose whole content
+			// is excluded (e.g. "node_modules/**") is not walked, unless a negated
+			// pattern may include some of its files back.
+			parts := strings.Split(relPath, string(filepath.Separator))
+			excluding := excludingPattern(patterns, parts, true)
+			if excluding < 0 && !negated {
+				excluding = excludingPattern(patterns, append(parts, "\x00"), false)
+			}
+			if pruned != "" {
+				if d.Name() == ".git" || !forced.mayForceUnder(relPath, prunedExplicit || pa.defaultExclude(excluding)) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+
+			candidate := Candidate{Path: relPath + "/", Dir: true, Status: StatusExcluded}
+			if excluding >= 0 {
+				candidate.Reason, candidate.Pattern = ReasonExcludePattern, pa.ExcludePatterns[excluding]
+				candidate.Source = pa.excludeSource(excluding)
+			} else if rule := ignored.match(relPath, true); rule != nil {
+				// As in git, files of an ignored directory cannot be included back
+				candidate.Reason, candidate.Pattern, candidate.Source = ReasonGitignore, rule.text, rule.source
+			} else if rule := pmpIgnored.match(relPath, true); rule != nil {
+				candidate.Reason, candidate.Pattern, candidate.Source = ReasonExcludePattern, rule.text, rule.source
+			}
+			if candidate.Reason != "" {
+				// Only the files forced in are looked for under an excluded directory, and
+				// under the default excludes (node_modules/, vendor/...) only the paths
+				// that a pattern names
+				explicit := pa.defaultExclude(excluding)
+				candidate.Searched = d.Name() != ".git" && forced.mayForceUnder(relPath, explicit)
+				pa.addCandidate(candidate)
+				if candidate.Searched {
+					pruned, prunedExplicit = relPath, explicit
+					return nil
+				}
 				return filepath.SkipDir
 			}
+
+			ignored.enter(relPath)
+			pmpIgnored.enter(relPath)
 			return nil
 		}
 
 		// Update count
 		fileCount++
 
+		// Files forced in by .pmpinclude bypass the patterns and size limits
+		forcing := forced.forcing(relPath)
+		if pruned != "" && (forcing == nil || prunedExplicit && forcing.anyDepth()) {
+			return nil
+		}
+
+		candidate := Candidate{Path: relPath, Status: StatusExcluded}
+		info, err := d.Info()
+		if err != nil {
+			candidate.Reason, candidate.Error = ReasonReadError, err.Error()
+			pa.addCandidate(candidate)
+			return nil
+		}
+		candidate.Size = info.Size()
+		if forcing != nil {
+			candidate.Forced, candidate.Pattern, candidate.Source = true, forcing.text, forcing.source
+		}
+
 		// Skip files that don't match include patterns
-		if len(pa.IncludePatterns) > 0 {
-			isIncluded := false
+		if forcing == nil && len(pa.IncludePatterns) > 0 {
 			for _, pattern := range pa.IncludePatterns {
 				match, err := doublestar.Match(pattern, relPath)
 				if err == nil && match {
-					isIncluded = true
+					candidate.Pattern = pattern
 					break
 				}
 			}
-			if !isIncluded {
+			if candidate.Pattern == "" {
+				candidate.Reason = ReasonIncludePattern
+				pa.addCandidate(candidate)
 				return nil
 			}
 		}
 
 		// Skip files that match exclude patterns
-		if matcher != nil && matcher.Match(strings.Split(relPath, string(filepath.Separator)), false) {
-			return nil
+		if forcing == nil {
+			if excluding := excludingPattern(patterns, strings.Split(relPath, string(filepath.Separator)), false); excluding >= 0 {
+				candidate.Reason, candidate.Pattern = ReasonExcludePattern, pa.ExcludePatterns[excluding]
+				candidate.Source = pa.excludeSource(excluding)
+				pa.addCandidate(candidate)
+				return nil
+			}
+			if rule := ignored.match(relPath, false); rule != nil {
+				candidate.Reason, candidate.Pattern, candidate.Source = ReasonGitignore, rule.text, rule.source
+				pa.addCandidate(candidate)
+				return nil
+			}
+			if rule := pmpIgnored.match(relPath, false); rule != nil {
+				candidate.Reason, candidate.Pattern, candidate.Source = ReasonExcludePattern, rule.text, rule.source
+				pa.addCandidate(candidate)
+				return nil
+			}
 		}
 
 		// Check if file is binary
-		if binary.IsBinaryFile(path, pa.BinaryCache) {
+		detection := binary.DetectFS(src, name, src.Key(name, info), pa.BinaryCache)
+		candidate.Binary = &detection
+		if detection.Binary {
+			candidate.Reason = ReasonBinary
+			pa.addCandidate(candidate)
 			return nil
 		}
 
 		// Check file size
-		info, err := d.Info()
-		if err != nil {
+		if forcing == nil && pa.MinSize > 0 && info.Size() < pa.MinSize {
+			candidate.Reason = ReasonMinSize
+			pa.addCandidate(candidate)
 			return nil
 		}
 
-		if pa.MinSize > 0 && info.Size() < pa.MinSize {
-			return nil
-		}
-
-		if pa.MaxSize > 0 && info.Size() > pa.MaxSize {
+		if forcing == nil && pa.MaxSize > 0 && info.Size() > pa.MaxSize {
+			candidate.Reason = ReasonMaxSize
+			pa.addCandidate(candidate)
 			return nil
 		}
 
 		// Add to results
+		candidate.Status = StatusIncluded
+		pa.addCandidate(candidate)
 		result = append(result, relPath)
+		if forcing != nil {
+			pa.forced[relPath] = true
+		}
 		totalSize += info.Size()
 
 		return nil
@@ -253,157 +590,614 @@ func (pa *ProjectAnalyzer) collectFiles() ([]string, error) {
 	return result, err
 }
 
+// projectSource returns the source of the project files, its directory by default
+func (pa *ProjectAnalyzer) projectSource() source.Source {
+	if pa.Source == nil {
+		pa.Source = source.NewDir(pa.Dir)
+	}
+	return pa.Source
+}
+
+// excludingPattern returns the index of the exclude pattern that excludes a path,
+// or -1 if the path is not excluded. As in .gitignore files, the last matching
+// pattern wins and a negated pattern includes the path back.
+func excludingPattern(patterns []gitignore.Pattern, path []string, isDir bool) int {
+	for i := len(patterns) - 1; i >= 0; i-- {
+		switch patterns[i].Match(path, isDir) {
+		case gitignore.Exclude:
+			return i
+		case gitignore.Include:
+			return -1
+		}
+	}
+	return -1
+}
+
+// excludeSource returns where the i-th exclude pattern comes from, if known
+func (pa *ProjectAnalyzer) excludeSource(i int) string {
+	if i < len(pa.ExcludeSources) {
+		return pa.ExcludeSources[i]
+	}
+	return ""
+}
+
+// defaultExclude reports whether the i-th exclude pattern is one of the default excludes
+func (pa *ProjectAnalyzer) defaultExclude(i int) bool {
+	return i >= 0 && pa.excludeSource(i) == DefaultExcludesSource
+}
+
 // GenerateProjectStructure creates a string representation of the project structure
 func (pa *ProjectAnalyzer) GenerateProjectStructure() (string, error) {
-	// Build tree - use ProjectName if set, otherwise directory basename
-	projectName := pa.ProjectName
-	if projectName == "" {
-		projectName = filepath.Base(pa.Dir)
+	return utils.GenerateTreeOutput(pa.projectTree()), nil
+}
+
+// projectTree builds the directory tree of the collected files
+func (pa *ProjectAnalyzer) projectTree() *utils.Directory {
+	return utils.BuildTree(pa.Files, pa.projectName())
+}
+
+// projectName returns ProjectName if set, otherwise the name of the source
+func (pa *ProjectAnalyzer) projectName() string {
+	if pa.ProjectName != "" {
+		return pa.ProjectName
 	}
-	root := utils.BuildTree(pa.Files, projectName)
-	return utils.GenerateTreeOutput(root), nil
+	return pa.projectSource().Name()
 }
 
-// ProcessFiles processes the files and generates output in the specified format
+// ProcessFiles processes the files and generates output in the specified format,
+// with a manifest of the candidate files next to it
 func (pa *ProjectAnalyzer) ProcessFiles(outputDir string, format string) (StatsResult, error) {
-	startTime := time.Now()
-	stats := StatsResult{}
+	if !pa.buffered() {
+		var output *formatter.Formatter
+		stats, err := pa.streamFiles(outputDir, format, func(fmtr *formatter.Formatter, stats *StatsResult) (io.Writer, func() error, error) {
+			file, outputPath, err := fmtr.CreateOutputFile()
+			if err != nil {
+				return nil, nil, err
+			}
+			output = fmtr
+			stats.OutputPath = outputPath
+			return file, file.Close, nil
+		})
+		if err != nil {
+			return stats, err
+		}
+		stats.ReplacedFiles = output.ReplacedFiles()
+		return stats, pa.writeManifest(output, &stats)
+	}
+
+	fmtr, stats, err := pa.buildFormatter(outputDir, format)
+	if err != nil {
+		return stats, err
+	}
+
+	// Write the prompt to disk, in numbered parts when it is split
+	if fmtr.IsSplit() {
+		parts, err := fmtr.WriteParts()
+		if err != nil {
+			return stats, fmt.Errorf("failed to write output parts: %w", err)
+		}
+		stats.OutputParts = parts
+		stats.OutputPath = parts[0]
+	} else {
+		outputPath, err := fmtr.WriteToFile()
+		if err != nil {
+			return stats, fmt.Errorf("failed to write output file: %w", err)
+		}
+		stats.OutputPath = outputPath
+	}
+	stats.ReplacedFiles = fmtr.ReplacedFiles()
+	if err := pa.writeManifest(fmtr, &stats); err != nil {
+		return stats, err
+	}
+
+	stats.ProcessTime = time.Since(stats.startTime)
+	stats.FilesPerSec = float64(stats.FileCount) / stats.ProcessTime.Seconds()
+
+	return stats, nil
+}
+
+// ProcessFilesToStdout processes the files and writes the output in the specified format to stdout
+func (pa *ProjectAnalyzer) ProcessFilesToStdout(format string) (StatsResult, error) {
+	if !pa.buffered() {
+		return pa.streamFiles("", format, func(*formatter.Formatter, *StatsResult) (io.Writer, func() error, error) {
+			return os.Stdout, func() error { return nil }, nil
+		})
+	}
 
-	// Create formatter
+	fmtr, stats, err := pa.buildFormatter("", format)
+	if err != nil {
+		return stats, err
+	}
+
+	if err := fmtr.WriteToStdout(); err != nil {
+		return stats, err
+	}
+
+	stats.ProcessTime = time.Since(stats.startTime)
+	stats.FilesPerSec = float64(stats.FileCount) / stats.ProcessTime.Seconds()
+
+	return stats, nil
+}
+
+// buffered reports whether every file must be read before writing the output: the
+// token budget and the split into parts both depend on the whole prompt, and nothing
+// is written when secrets block the prompt
+func (pa *ProjectAnalyzer) buffered() bool {
+	return pa.MaxTokens > 0 || pa.SplitTokens > 0 || pa.OnSecret == secrets.Block
+}
+
+// streamFiles writes the output while the files are processed, so that only a few
+// files are held in memory whatever the size of the project. open returns the
+// destination and the function closing it once the output is written.
+func (pa *ProjectAnalyzer) streamFiles(
+	outputDir, format string,
+	open func(*formatter.Formatter, *StatsResult) (io.Writer, func() error, error),
+) (StatsResult, error) {
+	stats := StatsResult{startTime: time.Now()}
+
+	fmtr, err := pa.newFormatter(outputDir, format, &stats)
+	if err != nil {
+		return stats, err
+	}
+
+	w, closeOutput, err := open(fmtr, &stats)
+	if err != nil {
+		return stats, err
+	}
+
+	stream := fmtr.NewStreamWriter(w)
+	err = stream.WriteHeader()
+	if err == nil {
+		err = pa.processFiles(&stats, summarizer.NewSummarizer(), func(fileInfo formatter.FileInfo) error {
+			return stream.WriteFile(fileInfo)
+		})
+	}
+	if err == nil {
+		// Statistics and the redaction summary are only known once every file is processed and come last
+		fmtr.SetStatistics(len(pa.Files), pa.TotalSize, pa.TokenCount, pa.CharCount, time.Since(stats.startTime))
+		fmtr.SetRedactions(redactionSummary(stats.Redactions, stats.RedactedFiles))
+		err = stream.Close()
+	}
+	if closeErr := closeOutput(); err == nil && closeErr != nil {
+		err = closeErr
+	}
+	if err != nil {
+		return stats, fmt.Errorf("failed to write output: %w", err)
+	}
+
+	stats.FileCount = len(pa.Files)
+	pa.fillStats(&stats)
+	stats.ProcessTime = time.Since(stats.startTime)
+	stats.FilesPerSec = float64(stats.FileCount) / stats.ProcessTime.Seconds()
+
+	return stats, nil
+}
+
+// buildFormatter reads and processes every collected file and returns a formatter
+// populated with their content, the project structure and the statistics
+func (pa *ProjectAnalyzer) buildFormatter(outputDir string, format string) (*formatter.Formatter, StatsResult, error) {
+	stats := StatsResult{startTime: time.Now()}
+
+	fmtr, err := pa.newFormatter(outputDir, format, &stats)
+	if err != nil {
+		return nil, stats, err
+	}
+
+	var files []formatter.FileInfo
+	codeSummarizer := summarizer.NewSummarizer()
+	err = pa.processFiles(&stats, codeSummarizer, func(fileInfo formatter.FileInfo) error {
+		files = append(files, fileInfo)
+		return nil
+	})
+	if err != nil {
+		return nil, stats, err
+	}
+	// The redaction summary is only known once every file is scanned
+	fmtr.SetRedactions(redactionSummary(stats.Redactions, stats.RedactedFiles))
+
+	if pa.MaxTokens > 0 {
+		// Choose full, summarized and omitted files to fit the token budget
+		budget, err := pa.fitTokenBudget(fmtr, files, codeSummarizer, time.Since(stats.startTime))
+		if err != nil {
+			return nil, stats, err
+		}
+		pa.TotalSize = budget.totalSize
+		pa.TokenCount = budget.tokenCount
+		pa.CharCount = budget.charCount
+		stats.FileCount = budget.fileCount
+		stats.SummarizedCount = budget.summarizedCount
+		stats.PromptTokens = budget.promptTokens
+		stats.OmittedFiles = budget.omitted
+		for _, file := range budget.omitted {
+			pa.setStatus(file, StatusOmitted, ReasonTokenBudget, "")
+		}
+		for file, tokens := range budget.downgraded {
+			pa.setStatus(file, StatusSummarized, ReasonTokenBudget, "")
+			if record := pa.candidate(file); record != nil {
+				if record.Truncated != nil {
+					stats.TruncatedFiles--
+				}
+				record.Tokens, record.Truncated = tokens, nil
+			}
+		}
+	} else {
+		for _, fileInfo := range files {
+			fmtr.AddFile(fileInfo)
+		}
+		fmtr.SetStatistics(
+			len(pa.Files),
+			pa.TotalSize,
+			pa.TokenCount,
+			pa.CharCount,
+			time.Since(stats.startTime),
+		)
+		stats.FileCount = len(pa.Files)
+	}
+
+	fmtr.SetSplitTokens(pa.SplitTokens)
+	pa.fillStats(&stats)
+
+	return fmtr, stats, nil
+}
+
+// newFormatter creates the formatter with the output options, the project metadata
+// and the project structure, ready to receive the files
+func (pa *ProjectAnalyzer) newFormatter(outputDir, format string, stats *StatsResult) (*formatter.Formatter, error) {
 	fmtr := formatter.NewFormatter(format, outputDir, pa.Dir)
 
-	// Apply custom project name and file prefix if set (for GitHub repos)
+	// Apply custom file prefix if set (for archives and remote repos)
 	if pa.FilePrefix != "" {
 		fmtr.SetFilePrefix(pa.FilePrefix)
 	}
-	if pa.ProjectName != "" {
-		fmtr.SetProjectName(pa.ProjectName)
+	fmtr.SetProjectName(pa.projectName())
+	if pa.Template != "" {
+		if err := fmtr.SetTemplate(pa.Template); err != nil {
+			return nil, err
+		}
+	}
+	fmtr.SetHeaderContent(pa.Instructions)
+	fmtr.SetQuestion(pa.Question)
+	fmtr.SetLineNumbers(pa.LineNumbers)
+	fmtr.SetChunkOverlap(pa.ChunkOverlap)
+	if pa.Reproducible {
+		fmtr.SetReproducible(pa.SourceDate)
 	}
 
-	// Process files with worker pool
-	pool := worker.NewPool(pa.WorkerCount)
-	pool.Start()
+	// Detect technologies and key files
+	stats.Technologies = detectTechnologies(pa.Files)
+	stats.KeyFiles = identifyKeyFiles(pa.Files)
+	stats.Issues = identifyPotentialIssues(pa.Files)
+	stats.FileTypes = collectFileExtensions(pa.Files)
+
+	// Set metadata
+	fmtr.SetTechnologies(stats.Technologies)
+	fmtr.SetKeyFiles(stats.KeyFiles)
+	fmtr.SetIssues(stats.Issues)
+	fmtr.SetFileTypes(stats.FileTypes)
+	fmtr.SetRecentChanges(pa.recentChangesReport())
+
+	// Generate project structure
+	structure, err := pa.GenerateProjectStructure()
+	if err != nil {
+		return nil, fmt.Errorf("error generating project structure: %w", err)
+	}
+	fmtr.SetProjectStructure(structure)
+	fmtr.SetProjectTree(pa.projectTree())
 
-	// Channel for tracking completion
-	done := make(chan struct{})
+	pa.lastCommits = nil
+	if pa.fileMetadataFormat(format) {
+		pa.loadLastCommits()
+	}
 
-	// Ensure pool is properly stopped even if errors occur
-	defer func() {
-		// Make sure we don't leak goroutines
-		select {
-		case <-done:
-			// Already done
-		default:
-			pool.Stop()
-		}
-	}()
+	return fmtr, nil
+}
 
-	// Detect technologies and key files
-	technologies := detectTechnologies(pa.Files)
-	keyFiles := identifyKeyFiles(pa.Files)
-	issues := identifyPotentialIssues(pa.Files)
-	fileTypes := collectFileExtensions(pa.Files)
+// processFiles reads the collected files with the worker pool and passes each of
+// them to emit in collection order (changed files first). Results arriving ahead of
+// a slow file wait in a reorder buffer, and jobs are only dispatched while that
+// buffer has room, so that a bounded number of files is held in memory.
+func (pa *ProjectAnalyzer) processFiles(stats *StatsResult, codeSummarizer *summarizer.Summarizer, emit func(formatter.FileInfo) error) error {
+	workerCount := max(1, pa.WorkerCount)
+	pool := worker.NewPool(workerCount)
+	pool.Start()
+
+	// Each dispatched job holds a slot until its file is emitted
+	window := make(chan struct{}, workerCount*4)
+	quit := make(chan struct{})
 
 	// Send jobs
 	go func() {
-		defer close(done)
+		defer pool.Stop()
 		for i, file := range pa.Files {
+			select {
+			case window <- struct{}{}:
+			case <-quit:
+				return
+			}
 			select {
 			case pool.GetJobs() <- worker.Job{
 				Index:    i,
 				FilePath: file,
-				RootDir:  pa.Dir,
+				Source:   pa.projectSource(),
 			}:
 				// Job sent successfully
-			case <-done:
-				// Context cancelled, return early
+			case <-quit:
+				// Output failed, return early
 				return
 			}
 		}
-		pool.Stop()
 	}()
 
-	// Collect results
-	completed := 0
-	var failedFiles int
+	// Make sure we don't leak goroutines: stop dispatching and let the workers finish
+	defer func() {
+		close(quit)
+		for range pool.GetResults() {
+		}
+	}()
+
 	tokenEstimator := utils.NewTokenEstimator()
+	var secretScanner *secrets.Scanner
+	var blocked []SecretFinding
+	if pa.OnSecret != secrets.Allow {
+		secretScanner = secrets.NewScanner()
+	}
+	stripOptions := pa.Strip
+	// Numbered lines must match the source file
+	stripOptions.KeepLines = pa.LineNumbers
+	changeTypes := make(map[string]string, len(pa.RecentChanges))
+	for _, change := range pa.RecentChanges {
+		changeTypes[change.Path] = string(change.ChangeType)
+	}
 
-	// Process each file
+	// Emit the results in order of their index
+	pending := make(map[int]worker.Result)
+	next := 0
 	for result := range pool.GetResults() {
-		if result.Err != nil {
-			fmt.Fprintf(os.Stderr, "Warning: error processing file: %v\n", result.Err)
-			failedFiles++
-		} else if result.Content != "" {
-			// Add file to format
+		pending[result.Index] = result
+		for {
+			result, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			next++
+			<-window
+
 			filePath := pa.Files[result.Index]
-			absPath := filepath.Join(pa.Dir, filePath)
-			fileInfo, err := os.Stat(absPath)
-
-			if err == nil {
-				content, _ := os.ReadFile(absPath)
-				pa.CharCount += len(content)
-				tokens, _ := tokenEstimator.EstimateFileTokens(absPath, true)
-				pa.TokenCount += tokens
-				pa.TotalSize += fileInfo.Size()
-
-				fmtr.AddFile(formatter.FileInfo{
-					Path:     filePath,
-					Size:     fileInfo.Size(),
-					Content:  string(content),
-					Language: detectFileLanguage(filePath),
-				})
+			record := pa.candidate(filePath)
+			if record == nil {
+				record = &Candidate{}
+			}
+
+			if result.Err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: error processing file: %v\n", result.Err)
+				record.Status, record.Reason, record.Error = StatusExcluded, ReasonReadError, result.Err.Error()
+				continue
+			}
+
+			content := result.Content
+			size := int64(len(content))
+			sum := sha256.Sum256([]byte(content))
+			record.SHA256 = hex.EncodeToString(sum[:])
+			lineCount := strings.Count(content, "\n")
+			if content != "" && !strings.HasSuffix(content, "\n") {
+				lineCount++
+			}
+			encoding := utils.DetectEncoding([]byte(content))
+			modTime := result.ModTime
+			if pa.Reproducible {
+				modTime = time.Time{}
+			}
+
+			// Strip comments and blank lines before anything measures the content
+			if stripOptions.Enabled() {
+				stripped := strip.Strip(filePath, content, stripOptions)
+				if saved := tokenEstimator.EstimateTokens(content, true) - tokenEstimator.EstimateTokens(stripped, true); saved > 0 {
+					if stats.StrippedFiles == nil {
+						stats.StrippedFiles = make(map[string]int)
+					}
+					stats.StrippedFiles[filePath] = saved
+					stats.StrippedTokens += saved
+				}
+				content = stripped
+			}
+
+			// Redact secrets before the summary, which keeps constant values
+			if secretScanner != nil {
+				findings := secretScanner.Scan(filePath, content)
+				if len(findings) > 0 && pa.OnSecret == secrets.Block {
+					for _, finding := range findings {
+						blocked = append(blocked, SecretFinding{Path: filePath, Line: finding.Line, Type: finding.Type})
+					}
+				} else if len(findings) > 0 {
+					if stats.Redactions == nil {
+						stats.Redactions = make(map[string]int)
+					}
+					for _, finding := range findings {
+						stats.Redactions[finding.Type]++
+					}
+					stats.RedactedFiles++
+					record.Redactions = len(findings)
+					content = secrets.Replace(content, findings, pa.LineNumbers)
+				}
+			}
+
+			// Replace the content with its signatures when the file must be summarized
+			summarized := false
+			if pa.shouldSummarize(filePath) {
+				content, summarized = pa.summarizeContent(codeSummarizer, filePath, content)
+			}
+			if summarized {
+				record.Status, record.Reason, record.Pattern = StatusSummarized, ReasonSummaryOnly, ""
+				if !pa.SummaryOnly {
+					record.Reason, record.Pattern = ReasonSummaryPattern, pa.summaryPattern(filePath)
+				}
+			}
+
+			// Cut files over the per-file limits, keeping their beginning and end
+			var truncation *truncate.Truncation
+			if pa.Truncate.Enabled() && !summarized {
+				content, truncation = truncate.Truncate(filePath, content, pa.Truncate)
+			}
+			if truncation != nil {
+				record.Truncated = truncation
+				stats.TruncatedFiles++
+			}
+
+			tokens := pa.contentTokens(tokenEstimator, content, summarized)
+			record.Tokens = tokens
+			pa.CharCount += len(content)
+			pa.TokenCount += tokens
+			pa.TotalSize += size
+			if summarized {
+				stats.SummarizedCount++
+			}
+
+			err := emit(formatter.FileInfo{
+				Path:       filePath,
+				Size:       size,
+				Content:    content,
+				Language:   detectFileLanguage(filePath),
+				Summarized: summarized,
+				ChangeType: changeTypes[filePath],
+				Truncated:  truncation,
+				LineCount:  lineCount,
+				Tokens:     tokens,
+				SHA256:     record.SHA256,
+				ModTime:    modTime,
+				Encoding:   encoding,
+				LastCommit: pa.lastCommits[filePath],
+			})
+			if err != nil {
+				return err
 			}
 		}
+	}
 
-		completed++
+	if len(blocked) > 0 {
+		return &SecretsError{Findings: blocked}
+	}
+	if summary := redactionSummary(stats.Redactions, stats.RedactedFiles); summary != "" {
+		stats.Issues = append(stats.Issues, summary)
 	}
+	return nil
+}
 
-	// Set statistics and metadata
-	fmtr.SetStatistics(
-		len(pa.Files),
-		pa.TotalSize,
-		pa.TokenCount,
-		pa.CharCount,
-		time.Since(startTime),
-	)
-	fmtr.SetTechnologies(technologies)
-	fmtr.SetKeyFiles(keyFiles)
-	fmtr.SetIssues(issues)
-	fmtr.SetFileTypes(fileTypes)
+// SecretFinding is a secret found in a file
+type SecretFinding struct {
+	Path string
+	Line int
+	Type string
+}
 
-	// Generate project structure
-	structure, err := pa.GenerateProjectStructure()
-	if err != nil {
-		return stats, fmt.Errorf("error generating project structure: %w", err)
+// SecretsError is returned instead of writing the prompt when secrets are found and
+// OnSecret is secrets.Block
+type SecretsError struct {
+	Findings []SecretFinding
+}
+
+// Error lists the secrets found, without their values
+func (e *SecretsError) Error() string {
+	const maxListed = 20
+
+	files := make(map[string]bool)
+	for _, finding := range e.Findings {
+		files[finding.Path] = true
 	}
-	fmtr.SetProjectStructure(structure)
 
-	// We do not write to file when --buffer is used, it will be handled in main.go
-	// The output path will be still generated for tracking purposes
-	timestamp := time.Now().Format("20060102_150405")
-	filename := fmt.Sprintf("prompt_%s.%s", timestamp, format)
-	outputPath := filepath.Join(outputDir, filename)
+	var b strings.Builder
+	fmt.Fprintf(&b, "found %d secrets in %d files, the prompt was not written:", len(e.Findings), len(files))
+	for i, finding := range e.Findings {
+		if i == maxListed {
+			fmt.Fprintf(&b, "\n  ... and %d more", len(e.Findings)-maxListed)
+			break
+		}
+		fmt.Fprintf(&b, "\n  %s:%d: %s", filepath.ToSlash(finding.Path), finding.Line, finding.Type)
+	}
+	return b.String()
+}
 
-	// Write the prompt file to disk
-	_, err = fmtr.WriteToFile()
-	if err != nil {
-		return stats, fmt.Errorf("failed to write output file: %w", err)
+// redactionSummary summarizes the secrets replaced in file contents ("" when none was)
+func redactionSummary(redactions map[string]int, files int) string {
+	if len(redactions) == 0 {
+		return ""
+	}
+	types := make([]string, 0, len(redactions))
+	total := 0
+	for secretType, count := range redactions {
+		types = append(types, secretType)
+		total += count
 	}
+	sort.Strings(types)
 
-	// Populate stats result
-	stats.FileCount = len(pa.Files)
+	counts := make([]string, len(types))
+	for i, secretType := range types {
+		counts[i] = fmt.Sprintf("%s: %d", secretType, redactions[secretType])
+	}
+	return fmt.Sprintf("Redacted %s in %s (%s)", countNoun(total, "secret"), countNoun(files, "file"), strings.Join(counts, ", "))
+}
+
+// countNoun returns a count followed by a noun, in the plural unless the count is 1
+func countNoun(n int, noun string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, noun)
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+// fillStats copies the analysis totals to the statistics result
+func (pa *ProjectAnalyzer) fillStats(stats *StatsResult) {
 	stats.TotalSize = pa.TotalSize
 	stats.TokenCount = pa.TokenCount
 	stats.CharCount = pa.CharCount
-	stats.ProcessTime = time.Since(startTime)
-	stats.FilesPerSec = float64(len(pa.Files)) / stats.ProcessTime.Seconds()
-	stats.OutputPath = outputPath
-	stats.Technologies = technologies
-	stats.KeyFiles = keyFiles
-	stats.Issues = issues
-	stats.FileTypes = fileTypes
+}
 
-	return stats, nil
+// recentChangesReport converts the recent changes for the formatter
+func (pa *ProjectAnalyzer) recentChangesReport() []formatter.ChangedFile {
+	if len(pa.RecentChanges) == 0 {
+		return nil
+	}
+
+	changes := make([]formatter.ChangedFile, 0, len(pa.RecentChanges))
+	for _, change := range pa.RecentChanges {
+		changes = append(changes, formatter.ChangedFile{
+			Path:       filepath.ToSlash(change.Path),
+			ChangeType: string(change.ChangeType),
+			Staged:     change.IsStaged,
+			Committed:  change.IsCommitted,
+		})
+	}
+	return changes
+}
+
+// shouldSummarize reports whether a file must be replaced by its summary
+func (pa *ProjectAnalyzer) shouldSummarize(relPath string) bool {
+	return pa.SummaryOnly || pa.summaryPattern(relPath) != ""
+}
+
+// summaryPattern returns the summary pattern matching a file, or "" if none does
+func (pa *ProjectAnalyzer) summaryPattern(relPath string) string {
+	slashPath := filepath.ToSlash(relPath)
+	for _, pattern := range pa.SummaryPatterns {
+		match, err := doublestar.Match(pattern, slashPath)
+		if err == nil && match {
+			return pattern
+		}
+	}
+
+	return ""
+}
+
+// summarizeContent returns the formatted summary of a file. The original content
+// is returned unchanged if the file cannot be summarized (e.g. a Go syntax error).
+func (pa *ProjectAnalyzer) summarizeContent(s *summarizer.Summarizer, relPath, content string) (string, bool) {
+	summary, err := s.SummarizeFile(filepath.ToSlash(relPath), content)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: unable to summarize %s, keeping full content: %v\n", relPath, err)
+		return content, false
+	}
+
+	return summarizer.FormatSummary(summary), true
 }
 
 // collectFileExtensions collects file extensions and their counts
@@ -472,19 +1266,24 @@ func detectTechnologies(files []string) []string {
 	for tech := range technologies {
 		result = append(result, tech)
 	}
+	utils.SortStrings(result)
 
 	return result
 }
 
+// keyFileNames are the names of the files considered important in a project
+var keyFileNames = map[string]bool{
+	"main.go": true, "app.js": true, "index.js": true, "package.json": true,
+	"go.mod": true, "requirements.txt": true, "setup.py": true, "Makefile": true,
+	"Dockerfile": true, "docker-compose.yml": true, "README.md": true,
+}
+
 // identifyKeyFiles identifies important files in the project
 func identifyKeyFiles(files []string) []string {
 	keyFiles := make([]string, 0)
 
 	for _, file := range files {
-		basename := filepath.Base(file)
-		switch basename {
-		case "main.go", "app.js", "index.js", "package.json", "go.mod", "requirements.txt",
-			"setup.py", "Makefile", "Dockerfile", "docker-compose.yml", "README.md":
+		if keyFileNames[filepath.Base(file)] {
 			keyFiles = append(keyFiles, file)
 		}
 	}
@@ -513,6 +1312,15 @@ func identifyPotentialIssues(files []string) []string {
 	return issues
 }
 
+// contentTokens estimates the tokens of a file content as written in the prompt,
+// line number prefixes included
+func (pa *ProjectAnalyzer) contentTokens(estimator *utils.TokenEstimator, content string, summarized bool) int {
+	if pa.LineNumbers && !summarized {
+		content = formatter.NumberLines(content, 1)
+	}
+	return estimator.EstimateTokens(content, true)
+}
+
 // detectFileLanguage detects the programming language of a file
 func detectFileLanguage(filename string) string {
 	ext := filepath.Ext(filename)
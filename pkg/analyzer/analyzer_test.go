@@ -0,0 +1,261 @@
+package analyzer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/benoitpetit/prompt-my-project/pkg/formatter"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+func TestFocusChanges(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+	repo, err := git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	worktree, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	write := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	commit := func(files map[string]string) {
+		for name, content := range files {
+			write(name, content)
+			if _, err := worktree.Add(name); err != nil {
+				t.Fatal(err)
+			}
+		}
+		signature := &object.Signature{Name: "A", Email: "a@example.com", When: time.Unix(1700000000, 0)}
+		if _, err := worktree.Commit("commit", &git.CommitOptions{Author: signature, Committer: signature}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	commit(map[string]string{
+		"a.go": "package a\n",
+		"b.go": "package a\n",
+		"c.go": "package a\n",
+		"d.go": "package a\n",
+		"e.go": "package a\n",
+	})
+	commit(map[string]string{"c.go": "package a // committed\n"})
+	write("e.go", "package a // unstaged\n")
+
+	pa := New(dir, nil, []string{".git/**"}, 0, 1<<20, 1, 0, 1)
+	pa.FocusChanges = true
+	pa.RecentCommits = 1
+	if err := pa.CollectFiles(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Changed files come first and are kept even though they exceed MaxFiles
+	if want := []string{"c.go", "e.go"}; !reflect.DeepEqual(pa.Files, want) {
+		t.Errorf("files = %v, want %v", pa.Files, want)
+	}
+
+	states := make(map[string]string)
+	for _, change := range pa.recentChangesReport() {
+		switch {
+		case change.Committed:
+			states[change.Path] = "committed"
+		case change.Staged:
+			states[change.Path] = "staged"
+		default:
+			states[change.Path] = "unstaged"
+		}
+	}
+	if want := map[string]string{"c.go": "committed", "e.go": "unstaged"}; !reflect.DeepEqual(states, want) {
+		t.Errorf("changes = %v, want %v", states, want)
+	}
+}
+
+func TestStreamedOutput(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+	var want []string
+	for i := 0; i < 40; i++ {
+		// Sizes vary so that the workers finish out of order
+		name := fmt.Sprintf("f%02d.go", i)
+		content := strings.Repeat(fmt.Sprintf("var v%d = \"<a & b>\" // %d\n", i, i), 1+(i*37)%200)
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, name)
+	}
+
+	for _, format := range []string{"json", "xml", "jsonl"} {
+		var first []byte
+		for _, workers := range []int{1, 4, 16} {
+			pa := New(dir, nil, nil, 0, 1<<20, 0, 0, workers)
+			pa.Reproducible = true
+			if err := pa.CollectFiles(); err != nil {
+				t.Fatal(err)
+			}
+			stats, err := pa.ProcessFiles(t.TempDir(), format)
+			if err != nil {
+				t.Fatalf("%s/%d: %v", format, workers, err)
+			}
+			output, err := os.ReadFile(stats.OutputPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			paths, err := streamedPaths(format, output)
+			if err != nil {
+				t.Errorf("%s/%d: invalid output: %v", format, workers, err)
+			} else if !reflect.DeepEqual(paths, want) {
+				t.Errorf("%s/%d: files %v", format, workers, paths)
+			}
+
+			// The output does not depend on the number of workers
+			if first == nil {
+				first = output
+			} else if !bytes.Equal(output, first) {
+				t.Errorf("%s/%d: output differs from a single worker", format, workers)
+			}
+		}
+	}
+}
+
+// streamedPaths decodes a streamed output and returns the paths of its files
+func streamedPaths(format string, output []byte) ([]string, error) {
+	var report formatter.ProjectReport
+	switch format {
+	case "json":
+		if err := json.Unmarshal(output, &report); err != nil {
+			return nil, err
+		}
+	case "xml":
+		if err := xml.Unmarshal(output, &report); err != nil {
+			return nil, err
+		}
+	case "jsonl":
+		var paths []string
+		scanner := bufio.NewScanner(bytes.NewReader(output))
+		scanner.Buffer(nil, 1<<20)
+		for scanner.Scan() {
+			var record struct {
+				Type string `json:"type"`
+				Path string `json:"path"`
+			}
+			if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+				return nil, err
+			}
+			if record.Type == "file" {
+				paths = append(paths, record.Path)
+			}
+		}
+		return paths, scanner.Err()
+	}
+
+	var paths []string
+	for _, file := range report.Files {
+		paths = append(paths, file.Path)
+	}
+	return paths, nil
+}
+
+func TestRedactionSummary(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+	content := "package config\n\nconst password = \"Zq8vN3xK7pL2mR9w\"\n"
+	if err := os.WriteFile(filepath.Join(dir, "config.go"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The streamed output and the buffered one (token budget) report the same summary
+	var summaries []string
+	for _, maxTokens := range []int{0, 100000} {
+		pa := New(dir, nil, nil, 0, 1<<20, 0, 0, 1)
+		pa.MaxTokens = maxTokens
+		if err := pa.CollectFiles(); err != nil {
+			t.Fatal(err)
+		}
+		stats, err := pa.ProcessFiles(t.TempDir(), "json")
+		if err != nil {
+			t.Fatal(err)
+		}
+		output, err := os.ReadFile(stats.OutputPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var report formatter.ProjectReport
+		if err := json.Unmarshal(output, &report); err != nil {
+			t.Fatal(err)
+		}
+		summaries = append(summaries, report.Statistics.Redactions)
+		if len(stats.Issues) == 0 || stats.Issues[len(stats.Issues)-1] != report.Statistics.Redactions {
+			t.Errorf("%d: issues %q", maxTokens, stats.Issues)
+		}
+	}
+	if summaries[0] != "Redacted 1 secret in 1 file (password: 1)" || summaries[1] != summaries[0] {
+		t.Errorf("redactions %q", summaries)
+	}
+
+	// The text prompt ends with it
+	pa := New(dir, nil, nil, 0, 1<<20, 0, 0, 1)
+	if err := pa.CollectFiles(); err != nil {
+		t.Fatal(err)
+	}
+	stats, err := pa.ProcessFiles(t.TempDir(), "txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, err := os.ReadFile(stats.OutputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(output), "REDACTIONS:\n-----------------------------------------------------\n\n"+summaries[0]+"\n") {
+		t.Errorf("text prompt without the redactions:\n%s", output)
+	}
+}
+
+func TestReproducibleReplaced(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The name of a reproducible output does not change: the second run replaces it,
+	// whether it is streamed or buffered (token budget)
+	for _, maxTokens := range []int{0, 100000} {
+		outputDir := t.TempDir()
+		var replaced [][]string
+		for run := 0; run < 2; run++ {
+			pa := New(dir, nil, nil, 0, 1<<20, 0, 0, 1)
+			pa.Reproducible = true
+			pa.MaxTokens = maxTokens
+			if err := pa.CollectFiles(); err != nil {
+				t.Fatal(err)
+			}
+			stats, err := pa.ProcessFiles(outputDir, "txt")
+			if err != nil {
+				t.Fatal(err)
+			}
+			replaced = append(replaced, stats.ReplacedFiles)
+			if run == 1 && !reflect.DeepEqual(stats.ReplacedFiles, []string{stats.OutputPath}) {
+				t.Errorf("%d: replaced %v, want %s", maxTokens, stats.ReplacedFiles, stats.OutputPath)
+			}
+		}
+		if len(replaced[0]) != 0 {
+			t.Errorf("%d: replaced %v on the first run", maxTokens, replaced[0])
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package analyzer
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/benoitpetit/prompt-my-project/pkg/formatter"
+	"github.com/benoitpetit/prompt-my-project/pkg/summarizer"
+	"github.com/benoitpetit/prompt-my-project/pkg/utils"
+)
+
+// inclusionMode tells how a file appears in a token-limited prompt
+type inclusionMode int
+
+const (
+	includeFull inclusionMode = iota
+	includeSummary
+	includeOmitted
+)
+
+// budgetFile is a candidate file for token budget packing
+type budgetFile struct {
+	info          formatter.FileInfo
+	tokens        int
+	summary       string // Empty when the file has no summary shorter than its content
+	summaryTokens int
+	summarized    bool // Summary already computed
+	priority      int
+	mode          inclusionMode
+}
+
+// budgetResult describes the files retained by the token budget
+type budgetResult struct {
+	fileCount       int
+	summarizedCount int
+	totalSize       int64
+	tokenCount      int
+	charCount       int
+	promptTokens    int
+	omitted         []string
+	downgraded      map[string]int // Files replaced by their summary, with its tokens
+}
+
+// fitTokenBudget chooses, by priority, which files are inlined in full, which are
+// downgraded to summaries and which are only listed as omitted, so that the prompt
+// rendered by fmtr (header, structure and statistics included) fits pa.MaxTokens.
+// The formatter is left populated with the retained files.
+func (pa *ProjectAnalyzer) fitTokenBudget(fmtr *formatter.Formatter, files []formatter.FileInfo, s *summarizer.Summarizer, duration time.Duration) (budgetResult, error) {
+	estimator := utils.NewTokenEstimator()
+
+	changed := make(map[string]bool, len(pa.RecentChanges))
+	for _, change := range pa.RecentChanges {
+		changed[change.Path] = true
+	}
+
+	candidates := make([]*budgetFile, len(files))
+	for i, info := range files {
+		candidates[i] = &budgetFile{
+			info:     info,
+			tokens:   pa.contentTokens(estimator, info.Content, info.Summarized),
+			priority: pa.filePriority(info.Path, changed),
+		}
+	}
+
+	// Summaries are only computed for the files that do not fit in full
+	hasSummary := func(candidate *budgetFile) bool {
+		if !candidate.summarized {
+			candidate.summarized = true
+			info := candidate.info
+			if !info.Summarized && summarizer.IsSupported(info.Path) {
+				if summary, ok := pa.summarizeContent(s, info.Path, info.Content); ok {
+					if tokens := pa.contentTokens(estimator, summary, true); tokens < candidate.tokens {
+						candidate.summary = summary
+						candidate.summaryTokens = tokens
+					}
+				}
+			}
+		}
+		return candidate.summary != ""
+	}
+
+	// Highest priority first; the order of the output itself is not changed
+	byPriority := append([]*budgetFile(nil), candidates...)
+	sort.SliceStable(byPriority, func(i, j int) bool {
+		if changed[byPriority[i].info.Path] != changed[byPriority[j].info.Path] {
+			return changed[byPriority[i].info.Path]
+		}
+		return byPriority[i].priority > byPriority[j].priority
+	})
+
+	measure := func() (budgetResult, error) {
+		result := pa.applyBudgetPlan(fmtr, candidates, duration)
+		content, err := fmtr.GetFormattedContent()
+		if err != nil {
+			return result, err
+		}
+		result.promptTokens = estimator.EstimateTokens(content, true)
+		return result, nil
+	}
+
+	// Everything in full may already fit
+	result, err := measure()
+	if err != nil || result.promptTokens <= pa.MaxTokens {
+		return result, err
+	}
+	allTokens := result.promptTokens
+
+	// Overhead of the header, the structure and the list of omitted files
+	for _, candidate := range candidates {
+		candidate.mode = includeOmitted
+	}
+	result, err = measure()
+	if err != nil {
+		return result, err
+	}
+	baseTokens := result.promptTokens
+	if baseTokens > pa.MaxTokens {
+		return result, fmt.Errorf("token budget too small: the prompt header and project structure alone need %d tokens (budget: %d)", baseTokens, pa.MaxTokens)
+	}
+
+	// Scale raw content estimates to their rendered cost (escaping, banners...)
+	rawTokens := 0
+	for _, candidate := range candidates {
+		rawTokens += candidate.tokens
+	}
+	scale := 1.0
+	if rawTokens > 0 {
+		scale = float64(allTokens-baseTokens) / float64(rawTokens)
+	}
+	cost := func(tokens int) int {
+		return int(float64(tokens)*scale) + 1
+	}
+
+	// Greedy packing by priority
+	remaining := pa.MaxTokens - baseTokens
+	for _, candidate := range byPriority {
+		switch {
+		case cost(candidate.tokens) <= remaining:
+			candidate.mode = includeFull
+			remaining -= cost(candidate.tokens)
+		case hasSummary(candidate) && cost(candidate.summaryTokens) <= remaining:
+			candidate.mode = includeSummary
+			remaining -= cost(candidate.summaryTokens)
+		}
+	}
+
+	// Check the rendered prompt and demote the lowest priority files until it fits
+	for {
+		result, err = measure()
+		if err != nil || result.promptTokens <= pa.MaxTokens {
+			return result, err
+		}
+
+		excess := result.promptTokens - pa.MaxTokens
+		for i := len(byPriority) - 1; i >= 0 && excess > 0; i-- {
+			candidate := byPriority[i]
+			switch {
+			case candidate.mode == includeFull && hasSummary(candidate):
+				candidate.mode = includeSummary
+				excess -= cost(candidate.tokens - candidate.summaryTokens)
+			case candidate.mode == includeSummary:
+				candidate.mode = includeOmitted
+				excess -= cost(candidate.summaryTokens)
+			case candidate.mode == includeFull:
+				candidate.mode = includeOmitted
+				excess -= cost(candidate.tokens)
+			}
+		}
+	}
+}
+
+// applyBudgetPlan fills the formatter with the candidates according to their mode
+func (pa *ProjectAnalyzer) applyBudgetPlan(fmtr *formatter.Formatter, candidates []*budgetFile, duration time.Duration) budgetResult {
+	var result budgetResult
+
+	fmtr.ClearFiles()
+	for _, candidate := range candidates {
+		info := candidate.info
+		tokens := candidate.tokens
+
+		switch candidate.mode {
+		case includeOmitted:
+			result.omitted = append(result.omitted, info.Path)
+			continue
+		case includeSummary:
+			info.Content = candidate.summary
+			info.Summarized = true
+			info.Truncated = nil
+			tokens = candidate.summaryTokens
+			info.Tokens = tokens
+			if result.downgraded == nil {
+				result.downgraded = make(map[string]int)
+			}
+			result.downgraded[info.Path] = tokens
+		}
+
+		if info.Summarized {
+			result.summarizedCount++
+		}
+		result.fileCount++
+		result.totalSize += info.Size
+		result.tokenCount += tokens
+		result.charCount += len(info.Content)
+		fmtr.AddFile(info)
+	}
+
+	fmtr.SetOmittedFiles(result.omitted)
+	fmtr.SetStatistics(result.fileCount, result.totalSize, result.tokenCount, result.charCount, duration)
+
+	return result
+}
@@ -0,0 +1,148 @@
+package analyzer
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/benoitpetit/prompt-my-project/pkg/formatter"
+	gitchanges "github.com/benoitpetit/prompt-my-project/pkg/git"
+	"github.com/benoitpetit/prompt-my-project/pkg/summarizer"
+	"github.com/benoitpetit/prompt-my-project/pkg/utils"
+)
+
+func TestFitTokenBudget(t *testing.T) {
+	// From the highest to the lowest priority: changed file, entry point, then by depth
+	paths := []string{"pkg/changed.go", "main.go", "a.go", "pkg/b.go", "pkg/sub/c.go"}
+	files := make([]formatter.FileInfo, len(paths))
+	for i, path := range paths {
+		content := budgetGoFile(10)
+		files[i] = formatter.FileInfo{Path: path, Size: int64(len(content)), Content: content}
+	}
+
+	const full, summary, omitted = "full", "summary", "omitted"
+	tests := []struct {
+		maxTokens int
+		modes     []string
+	}{
+		{100000, []string{full, full, full, full, full}},
+		{3000, []string{full, summary, summary, omitted, omitted}},
+		{1500, []string{summary, summary, summary, omitted, omitted}},
+		{1000, []string{summary, summary, omitted, omitted, omitted}},
+		{500, []string{summary, omitted, omitted, omitted, omitted}},
+		{300, []string{omitted, omitted, omitted, omitted, omitted}},
+		{100, nil}, // Smaller than the header and the project structure
+	}
+	for _, tt := range tests {
+		pa := &ProjectAnalyzer{
+			MaxTokens:     tt.maxTokens,
+			RecentChanges: []gitchanges.FileChange{{Path: "pkg/changed.go", ChangeType: gitchanges.ChangeTypeModified}},
+		}
+		fmtr := formatter.NewFormatter("txt", "", "project")
+		fmtr.SetReproducible(time.Unix(0, 0)) // The host name would change the header size
+		result, err := pa.fitTokenBudget(fmtr, files, summarizer.NewSummarizer(), 0)
+		if tt.modes == nil {
+			if err == nil {
+				t.Errorf("%d: no error", tt.maxTokens)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%d: %v", tt.maxTokens, err)
+			continue
+		}
+
+		content, err := fmtr.GetFormattedContent()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tokens := utils.NewTokenEstimator().EstimateTokens(content, true); tokens > tt.maxTokens || tokens != result.promptTokens {
+			t.Errorf("%d: prompt of %d tokens, reported %d", tt.maxTokens, tokens, result.promptTokens)
+		}
+
+		modes := make([]string, len(paths))
+		for i, path := range paths {
+			modes[i] = full
+			if _, ok := result.downgraded[path]; ok {
+				modes[i] = summary
+			}
+		}
+		for _, path := range result.omitted {
+			for i := range paths {
+				if paths[i] == path {
+					modes[i] = omitted
+				}
+			}
+		}
+		if !reflect.DeepEqual(modes, tt.modes) {
+			t.Errorf("%d: modes %v, want %v", tt.maxTokens, modes, tt.modes)
+		}
+		if result.fileCount+len(result.omitted) != len(paths) || result.summarizedCount != len(result.downgraded) {
+			t.Errorf("%d: %d files, %d summarized, %d omitted", tt.maxTokens, result.fileCount, result.summarizedCount, len(result.omitted))
+		}
+	}
+}
+
+func TestFitTokenBudgetShortPython(t *testing.T) {
+	// Shorter than the lines the summarizer looks for a docstring in
+	python := "def main():\n    print(\"hello\")\n"
+	files := []formatter.FileInfo{{Path: "tool.py", Size: int64(len(python)), Content: python}}
+	for _, path := range []string{"a.go", "b.go"} {
+		content := budgetGoFile(10)
+		files = append(files, formatter.FileInfo{Path: path, Size: int64(len(content)), Content: content})
+	}
+
+	for _, maxTokens := range []int{100000, 1500} {
+		pa := &ProjectAnalyzer{MaxTokens: maxTokens}
+		fmtr := formatter.NewFormatter("txt", "", "project")
+		fmtr.SetReproducible(time.Unix(0, 0))
+		result, err := pa.fitTokenBudget(fmtr, files, summarizer.NewSummarizer(), 0)
+		if err != nil {
+			t.Errorf("%d: %v", maxTokens, err)
+			continue
+		}
+		if result.fileCount+len(result.omitted) != len(files) {
+			t.Errorf("%d: %d files, %d omitted", maxTokens, result.fileCount, len(result.omitted))
+		}
+		if fits := maxTokens == 100000; fits != (len(result.downgraded) == 0 && len(result.omitted) == 0) {
+			t.Errorf("%d: downgraded %v, omitted %v", maxTokens, result.downgraded, result.omitted)
+		}
+	}
+}
+
+func TestApplyBudgetPlan(t *testing.T) {
+	pa := &ProjectAnalyzer{}
+	candidates := []*budgetFile{
+		{info: formatter.FileInfo{Path: "a.go", Size: 100, Content: "full a"}, tokens: 30, mode: includeFull},
+		{info: formatter.FileInfo{Path: "b.go", Size: 200, Content: "full b"}, tokens: 50, summary: "sum", summaryTokens: 5, mode: includeSummary},
+		{info: formatter.FileInfo{Path: "c.go", Size: 300, Content: "full c"}, tokens: 70, mode: includeOmitted},
+		{info: formatter.FileInfo{Path: "d.go", Size: 400, Content: "full d"}, tokens: 90, summary: "sum", summaryTokens: 9, mode: includeOmitted},
+	}
+	result := pa.applyBudgetPlan(formatter.NewFormatter("txt", "", "project"), candidates, 0)
+
+	if result.fileCount != 2 || result.summarizedCount != 1 || result.totalSize != 300 || result.tokenCount != 35 || result.charCount != len("full a")+len("sum") {
+		t.Errorf("result %+v", result)
+	}
+	if !reflect.DeepEqual(result.omitted, []string{"c.go", "d.go"}) {
+		t.Errorf("omitted %v", result.omitted)
+	}
+	if !reflect.DeepEqual(result.downgraded, map[string]int{"b.go": 5}) {
+		t.Errorf("downgraded %v", result.downgraded)
+	}
+}
+
+// budgetGoFile returns a Go file of n functions, whose summary is much shorter
+func budgetGoFile(n int) string {
+	var sb strings.Builder
+	sb.WriteString("package p\n")
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&sb, "\nfunc F%d(x int) int {\n", i)
+		for j := 0; j < 10; j++ {
+			fmt.Fprintf(&sb, "\tif x > %d {\n\t\tx = x*%d + %d\n\t}\n", j, i, j)
+		}
+		sb.WriteString("\treturn x\n}\n")
+	}
+	return sb.String()
+}
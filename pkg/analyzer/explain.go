@@ -0,0 +1,92 @@
+package analyzer
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/benoitpetit/prompt-my-project/pkg/utils"
+	"github.com/dustin/go-humanize"
+)
+
+// DryRun processes the collected files like ProcessFiles, without writing anything,
+// so that the candidates get the status and the tokens they would have in the
+// prompt. PromptTokens is set to the estimated size of the whole rendered prompt.
+func (pa *ProjectAnalyzer) DryRun(format string) (StatsResult, error) {
+	fmtr, stats, err := pa.buildFormatter("", format)
+	if err != nil {
+		return stats, err
+	}
+
+	if stats.PromptTokens == 0 {
+		content, err := fmtr.GetFormattedContent()
+		if err != nil {
+			return stats, err
+		}
+		stats.PromptTokens = utils.NewTokenEstimator().EstimateTokens(content, true)
+	}
+	return stats, nil
+}
+
+// Explain returns the candidate recording what became of a path relative to the
+// project directory. A file that was not walked is explained by the excluded
+// directory holding it. Explain returns nil for a path that was never seen.
+func (pa *ProjectAnalyzer) Explain(relPath string) *Candidate {
+	relPath = filepath.ToSlash(filepath.Clean(relPath))
+	if c := pa.candidate(relPath); c != nil {
+		return c
+	}
+	for dir := relPath; dir != "." && dir != "/"; dir = filepath.ToSlash(filepath.Dir(dir)) {
+		if c := pa.candidate(dir + "/"); c != nil {
+			return c
+		}
+	}
+	return nil
+}
+
+// Rule describes the rule that decided what became of a candidate
+func (pa *ProjectAnalyzer) Rule(c Candidate) string {
+	switch c.Reason {
+	case ReasonExcludePattern:
+		return withSource(fmt.Sprintf("exclude pattern %q", c.Pattern), c.Source)
+	case ReasonGitignore:
+		return withSource(fmt.Sprintf("ignored by %q", c.Pattern), c.Source)
+	case ReasonIncludePattern:
+		return "matches no include pattern"
+	case ReasonBinary:
+		return c.Binary.String()
+	case ReasonMinSize:
+		return fmt.Sprintf("smaller than --min-size (%s < %s)", humanize.Bytes(uint64(c.Size)), humanize.Bytes(uint64(pa.MinSize)))
+	case ReasonMaxSize:
+		return fmt.Sprintf("larger than --max-size (%s > %s)", humanize.Bytes(uint64(c.Size)), humanize.Bytes(uint64(pa.MaxSize)))
+	case ReasonMaxFiles:
+		return fmt.Sprintf("beyond --max-files (%d), lower priority files are dropped first", pa.MaxFiles)
+	case ReasonMaxTotalSize:
+		return fmt.Sprintf("beyond --max-total-size (%s), lower priority files are dropped first", humanize.Bytes(uint64(pa.MaxTotalSize)))
+	case ReasonReadError:
+		return "unreadable: " + c.Error
+	case ReasonTokenBudget:
+		if c.Status == StatusOmitted {
+			return "left out to fit --max-tokens"
+		}
+		return "summarized to fit --max-tokens"
+	case ReasonSummaryOnly:
+		return "--summary-only"
+	case ReasonSummaryPattern:
+		return fmt.Sprintf("summary pattern %q", c.Pattern)
+	}
+	if c.Forced {
+		return withSource(fmt.Sprintf("force-included by %q", c.Pattern), c.Source)
+	}
+	if c.Pattern != "" {
+		return fmt.Sprintf("include pattern %q", c.Pattern)
+	}
+	return "matches no exclude pattern"
+}
+
+// withSource appends where a pattern comes from to its description
+func withSource(description, source string) string {
+	if source == "" {
+		return description
+	}
+	return description + " from " + source
+}
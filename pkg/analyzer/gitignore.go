@@ -0,0 +1,291 @@
+package analyzer
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/format/config"
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+)
+
+// ignoreRule is a pattern of an ignore file
+type ignoreRule struct {
+	pattern gitignore.Pattern
+	text    string // Pattern as written in the file
+	source  string // file:line where the pattern is written
+}
+
+// ignoreLevel is a directory of the project whose ignore file is in force
+type ignoreLevel struct {
+	dir   string // Path relative to the project
+	start int    // Index of its first rule
+}
+
+// ignoreRules holds the rules of the ignore files in force while the project is
+// walked, from the lowest precedence to the highest as git does: core.excludesFile,
+// .git/info/exclude, then the ignore file of each directory from the repository root
+// to the deepest one. Patterns are scoped to the directory of their ignore file.
+type ignoreRules struct {
+	fileName   string // .gitignore or .pmpignore
+	projectDir string
+	source     fs.FS    // Files of the project, read from disk when nil
+	root       string   // Root of the repository, or the project outside of one
+	base       []string // Path of the project relative to the repository root
+	rules      []ignoreRule
+	levels     []ignoreLevel
+}
+
+// newGitignoreRules loads the git ignore rules that apply to the whole project
+func newGitignoreRules(projectDir string, source fs.FS) *ignoreRules {
+	return newIgnoreRules(projectDir, source, ".gitignore", true)
+}
+
+// newIgnoreRules loads the ignore files named fileName that apply to the whole
+// project: those of the project directory and of its parents up to the repository
+// root, after the global and repository excludes of git when gitExcludes is set.
+// Outside of a git repository, only the ignore files of the project apply. The
+// ignore files of the project are read from source, those of its parents from disk.
+func newIgnoreRules(projectDir string, source fs.FS, fileName string, gitExcludes bool) *ignoreRules {
+	absDir := absProjectDir(projectDir)
+	ir := &ignoreRules{fileName: fileName, projectDir: absDir, source: source, root: absDir}
+
+	// A project that is not on disk (an archive or a remote repository) only has
+	// the ignore files of its source
+	if absDir == "" {
+		ir.load(absDir, nil)
+		return ir
+	}
+
+	root, gitDir := findRepository(absDir)
+	if root == "" {
+		ir.load(absDir, nil)
+		return ir
+	}
+	ir.root = root
+
+	if rel, err := filepath.Rel(root, absDir); err == nil && rel != "." {
+		ir.base = strings.Split(rel, string(filepath.Separator))
+	}
+
+	if gitExcludes {
+		if excludesFile := globalExcludesFile(gitDir); excludesFile != "" {
+			ir.rules = append(ir.rules, ir.readIgnoreFile(excludesFile, nil)...)
+		}
+		ir.rules = append(ir.rules, ir.readIgnoreFile(filepath.Join(gitDir, "info", "exclude"), nil)...)
+	}
+	ir.load(root, nil)
+	for i := range ir.base {
+		ir.load(filepath.Join(root, filepath.Join(ir.base[:i+1]...)), ir.base[:i+1])
+	}
+	return ir
+}
+
+// enter loads the ignore file of a directory of the project, once the walk descends
+// into it
+func (ir *ignoreRules) enter(relDir string) {
+	if ir == nil {
+		return
+	}
+	ir.trim(relDir)
+	start := len(ir.rules)
+	ir.load(filepath.Join(ir.projectDir, relDir), ir.path(relDir))
+	if len(ir.rules) > start {
+		ir.levels = append(ir.levels, ignoreLevel{dir: relDir, start: start})
+	}
+}
+
+// match returns the rule that ignores a path of the project, or nil if the path
+// is not ignored. The last matching rule wins and a negated rule includes the
+// path back. Nil rules ignore nothing.
+func (ir *ignoreRules) match(relPath string, isDir bool) *ignoreRule {
+	if ir == nil {
+		return nil
+	}
+	ir.trim(filepath.Dir(relPath))
+	path := ir.path(relPath)
+	for i := len(ir.rules) - 1; i >= 0; i-- {
+		switch ir.rules[i].pattern.Match(path, isDir) {
+		case gitignore.Exclude:
+			return &ir.rules[i]
+		case gitignore.Include:
+			return nil
+		}
+	}
+	return nil
+}
+
+// trim drops the rules of the directories that do not contain dir, left behind by
+// the walk
+func (ir *ignoreRules) trim(dir string) {
+	for len(ir.levels) > 0 {
+		top := ir.levels[len(ir.levels)-1]
+		if dir == top.dir || strings.HasPrefix(dir, top.dir+string(filepath.Separator)) {
+			return
+		}
+		ir.rules = ir.rules[:top.start]
+		ir.levels = ir.levels[:len(ir.levels)-1]
+	}
+}
+
+// path returns the components of a project path relative to the repository root
+func (ir *ignoreRules) path(relPath string) []string {
+	path := append([]string(nil), ir.base...)
+	if relPath == "." {
+		return path
+	}
+	return append(path, strings.Split(relPath, string(filepath.Separator))...)
+}
+
+// load appends the rules of the ignore file of a directory
+func (ir *ignoreRules) load(dir string, domain []string) {
+	ir.rules = append(ir.rules, ir.readIgnoreFile(filepath.Join(dir, ir.fileName), domain)...)
+}
+
+// readIgnoreFile parses the patterns of an ignore file, scoped to domain
+func (ir *ignoreRules) readIgnoreFile(path string, domain []string) []ignoreRule {
+	file, err := ir.open(path)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			fmt.Fprintf(os.Stderr, "Warning: error loading %s: %v\n", path, err)
+		}
+		return nil
+	}
+	defer file.Close()
+
+	// Files of the repository are shown relative to the project
+	source := path
+	if ir.projectDir == "" || strings.HasPrefix(path, ir.root+string(filepath.Separator)) {
+		if rel, err := filepath.Rel(ir.projectDir, path); err == nil {
+			source = filepath.ToSlash(rel)
+		}
+	}
+
+	var rules []ignoreRule
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSuffix(scanner.Text(), "\r")
+		if strings.HasPrefix(text, "#") || strings.TrimSpace(text) == "" {
+			continue
+		}
+		rules = append(rules, ignoreRule{
+			pattern: gitignore.ParsePattern(text, domain),
+			text:    text,
+			source:  fmt.Sprintf("%s:%d", source, line),
+		})
+	}
+	return rules
+}
+
+// open opens an ignore file, from the source of the project when it is one of its files
+func (ir *ignoreRules) open(path string) (io.ReadCloser, error) {
+	if ir.source != nil {
+		if rel, err := filepath.Rel(ir.projectDir, path); err == nil && !strings.HasPrefix(rel, "..") {
+			return ir.source.Open(filepath.ToSlash(rel))
+		}
+	}
+	return os.Open(path)
+}
+
+// absProjectDir returns the absolute path of the project directory, or an empty
+// string for a project that is not on disk
+func absProjectDir(projectDir string) string {
+	if projectDir == "" {
+		return ""
+	}
+	if absDir, err := filepath.Abs(projectDir); err == nil {
+		return absDir
+	}
+	return projectDir
+}
+
+// findRepository returns the root of the git worktree containing dir and its git
+// directory, or empty strings outside of a repository
+func findRepository(dir string) (root, gitDir string) {
+	for {
+		dotGit := filepath.Join(dir, ".git")
+		if info, err := os.Stat(dotGit); err == nil {
+			if info.IsDir() {
+				return dir, dotGit
+			}
+			// Linked worktrees and submodules have a "gitdir: <path>" file
+			if content, err := os.ReadFile(dotGit); err == nil {
+				if target, ok := strings.CutPrefix(strings.TrimSpace(string(content)), "gitdir:"); ok {
+					target = strings.TrimSpace(target)
+					if !filepath.IsAbs(target) {
+						target = filepath.Join(dir, target)
+					}
+					return dir, commonGitDir(target)
+				}
+			}
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", ""
+		}
+		dir = parent
+	}
+}
+
+// commonGitDir returns the directory shared by the worktrees of a repository, which
+// holds info/exclude and the configuration
+func commonGitDir(gitDir string) string {
+	content, err := os.ReadFile(filepath.Join(gitDir, "commondir"))
+	if err != nil {
+		return gitDir
+	}
+	common := strings.TrimSpace(string(content))
+	if !filepath.IsAbs(common) {
+		common = filepath.Join(gitDir, common)
+	}
+	return common
+}
+
+// globalExcludesFile returns the core.excludesFile of the repository or user
+// configuration, or git's default $XDG_CONFIG_HOME/git/ignore
+func globalExcludesFile(gitDir string) string {
+	home, _ := os.UserHomeDir()
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if configHome == "" && home != "" {
+		configHome = filepath.Join(home, ".config")
+	}
+
+	// From the highest precedence to the lowest
+	configs := []string{filepath.Join(gitDir, "config")}
+	if home != "" {
+		configs = append(configs, filepath.Join(home, ".gitconfig"))
+	}
+	if configHome != "" {
+		configs = append(configs, filepath.Join(configHome, "git", "config"))
+	}
+
+	for _, path := range configs {
+		file, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+		cfg := config.New()
+		err = config.NewDecoder(file).Decode(cfg)
+		file.Close()
+		if err != nil {
+			continue
+		}
+		if excludesFile := cfg.Section("core").Options.Get("excludesFile"); excludesFile != "" {
+			if rest, ok := strings.CutPrefix(excludesFile, "~/"); ok && home != "" {
+				excludesFile = filepath.Join(home, rest)
+			}
+			return excludesFile
+		}
+	}
+
+	if configHome == "" {
+		return ""
+	}
+	return filepath.Join(configHome, "git", "ignore")
+}
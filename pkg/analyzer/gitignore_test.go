@@ -0,0 +1,66 @@
+package analyzer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIgnoreRules(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", "")
+
+	repo := t.TempDir()
+	files := map[string]string{
+		".git/info/exclude":       "*.info\n",
+		".gitignore":              "*.log\n!keep.log\n/root.only\n",
+		"pkg/.gitignore":          "build/\n",
+		"pkg/sub/.gitignore":      "*.tmp\n",
+		"pkg/sub/deep/.gitignore": "!g.tmp\n",
+		".config/git/ignore":      "*.glob\n",
+	}
+	for name, content := range files {
+		dir := repo
+		if name == ".config/git/ignore" {
+			dir = home
+		}
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Paths in walking order, relative to the pkg project inside the repository
+	tests := []struct {
+		path    string
+		dir     bool
+		ignored bool
+	}{
+		{"a.log", false, true},      // Parent .gitignore
+		{"keep.log", false, false},  // Negated
+		{"root.only", false, false}, // Anchored to the repository root
+		{"build", true, true},       // Directory pattern
+		{"x.glob", false, true},     // core.excludesFile default
+		{"sub", true, false},
+		{"sub/deep", true, false},
+		{"sub/deep/g.tmp", false, false}, // Negated in a deeper directory
+		{"sub/d.tmp", false, true},       // Back in sub after leaving sub/deep
+		{"y.info", false, true},          // .git/info/exclude
+		{"z.tmp", false, false},          // Out of sub
+	}
+
+	rules := newGitignoreRules(filepath.Join(repo, "pkg"), nil)
+	for _, test := range tests {
+		relPath := filepath.FromSlash(test.path)
+		if got := rules.match(relPath, test.dir) != nil; got != test.ignored {
+			t.Errorf("match(%q) ignored = %v, want %v", test.path, got, test.ignored)
+		}
+		if test.dir && !test.ignored {
+			rules.enter(relPath)
+		}
+	}
+}
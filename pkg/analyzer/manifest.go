@@ -0,0 +1,114 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/benoitpetit/prompt-my-project/pkg/binary"
+	"github.com/benoitpetit/prompt-my-project/pkg/formatter"
+	"github.com/benoitpetit/prompt-my-project/pkg/truncate"
+)
+
+// Statuses of a candidate file in the prompt
+const (
+	StatusIncluded   = "included"   // Full content
+	StatusSummarized = "summarized" // Signatures only
+	StatusOmitted    = "omitted"    // Read but left out to respect the token budget
+	StatusExcluded   = "excluded"   // Never read (or unreadable)
+)
+
+// Reasons for which a candidate file is excluded, omitted or summarized
+const (
+	ReasonExcludePattern = "exclude-pattern"
+	ReasonGitignore      = "gitignore"
+	ReasonIncludePattern = "no-include-pattern"
+	ReasonBinary         = "binary"
+	ReasonMinSize        = "below-min-size"
+	ReasonMaxSize        = "above-max-size"
+	ReasonMaxFiles       = "max-files"
+	ReasonMaxTotalSize   = "max-total-size"
+	ReasonReadError      = "read-error"
+	ReasonTokenBudget    = "token-budget"
+	ReasonSummaryOnly    = "summary-only"
+	ReasonSummaryPattern = "summary-pattern"
+)
+
+// DefaultExcludesSource is the source of the default exclude patterns in ExcludeSources.
+// The directories they exclude are only searched for the paths .pmpinclude names under them.
+const DefaultExcludesSource = "default excludes"
+
+// Candidate is a file (or an excluded directory, whose files were not walked or only
+// searched for the files forced in) seen while collecting the project, and what became of it
+type Candidate struct {
+	Path       string            `json:"path"`
+	Dir        bool              `json:"dir,omitempty"`
+	Status     string            `json:"status"`
+	Reason     string            `json:"reason,omitempty"`
+	Pattern    string            `json:"pattern,omitempty"`  // Include, exclude or summary pattern that decided
+	Source     string            `json:"source,omitempty"`   // Where the exclude pattern comes from
+	Forced     bool              `json:"forced,omitempty"`   // Forced in by .pmpinclude
+	Searched   bool              `json:"searched,omitempty"` // Excluded directory searched for the files forced in
+	Binary     *binary.Detection `json:"binary,omitempty"`   // Outcome of the binary detection, when it ran
+	Error      string            `json:"error,omitempty"`
+	Size       int64             `json:"size"`
+	SHA256     string            `json:"sha256,omitempty"`     // Hash of the file, when it was read
+	Tokens     int               `json:"tokens,omitempty"`     // Estimated tokens of the content sent (or left out when omitted)
+	Redactions int               `json:"redactions,omitempty"` // Secrets replaced in the content sent
+	// Truncated tells what was left out of a file over the per-file limits
+	Truncated *truncate.Truncation `json:"truncated,omitempty"`
+}
+
+// manifest is the sidecar of a prompt listing every candidate file
+type manifest struct {
+	Prompt string      `json:"prompt"`
+	Parts  []string    `json:"parts,omitempty"`
+	Files  []Candidate `json:"files"`
+}
+
+// addCandidate records a file seen while collecting the project
+func (pa *ProjectAnalyzer) addCandidate(candidate Candidate) {
+	if pa.candidateIndex == nil {
+		pa.candidateIndex = make(map[string]int)
+	}
+	candidate.Path = filepath.ToSlash(candidate.Path)
+	pa.candidateIndex[candidate.Path] = len(pa.Candidates)
+	pa.Candidates = append(pa.Candidates, candidate)
+}
+
+// candidate returns the record of a collected file, or nil if it has none
+func (pa *ProjectAnalyzer) candidate(relPath string) *Candidate {
+	i, ok := pa.candidateIndex[filepath.ToSlash(relPath)]
+	if !ok {
+		return nil
+	}
+	return &pa.Candidates[i]
+}
+
+// setStatus records what became of a collected file
+func (pa *ProjectAnalyzer) setStatus(relPath, status, reason, pattern string) {
+	if c := pa.candidate(relPath); c != nil {
+		c.Status, c.Reason, c.Pattern = status, reason, pattern
+	}
+}
+
+// writeManifest writes the candidates next to the prompt. Nothing is written when
+// the prompt goes to stdout.
+func (pa *ProjectAnalyzer) writeManifest(fmtr *formatter.Formatter, stats *StatsResult) error {
+	content, err := json.MarshalIndent(manifest{
+		Prompt: stats.OutputPath,
+		Parts:  stats.OutputParts,
+		Files:  pa.Candidates,
+	}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error formatting manifest: %w", err)
+	}
+
+	path := fmtr.ManifestPath()
+	if err := os.WriteFile(path, append(content, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	stats.ManifestPath = path
+	return nil
+}
@@ -0,0 +1,106 @@
+package analyzer
+
+import (
+	"io/fs"
+	"path/filepath"
+	"strings"
+)
+
+// Prompt-specific ignore and include files, in gitignore syntax
+const (
+	pmpIgnoreFile  = ".pmpignore"  // Excludes files, nested per directory like .gitignore
+	pmpIncludeFile = ".pmpinclude" // Forces files in, at the root of the project
+)
+
+// newPmpIgnoreRules loads the .pmpignore files that apply to the whole project
+func newPmpIgnoreRules(projectDir string, source fs.FS) *ignoreRules {
+	return newIgnoreRules(projectDir, source, pmpIgnoreFile, false)
+}
+
+// forceRules are the patterns of .pmpinclude. A file they match is included even if
+// exclude patterns, ignore files or the size and count limits would leave it out.
+type forceRules struct {
+	*ignoreRules
+}
+
+// newForceRules loads the .pmpinclude of the project, or returns nil without one
+func newForceRules(projectDir string, source fs.FS) *forceRules {
+	absDir := absProjectDir(projectDir)
+	ir := &ignoreRules{fileName: pmpIncludeFile, projectDir: absDir, source: source, root: absDir}
+	ir.load(absDir, nil)
+	if len(ir.rules) == 0 {
+		return nil
+	}
+	return &forceRules{ir}
+}
+
+// forcing returns the rule forcing a file in, or nil. As in ignore files, the last
+// matching pattern wins and "!pattern" stops forcing a file.
+func (fr *forceRules) forcing(relPath string) *ignoreRule {
+	if fr == nil {
+		return nil
+	}
+	return fr.match(relPath, false)
+}
+
+// mayForceUnder reports whether a pattern may force files of a directory in, so that
+// the directory must be walked even though it is excluded. When explicit is set, only
+// the patterns naming a path under the directory count, not those matching at any depth.
+func (fr *forceRules) mayForceUnder(relDir string, explicit bool) bool {
+	if fr == nil {
+		return false
+	}
+	dir := strings.Split(filepath.ToSlash(relDir), "/")
+	for _, rule := range fr.rules {
+		if strings.HasPrefix(rule.text, "!") {
+			continue
+		}
+		if rule.anyDepth() {
+			if explicit {
+				continue
+			}
+			return true
+		}
+		components := strings.Split(strings.TrimPrefix(strings.TrimSuffix(rule.text, "/"), "/"), "/")
+		if explicit && namesPathUnder(components, dir) || !explicit && prefixMayMatch(components, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// prefixMayMatch reports whether the leading components of a pattern match those of
+// a directory, up to the shortest of them or a "**"
+func prefixMayMatch(pattern, dir []string) bool {
+	for i := 0; i < len(pattern) && i < len(dir); i++ {
+		if pattern[i] == "**" {
+			return true
+		}
+		if ok, err := filepath.Match(pattern[i], dir[i]); err != nil || !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// anyDepth reports whether a pattern has no slash, so that it matches at any depth
+func (r *ignoreRule) anyDepth() bool {
+	return !strings.Contains(strings.TrimSuffix(r.text, "/"), "/")
+}
+
+// namesPathUnder reports whether a pattern names a path under a directory: its leading
+// components match those of the directory, none of them being a "**", and it goes deeper
+func namesPathUnder(pattern, dir []string) bool {
+	if len(pattern) <= len(dir) {
+		return false
+	}
+	for i := range dir {
+		if pattern[i] == "**" {
+			return false
+		}
+		if ok, err := filepath.Match(pattern[i], dir[i]); err != nil || !ok {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,123 @@
+package analyzer
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestForceRules(t *testing.T) {
+	dir := t.TempDir()
+	content := "docs/architecture.md\n*.proto\n!vendor/**/*.proto\n/testdata/golden/*.json\n"
+	if err := os.WriteFile(filepath.Join(dir, pmpIncludeFile), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	forced := newForceRules(dir, nil)
+
+	files := []struct {
+		path   string
+		forced bool
+	}{
+		{"docs/architecture.md", true},
+		{"docs/notes.md", false},
+		{"api/v1/service.proto", true},
+		{"vendor/x/y.proto", false}, // Negated
+		{"testdata/golden/out.json", true},
+		{"testdata/other.json", false},
+	}
+	for _, file := range files {
+		if got := forced.forcing(filepath.FromSlash(file.path)) != nil; got != file.forced {
+			t.Errorf("forcing(%q) = %v, want %v", file.path, got, file.forced)
+		}
+	}
+
+	// Directories are walked when a pattern may force one of their files in, and only
+	// for the paths named under them when explicit
+	dirs := []struct {
+		path     string
+		walk     bool
+		explicit bool
+	}{
+		{"docs", true, true},
+		{"testdata", true, true},
+		{"testdata/golden", true, true},
+		{"testdata/other", true, false}, // Only *.proto
+		{"node_modules", true, false},   // *.proto matches at any depth
+		{"vendor", true, false},         // Only negated
+	}
+	for _, d := range dirs {
+		if got := forced.mayForceUnder(filepath.FromSlash(d.path), false); got != d.walk {
+			t.Errorf("mayForceUnder(%q, false) = %v, want %v", d.path, got, d.walk)
+		}
+		if got := forced.mayForceUnder(filepath.FromSlash(d.path), true); got != d.explicit {
+			t.Errorf("mayForceUnder(%q, true) = %v, want %v", d.path, got, d.explicit)
+		}
+	}
+
+	anchored := &forceRules{&ignoreRules{rules: forced.rules[:1]}}
+	if anchored.mayForceUnder("testdata", false) {
+		t.Error("mayForceUnder(\"testdata\") = true with only docs/architecture.md")
+	}
+
+	var none *forceRules
+	if none.forcing("a.go") != nil || none.mayForceUnder("docs", false) {
+		t.Error("nil forceRules force files in")
+	}
+}
+
+func TestForcedUnderExcludedDirectories(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+	files := map[string]string{
+		pmpIncludeFile:              "*.proto\nnode_modules/api/*.proto\n",
+		"main.go":                   "package main\n",
+		"gen/a.proto":               "syntax = \"proto3\";\n",
+		"node_modules/b.proto":      "syntax = \"proto3\";\n",
+		"node_modules/api/c.proto":  "syntax = \"proto3\";\n",
+		"dist/d.proto":              "syntax = \"proto3\";\n",
+		"node_modules/x/y/index.js": "module.exports = {}\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pa := New(dir, nil, []string{"gen/**", "node_modules/**", "dist/**"}, 0, 1<<20, 0, 0, 1)
+	pa.ExcludeSources = []string{"--exclude", DefaultExcludesSource, DefaultExcludesSource}
+	pa.PmpFiles = true
+	if err := pa.CollectFiles(); err != nil {
+		t.Fatal(err)
+	}
+
+	// *.proto searches the excluded gen/, but only node_modules/api/*.proto is
+	// looked for under the default excludes
+	if want := []string{pmpIncludeFile, "gen/a.proto", "main.go", "node_modules/api/c.proto"}; !reflect.DeepEqual(slashPaths(pa.Files), want) {
+		t.Errorf("files = %v, want %v", slashPaths(pa.Files), want)
+	}
+	for _, d := range []struct {
+		path     string
+		searched bool
+	}{
+		{"gen/", true},
+		{"node_modules/", true},
+		{"dist/", false},
+	} {
+		if c := pa.candidate(d.path); c == nil || c.Searched != d.searched {
+			t.Errorf("%s: candidate %+v, want searched %v", d.path, c, d.searched)
+		}
+	}
+}
+
+func slashPaths(paths []string) []string {
+	result := make([]string, len(paths))
+	for i, path := range paths {
+		result[i] = filepath.ToSlash(path)
+	}
+	return result
+}
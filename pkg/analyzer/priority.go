@@ -0,0 +1,86 @@
+package analyzer
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// Priority weights used to rank files when limits force a selection
+const (
+	priorityChanged    = 100 // File touched by uncommitted work or recent commits
+	priorityKeyFile    = 50  // Manifest, README, main entry point...
+	priorityEntryPoint = 40  // Program entry points (main, index, app, cmd/...)
+	priorityInclude    = 10  // Per rank of the first matching include pattern
+)
+
+// entryPointNames are file names that usually start a program
+var entryPointNames = map[string]bool{
+	"main.go": true, "main.py": true, "__main__.py": true, "app.py": true,
+	"manage.py": true, "index.js": true, "index.ts": true, "app.js": true,
+	"app.ts": true, "server.js": true, "server.ts": true, "server.go": true,
+	"main.rs": true, "lib.rs": true, "main.c": true, "main.cpp": true,
+	"Main.java": true, "Program.cs": true,
+}
+
+// filePriority scores a file: the higher the score, the more likely the file is
+// kept when the number of files, their total size or the token budget is limited
+func (pa *ProjectAnalyzer) filePriority(relPath string, changed map[string]bool) int {
+	score := 0
+	base := filepath.Base(relPath)
+	slashPath := filepath.ToSlash(relPath)
+
+	if changed[relPath] {
+		score += priorityChanged
+	}
+	if keyFileNames[base] {
+		score += priorityKeyFile
+	}
+	if entryPointNames[base] || strings.HasPrefix(slashPath, "cmd/") || strings.Contains(slashPath, "/cmd/") {
+		score += priorityEntryPoint
+	}
+
+	// Files matched by the first include patterns come first
+	for i, pattern := range pa.IncludePatterns {
+		if match, err := doublestar.Match(pattern, slashPath); err == nil && match {
+			score += (len(pa.IncludePatterns) - i) * priorityInclude
+			break
+		}
+	}
+
+	// Prefer files close to the project root
+	score -= strings.Count(slashPath, "/")
+
+	return score
+}
+
+// sortByPriority returns the files sorted from the highest to the lowest priority.
+// Changed files always come first and files with the same priority keep their relative order.
+func (pa *ProjectAnalyzer) sortByPriority(files []string, changed map[string]bool) []string {
+	scores := make(map[string]int, len(files))
+	for _, file := range files {
+		scores[file] = pa.filePriority(file, changed)
+	}
+
+	sorted := append([]string(nil), files...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if changed[sorted[i]] != changed[sorted[j]] {
+			return changed[sorted[i]]
+		}
+		return scores[sorted[i]] > scores[sorted[j]]
+	})
+	return sorted
+}
+
+// keepInOrder returns the files of the keep set in their original order
+func keepInOrder(files []string, keep map[string]bool) []string {
+	result := make([]string, 0, len(keep))
+	for _, file := range files {
+		if keep[file] {
+			result = append(result, file)
+		}
+	}
+	return result
+}
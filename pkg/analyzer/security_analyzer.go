@@ -4,8 +4,9 @@ import (
 	"bufio"
 	"os"
 	"path/filepath"
-	"regexp"
 	"strings"
+
+	"github.com/benoitpetit/prompt-my-project/pkg/secrets"
 )
 
 // SecurityIssue represents a security concern
@@ -35,7 +36,7 @@ type SecurityReport struct {
 type SecurityAnalyzer struct {
 	rootDir        string
 	files          []string
-	secretPatterns map[string]*regexp.Regexp
+	secretPatterns []secrets.Pattern
 	configChecks   []ConfigCheck
 }
 
@@ -61,34 +62,8 @@ func NewSecurityAnalyzer(rootDir string, files []string) *SecurityAnalyzer {
 
 // initSecretPatterns initializes regex patterns for secret detection
 func (sa *SecurityAnalyzer) initSecretPatterns() {
-	sa.secretPatterns = map[string]*regexp.Regexp{
-		// API Keys
-		"AWS Access Key":  regexp.MustCompile(`(?i)(AWS|aws)(_|-)?ACCESS(_|-)?KEY(_|-)?ID['"\s]*[:=]\s*['"]?[A-Z0-9]{20}['"]?`),
-		"AWS Secret Key":  regexp.MustCompile(`(?i)(AWS|aws)(_|-)?SECRET(_|-)?ACCESS(_|-)?KEY['"\s]*[:=]\s*['"]?[A-Za-z0-9/+=]{40}['"]?`),
-		"GitHub Token":    regexp.MustCompile(`(?i)gh[pousr]_[A-Za-z0-9_]{36,}`),
-		"Generic API Key": regexp.MustCompile(`(?i)api[_-]?key['"\s]*[:=]\s*['"][A-Za-z0-9_\-]{20,}['"]`),
-
-		// Private Keys
-		"Private Key": regexp.MustCompile(`-----BEGIN\s+(RSA|DSA|EC|OPENSSH|PGP)\s+PRIVATE\s+KEY-----`),
-
-		// Passwords
-		"Password in Code": regexp.MustCompile(`(?i)(password|passwd|pwd)['"\s]*[:=]\s*['"][^'"]{8,}['"]`),
-
-		// Tokens
-		"JWT Token":    regexp.MustCompile(`eyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}`),
-		"Bearer Token": regexp.MustCompile(`(?i)bearer\s+[A-Za-z0-9_\-\.=]{20,}`),
-		"Slack Token":  regexp.MustCompile(`xox[baprs]-[0-9]{12}-[0-9]{12}-[A-Za-z0-9]{24}`),
-		"Stripe Key":   regexp.MustCompile(`(?i)(sk|pk)_(test|live)_[A-Za-z0-9]{24,}`),
-
-		// Database Credentials
-		"Database URL": regexp.MustCompile(`(?i)(postgres|mysql|mongodb)://[^:]+:[^@]+@[^/]+`),
-
-		// OAuth
-		"OAuth Client Secret": regexp.MustCompile(`(?i)client[_-]?secret['"\s]*[:=]\s*['"][A-Za-z0-9_\-]{20,}['"]`),
-
-		// Generic Secrets
-		"Secret in Code": regexp.MustCompile(`(?i)secret['"\s]*[:=]\s*['"][A-Za-z0-9_\-]{16,}['"]`),
-	}
+	// The same patterns are redacted from the prompts
+	sa.secretPatterns = secrets.Patterns
 }
 
 // initConfigChecks initializes configuration security checks
@@ -246,25 +221,20 @@ func (sa *SecurityAnalyzer) scanForSecrets(report *SecurityReport) {
 			}
 
 			// Check each pattern
-			for secretType, pattern := range sa.secretPatterns {
-				if pattern.MatchString(line) {
+			for _, pattern := range sa.secretPatterns {
+				if pattern.Applies(file) && pattern.Regexp.MatchString(line) {
 					// Extract matched portion
-					matched := pattern.FindString(line)
+					matched := pattern.Regexp.FindString(line)
 					if len(matched) > 50 {
 						matched = matched[:50] + "..."
 					}
 
-					severity := "critical"
-					if secretType == "Password in Code" || secretType == "Secret in Code" {
-						severity = "high"
-					}
-
 					report.Issues = append(report.Issues, SecurityIssue{
 						Type:        "secret",
-						Severity:    severity,
+						Severity:    pattern.Severity,
 						File:        file,
 						Line:        lineNum,
-						Description: secretType + " detected in code",
+						Description: pattern.Name + " detected in code",
 						Suggestion:  "Move sensitive data to environment variables or secure vault",
 						Matched:     matched,
 					})
@@ -11,11 +11,26 @@ import (
 // Cache manages a persistent cache of binary file detection results
 type Cache struct {
 	sync.RWMutex
-	cache     map[string]bool
+	cache     map[string]Entry
 	cacheDir  string
 	cacheFile string
 }
 
+// Entry is a cached detection result: whether the file is binary and the rule that decided
+type Entry struct {
+	Binary bool   `json:"binary"`
+	Rule   string `json:"rule,omitempty"`
+}
+
+// UnmarshalJSON also reads the entries of older caches, which only hold a boolean
+func (e *Entry) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &e.Binary); err == nil {
+		return nil
+	}
+	type entry Entry
+	return json.Unmarshal(data, (*entry)(e))
+}
+
 // NewCache creates a new cache for binary files
 func NewCache() *Cache {
 	homeDir, err := os.UserHomeDir()
@@ -26,7 +41,7 @@ func NewCache() *Cache {
 	}
 
 	return &Cache{
-		cache:     make(map[string]bool),
+		cache:     make(map[string]Entry),
 		cacheDir:  cacheDir,
 		cacheFile: filepath.Join(cacheDir, "binary_cache.json"),
 	}
@@ -56,7 +71,7 @@ func (bc *Cache) Load() error {
 	// Deserialize the cache
 	if err := json.Unmarshal(data, &bc.cache); err != nil {
 		// Reset cache on error
-		bc.cache = make(map[string]bool)
+		bc.cache = make(map[string]Entry)
 		return fmt.Errorf("error parsing cache file: %w", err)
 	}
 
@@ -88,7 +103,7 @@ func (bc *Cache) Save() error {
 }
 
 // Get retrieves a value from the cache
-func (bc *Cache) Get(key string) (bool, bool) {
+func (bc *Cache) Get(key string) (Entry, bool) {
 	bc.RLock()
 	defer bc.RUnlock()
 	val, ok := bc.cache[key]
@@ -96,7 +111,7 @@ func (bc *Cache) Get(key string) (bool, bool) {
 }
 
 // Set adds a value to the cache
-func (bc *Cache) Set(key string, value bool) {
+func (bc *Cache) Set(key string, value Entry) {
 	bc.Lock()
 	defer bc.Unlock()
 	bc.cache[key] = value
@@ -2,6 +2,8 @@ package binary
 
 import (
 	"fmt"
+	"io"
+	"io/fs"
 	"mime"
 	"net/http"
 	"os"
@@ -20,32 +22,83 @@ var BinaryExtensions = map[string]bool{
 	".gz": true, ".rar": true, ".7z": true, ".pdf": true,
 }
 
+// Rules that decide whether a file is binary
+const (
+	RuleUnreadable = "unreadable"
+	RuleExtension  = "extension"
+	RuleMimeType   = "mime-type"
+	RuleContent    = "content"
+)
+
+// Detection is the outcome of the binary detection of a file
+type Detection struct {
+	Binary bool   `json:"binary"`
+	Rule   string `json:"rule,omitempty"` // Check that decided, empty for entries cached by older versions
+	Cached bool   `json:"-"`              // Whether the result came from the cache; not written, as it depends on earlier runs
+}
+
+// String describes the detection, e.g. "binary by extension, cache miss"
+func (d Detection) String() string {
+	kind := "text"
+	if d.Binary {
+		kind = "binary"
+	}
+	if d.Cached && d.Rule == "" {
+		return kind + ", cache hit"
+	}
+	if d.Cached {
+		return fmt.Sprintf("%s by %s, cache hit", kind, d.Rule)
+	}
+	return fmt.Sprintf("%s by %s, cache miss", kind, d.Rule)
+}
+
 // IsBinaryFile detects if a file is binary based on its extension, mime type or content
 func IsBinaryFile(filepath string, cache *Cache) bool {
+	return Detect(filepath, cache).Binary
+}
+
+// Detect detects if a file is binary like IsBinaryFile, and reports how it was decided
+func Detect(filepath string, cache *Cache) Detection {
 	// Get file info for cache key
 	fileInfo, err := os.Stat(filepath)
 	if err != nil {
-		return true // When in doubt, consider as binary
+		return Detection{Binary: true, Rule: RuleUnreadable} // When in doubt, consider as binary
 	}
 
 	// Create a unique cache key based on path and meta-information
 	cacheKey := fmt.Sprintf("%s:%d:%d", filepath, fileInfo.Size(), fileInfo.ModTime().UnixNano())
 
+	return detectCached(cacheKey, filepath, func() (io.ReadCloser, error) { return os.Open(filepath) }, cache)
+}
+
+// DetectFS detects if a file of a file system is binary like Detect. The key
+// identifies the version of the file in the cache.
+func DetectFS(fsys fs.FS, name, key string, cache *Cache) Detection {
+	return detectCached(key, name, func() (io.ReadCloser, error) { return fsys.Open(name) }, cache)
+}
+
+// detectCached returns the cached detection of a file, or detects and caches it
+func detectCached(cacheKey, filepath string, open func() (io.ReadCloser, error), cache *Cache) Detection {
 	// Check in cache
 	if cache != nil {
-		if isBinary, found := cache.Get(cacheKey); found {
-			return isBinary
+		if entry, found := cache.Get(cacheKey); found {
+			return Detection{Binary: entry.Binary, Rule: entry.Rule, Cached: true}
 		}
 	}
 
-	// If not found in cache, perform detection
+	detection := detect(filepath, open)
+	if cache != nil {
+		cache.Set(cacheKey, Entry{Binary: detection.Binary, Rule: detection.Rule})
+	}
+	return detection
+}
+
+// detect performs the detection of a file that is not in the cache
+func detect(filepath string, open func() (io.ReadCloser, error)) Detection {
 	// Check extension
 	ext := strings.ToLower(path.Ext(filepath))
 	if BinaryExtensions[ext] {
-		if cache != nil {
-			cache.Set(cacheKey, true)
-		}
-		return true
+		return Detection{Binary: true, Rule: RuleExtension}
 	}
 
 	// Check MIME type
@@ -55,37 +108,25 @@ func IsBinaryFile(filepath string, cache *Cache) bool {
 			!strings.Contains(mimeType, "application/json") &&
 			!strings.Contains(mimeType, "application/xml")
 
-		// If MIME type is definitive, cache and return
+		// If MIME type is definitive, return
 		if isBinary || strings.HasPrefix(mimeType, "text/") {
-			if cache != nil {
-				cache.Set(cacheKey, isBinary)
-			}
-			return isBinary
+			return Detection{Binary: isBinary, Rule: RuleMimeType}
 		}
 	}
 
 	// Read first bytes to detect null characters
-	file, err := os.Open(filepath)
+	file, err := open()
 	if err != nil {
-		if cache != nil {
-			cache.Set(cacheKey, true) // When in doubt, consider as binary
-		}
-		return true
+		return Detection{Binary: true, Rule: RuleUnreadable} // When in doubt, consider as binary
 	}
 	defer file.Close()
 
 	buffer := make([]byte, 512)
-	n, err := file.Read(buffer)
-	if err != nil {
-		if cache != nil {
-			cache.Set(cacheKey, true)
-		}
-		return true
+	n, err := io.ReadFull(file, buffer)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return Detection{Binary: true, Rule: RuleUnreadable}
 	}
 
 	isBinary := http.DetectContentType(buffer[:n]) != "text/plain; charset=utf-8"
-	if cache != nil {
-		cache.Set(cacheKey, isBinary)
-	}
-	return isBinary
-} 
\ No newline at end of file
+	return Detection{Binary: isBinary, Rule: RuleContent}
+}
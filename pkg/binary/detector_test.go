@@ -0,0 +1,53 @@
+package binary
+
+import (
+	"encoding/json"
+	"testing"
+	"testing/fstest"
+)
+
+func TestDetectFSCache(t *testing.T) {
+	fsys := fstest.MapFS{
+		"logo":  {Data: []byte("\x89PNG\r\n\x1a\n\x00\x00")},
+		"notes": {Data: []byte("plain text\n")},
+	}
+	cache := NewCache()
+
+	for _, tt := range []struct {
+		name   string
+		binary bool
+	}{
+		{"logo", true},
+		{"notes", false},
+	} {
+		miss := DetectFS(fsys, tt.name, tt.name+":1", cache)
+		hit := DetectFS(fsys, tt.name, tt.name+":1", cache)
+		if miss != (Detection{Binary: tt.binary, Rule: RuleContent}) {
+			t.Errorf("%s: %+v on a cache miss", tt.name, miss)
+		}
+		if hit != (Detection{Binary: tt.binary, Rule: RuleContent, Cached: true}) {
+			t.Errorf("%s: %+v on a cache hit", tt.name, hit)
+		}
+
+		// The manifest does not depend on the cache
+		missJSON, _ := json.Marshal(miss)
+		hitJSON, _ := json.Marshal(hit)
+		if string(hitJSON) != string(missJSON) {
+			t.Errorf("%s: %s on a cache hit, %s on a miss", tt.name, hitJSON, missJSON)
+		}
+	}
+}
+
+func TestCacheEntry(t *testing.T) {
+	// Older caches only hold whether the file is binary
+	var entries map[string]Entry
+	if err := json.Unmarshal([]byte(`{"a:1:2": true, "b:1:2": {"binary": true, "rule": "extension"}}`), &entries); err != nil {
+		t.Fatal(err)
+	}
+	if entries["a:1:2"] != (Entry{Binary: true}) || entries["b:1:2"] != (Entry{Binary: true, Rule: RuleExtension}) {
+		t.Errorf("entries %+v", entries)
+	}
+	if got := (Detection{Binary: true, Cached: true}).String(); got != "binary, cache hit" {
+		t.Errorf("String() = %q", got)
+	}
+}
@@ -2,6 +2,9 @@ package config
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -24,6 +27,23 @@ type Config struct {
 	FocusChanges    bool     `json:"focusChanges,omitempty"`
 	RecentCommits   int      `json:"recentCommits,omitempty"`
 	SummaryPatterns []string `json:"summaryPatterns,omitempty"`
+	MaxTokens       int      `json:"maxTokens,omitempty"`
+	SplitTokens     int      `json:"splitTokens,omitempty"`
+	Template        string   `json:"template,omitempty"`
+	Task            string   `json:"task,omitempty"`
+	Instructions    string   `json:"instructions,omitempty"`
+	Question        string   `json:"question,omitempty"`
+	LineNumbers     bool     `json:"lineNumbers,omitempty"`
+	ChunkOverlap    int      `json:"chunkOverlap,omitempty"`
+	Strip           []string `json:"strip,omitempty"`
+	MaxFileTokens   int      `json:"maxFileTokens,omitempty"`
+	MaxFileLines    int      `json:"maxFileLines,omitempty"`
+	OnSecret        string   `json:"onSecret,omitempty"`
+	AllowSecrets    bool     `json:"allowSecrets,omitempty"`
+	Reproducible    bool     `json:"reproducible,omitempty"`
+
+	// Tasks overrides or adds task presets (name -> instructions)
+	Tasks map[string]string `json:"tasks,omitempty"`
 }
 
 // DefaultConfig returns a default configuration
@@ -46,18 +66,20 @@ func DefaultConfig() *Config {
 
 // LoadConfig loads configuration from .pmprc file if it exists
 func LoadConfig(projectPath string) (*Config, error) {
-	config := DefaultConfig()
+	return LoadConfigFS(os.DirFS(projectPath), projectPath)
+}
 
-	// Look for .pmprc in the project directory
-	configPath := filepath.Join(projectPath, ".pmprc")
+// LoadConfigFS loads configuration from the .pmprc at the root of a tree of files, if
+// it exists. Relative template and instructions paths are resolved against
+// projectPath, the directory of the project on disk, and rejected without one.
+func LoadConfigFS(fsys fs.FS, projectPath string) (*Config, error) {
+	config := DefaultConfig()
 
-	// Check if .pmprc exists
-	if _, err := os.Stat(configPath); os.IsNotExist(err) {
+	// Read the config file
+	data, err := fs.ReadFile(fsys, ".pmprc")
+	if errors.Is(err, fs.ErrNotExist) {
 		return config, nil // Return default config if no .pmprc found
 	}
-
-	// Read the config file
-	data, err := os.ReadFile(configPath)
 	if err != nil {
 		return config, err
 	}
@@ -105,6 +127,65 @@ func LoadConfig(projectPath string) (*Config, error) {
 	if len(fileConfig.SummaryPatterns) > 0 {
 		config.SummaryPatterns = fileConfig.SummaryPatterns
 	}
+	if fileConfig.MaxTokens > 0 {
+		config.MaxTokens = fileConfig.MaxTokens
+	}
+	if fileConfig.SplitTokens > 0 {
+		config.SplitTokens = fileConfig.SplitTokens
+	}
+	if fileConfig.Template != "" {
+		// Template paths are relative to the project directory
+		config.Template = fileConfig.Template
+		if !filepath.IsAbs(config.Template) {
+			if projectPath == "" {
+				return DefaultConfig(), fmt.Errorf("template %s: relative paths need the project on disk", config.Template)
+			}
+			config.Template = filepath.Join(projectPath, config.Template)
+		}
+	}
+	if fileConfig.Task != "" {
+		config.Task = fileConfig.Task
+	}
+	if fileConfig.Instructions != "" {
+		// Instructions paths are relative to the project directory
+		config.Instructions = fileConfig.Instructions
+		if !filepath.IsAbs(config.Instructions) {
+			if projectPath == "" {
+				return DefaultConfig(), fmt.Errorf("instructions %s: relative paths need the project on disk", config.Instructions)
+			}
+			config.Instructions = filepath.Join(projectPath, config.Instructions)
+		}
+	}
+	if fileConfig.Question != "" {
+		config.Question = fileConfig.Question
+	}
+	if fileConfig.LineNumbers {
+		config.LineNumbers = true
+	}
+	if fileConfig.ChunkOverlap > 0 {
+		config.ChunkOverlap = fileConfig.ChunkOverlap
+	}
+	if len(fileConfig.Strip) > 0 {
+		config.Strip = fileConfig.Strip
+	}
+	if fileConfig.MaxFileTokens > 0 {
+		config.MaxFileTokens = fileConfig.MaxFileTokens
+	}
+	if fileConfig.MaxFileLines > 0 {
+		config.MaxFileLines = fileConfig.MaxFileLines
+	}
+	if fileConfig.OnSecret != "" {
+		config.OnSecret = fileConfig.OnSecret
+	}
+	if fileConfig.AllowSecrets {
+		config.AllowSecrets = true
+	}
+	if fileConfig.Reproducible {
+		config.Reproducible = true
+	}
+	if len(fileConfig.Tasks) > 0 {
+		config.Tasks = fileConfig.Tasks
+	}
 
 	return config, nil
 }
@@ -147,8 +228,12 @@ func (c *Config) MergeWithFlags(
 	if noGitignore {
 		c.NoGitignore = noGitignore
 	}
-	c.SummaryOnly = summaryOnly
-	c.FocusChanges = focusChanges
+	if summaryOnly {
+		c.SummaryOnly = summaryOnly
+	}
+	if focusChanges {
+		c.FocusChanges = focusChanges
+	}
 	if len(summaryPatterns) > 0 {
 		c.SummaryPatterns = summaryPatterns
 	}
@@ -181,6 +266,22 @@ func GetEnvironmentConfig() *Config {
 		}
 	}
 
+	if maxTokens := os.Getenv("PMP_MAX_TOKENS"); maxTokens != "" {
+		if tokens := parseInt(maxTokens); tokens > 0 {
+			config.MaxTokens = tokens
+		}
+	}
+
+	if splitTokens := os.Getenv("PMP_SPLIT_TOKENS"); splitTokens != "" {
+		if tokens := parseInt(splitTokens); tokens > 0 {
+			config.SplitTokens = tokens
+		}
+	}
+
+	if template := os.Getenv("PMP_TEMPLATE"); template != "" {
+		config.Template = template
+	}
+
 	if maxTotalSize := os.Getenv("PMP_MAX_TOTAL_SIZE"); maxTotalSize != "" {
 		config.MaxTotalSize = maxTotalSize
 	}
@@ -0,0 +1,36 @@
+package config
+
+import (
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoadConfigFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		".pmprc": {Data: []byte(`{"exclude": ["gen/**"], "maxFiles": 20, "template": "prompt.tmpl"}`)},
+	}
+
+	// The .pmprc of a project on disk resolves its paths against the project
+	dir := filepath.Join("projects", "api")
+	cfg, err := LoadConfigFS(fsys, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Exclude) != 1 || cfg.Exclude[0] != "gen/**" || cfg.MaxFiles != 20 || cfg.Template != filepath.Join(dir, "prompt.tmpl") {
+		t.Errorf("config %+v", cfg)
+	}
+
+	// Without a directory, as for an archive, a relative path cannot be resolved
+	if _, err := LoadConfigFS(fsys, ""); err == nil {
+		t.Error("relative template loaded without a project directory")
+	}
+
+	cfg, err = LoadConfigFS(fstest.MapFS{}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.MaxFiles != DefaultConfig().MaxFiles {
+		t.Errorf("config without .pmprc %+v", cfg)
+	}
+}
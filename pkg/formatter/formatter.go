@@ -1,14 +1,17 @@
 package formatter
 
 import (
-	"encoding/json"
-	"encoding/xml"
+	"bytes"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"text/template"
 	"time"
 
+	"github.com/benoitpetit/prompt-my-project/pkg/truncate"
+	"github.com/benoitpetit/prompt-my-project/pkg/utils"
 	"github.com/dustin/go-humanize"
 )
 
@@ -16,10 +19,15 @@ import (
 type OutputFormat string
 
 const (
-	FormatTXT    OutputFormat = "txt"
-	FormatJSON   OutputFormat = "json"
-	FormatXML    OutputFormat = "xml"
-	FormatSTDOUT OutputFormat = "stdout" // Format pour sortie directe sur stdout
+	FormatTXT     OutputFormat = "txt"
+	FormatJSON    OutputFormat = "json"
+	FormatXML     OutputFormat = "xml"
+	FormatJSONL   OutputFormat = "jsonl"  // One JSON record per line: project, files, statistics
+	FormatChunks  OutputFormat = "chunks" // jsonl records with files split into declarations
+	FormatMD      OutputFormat = "md"
+	FormatXMLDocs OutputFormat = "xml-docs" // <documents> layout with raw CDATA contents
+	FormatHTML    OutputFormat = "html"     // Self-contained page to share with people
+	FormatSTDOUT  OutputFormat = "stdout"   // Format pour sortie directe sur stdout
 )
 
 // ProjectReport represents the structure for formatted output
@@ -28,12 +36,14 @@ type ProjectReport struct {
 		Name        string    `json:"name" xml:"name"`
 		GeneratedAt time.Time `json:"generated_at" xml:"generated_at"`
 		Generator   string    `json:"generator" xml:"generator"`
-		Host        string    `json:"host" xml:"host"`
+		Host        string    `json:"host,omitempty" xml:"host,omitempty"` // Omitted in reproducible output
 		OS          string    `json:"os" xml:"os"`
 	} `json:"project_info" xml:"project_info"`
-	Technologies []string `json:"technologies" xml:"technologies>technology"`
-	KeyFiles     []string `json:"key_files" xml:"key_files>file"`
-	Issues       []string `json:"issues" xml:"issues>issue"`
+	Part         *PartInfo `json:"part,omitempty" xml:"part,omitempty"`
+	Instructions string    `json:"instructions,omitempty" xml:"instructions,omitempty"`
+	Technologies []string  `json:"technologies" xml:"technologies>technology"`
+	KeyFiles     []string  `json:"key_files" xml:"key_files>file"`
+	Issues       []string  `json:"issues" xml:"issues>issue"`
 	Statistics   struct {
 		FileCount      int     `json:"file_count" xml:"file_count"`
 		TotalSize      int64   `json:"total_size" xml:"total_size"`
@@ -42,37 +52,89 @@ type ProjectReport struct {
 		TokenCount     int     `json:"token_count" xml:"token_count"`
 		CharCount      int     `json:"char_count" xml:"char_count"`
 		FilesPerSecond float64 `json:"files_per_second" xml:"files_per_second"`
+		Redactions     string  `json:"redactions,omitempty" xml:"redactions,omitempty"` // Secrets replaced in file contents
 	} `json:"statistics" xml:"statistics"`
 	FileTypes []struct {
 		Extension string `json:"extension" xml:"extension,attr"`
 		Count     int    `json:"count" xml:"count"`
 	} `json:"file_types" xml:"file_types>type"`
-	Files []struct {
-		Path     string `json:"path" xml:"path"`
-		Size     int64  `json:"size" xml:"size"`
-		Content  string `json:"content,omitempty" xml:"content,omitempty"`
-		Language string `json:"language" xml:"language"`
-	} `json:"files" xml:"files>file"`
+	RecentChanges []ChangedFile `json:"recent_changes,omitempty" xml:"recent_changes>file,omitempty"`
+	Files         []ReportFile  `json:"files" xml:"files>file"`
+	OmittedFiles  []string      `json:"omitted_files,omitempty" xml:"omitted_files>file,omitempty"`
+	Question      string        `json:"question,omitempty" xml:"question,omitempty"`
+}
+
+// ChangedFile represents a file touched by uncommitted work or recent commits
+type ChangedFile struct {
+	Path       string `json:"path" xml:"path"`
+	ChangeType string `json:"change_type" xml:"change_type"`
+	Staged     bool   `json:"staged" xml:"staged"`
+	Committed  bool   `json:"committed,omitempty" xml:"committed,omitempty"`
+}
+
+// CommitInfo describes the last commit that changed a file
+type CommitInfo struct {
+	Hash   string    `json:"hash" xml:"hash"`
+	Author string    `json:"author" xml:"author"`
+	Date   time.Time `json:"date" xml:"date"`
+}
+
+// ReportFile represents a single file in the report. The size, line count, hash and
+// encoding are those of the file on disk; the tokens those of its content in the prompt.
+type ReportFile struct {
+	Path       string      `json:"path" xml:"path"`
+	Size       int64       `json:"size" xml:"size"`
+	Content    string      `json:"content,omitempty" xml:"content,omitempty"`
+	Language   string      `json:"language" xml:"language"`
+	LineCount  int         `json:"line_count" xml:"line_count"`
+	Tokens     int         `json:"tokens" xml:"tokens"`
+	SHA256     string      `json:"sha256,omitempty" xml:"sha256,omitempty"`
+	ModTime    *time.Time  `json:"mtime,omitempty" xml:"mtime,omitempty"` // Omitted in reproducible output
+	Encoding   string      `json:"encoding,omitempty" xml:"encoding,omitempty"`
+	LastCommit *CommitInfo `json:"last_commit,omitempty" xml:"last_commit,omitempty"` // Set in git repositories
+	Summarized bool        `json:"summarized,omitempty" xml:"summarized,omitempty"`
+	ChangeType string      `json:"change_type,omitempty" xml:"change_type,omitempty"`
+	StartLine  int         `json:"start_line,omitempty" xml:"start_line,omitempty"` // Set when the file is split across parts
+	EndLine    int         `json:"end_line,omitempty" xml:"end_line,omitempty"`
+	Lines      []string    `json:"lines,omitempty" xml:"lines>line,omitempty"` // Content split in lines with --line-numbers
+	// Truncated tells what was left out of a file over the per-file limits
+	Truncated *truncate.Truncation `json:"truncated,omitempty" xml:"truncated,omitempty"`
 }
 
 // FileInfo represents information about a file
 type FileInfo struct {
-	Path     string
-	Size     int64
-	Content  string
-	Language string
+	Path       string
+	Size       int64
+	Content    string
+	Language   string
+	Summarized bool                 // Content holds the file summary instead of the full source
+	ChangeType string               // Set when the file was recently changed (added, modified)
+	Truncated  *truncate.Truncation // Set when parts of the content were left out
+	LineCount  int                  // Lines of the file on disk
+	Tokens     int                  // Estimated tokens of the content
+	SHA256     string               // Hash of the file on disk
+	ModTime    time.Time            // Last modification (zero when unknown)
+	Encoding   string               // Character encoding (utils.DetectEncoding)
+	LastCommit *CommitInfo          // Last commit that changed the file
 }
 
 // Formatter handles formatting output in different formats
 type Formatter struct {
-	format        OutputFormat
-	report        *ProjectReport
-	outputDir     string
-	projectDir    string
-	headerContent string
-	structure     string
-	filePrefix    string // Optional custom prefix for output filename
-	projectName   string // Optional custom project name
+	format       OutputFormat
+	report       *ProjectReport
+	outputDir    string
+	projectDir   string
+	structure    string
+	tree         *utils.Directory   // Project tree of the html format
+	filePrefix   string             // Optional custom prefix for output filename
+	projectName  string             // Optional custom project name
+	splitTokens  int                // Maximum tokens per part when the output is split
+	tmpl         *template.Template // Template of textual formats or user-defined template
+	templateExt  string             // Output extension of a user-defined template
+	lineNumbers  bool               // Prefix file contents with line numbers
+	chunkOverlap int                // Lines of context repeated before each chunk (chunks format)
+	reproducible bool               // Output depends only on the files (no host, time or speed)
+	replaced     []string           // Output files that existed and were overwritten
 }
 
 // NewFormatter creates a new formatter for the specified format
@@ -84,6 +146,11 @@ func NewFormatter(format string, outputDir, projectDir string) *Formatter {
 		projectDir: projectDir,
 	}
 
+	// Textual formats are rendered with their built-in template
+	if f.format != FormatJSON && f.format != FormatXML && f.format != FormatJSONL && f.format != FormatChunks && f.format != FormatHTML {
+		f.tmpl = builtinTemplate(f.format, projectDir)
+	}
+
 	// Initialize report with default values
 	f.report.ProjectInfo.Name = filepath.Base(filepath.Clean(projectDir))
 	f.report.ProjectInfo.GeneratedAt = time.Now()
@@ -102,9 +169,14 @@ func NewFormatter(format string, outputDir, projectDir string) *Formatter {
 	return f
 }
 
-// SetHeaderContent sets the header content for the report
+// SetHeaderContent sets the instructions written before the project structure
 func (f *Formatter) SetHeaderContent(content string) {
-	f.headerContent = content
+	f.report.Instructions = content
+}
+
+// SetQuestion sets the question written after the file contents
+func (f *Formatter) SetQuestion(question string) {
+	f.report.Question = question
 }
 
 // SetProjectStructure sets the project structure for the report
@@ -112,6 +184,11 @@ func (f *Formatter) SetProjectStructure(structure string) {
 	f.structure = structure
 }
 
+// SetProjectTree sets the project tree, shown as a collapsible tree by the html format
+func (f *Formatter) SetProjectTree(tree *utils.Directory) {
+	f.tree = tree
+}
+
 // SetStatistics sets the statistics for the report
 func (f *Formatter) SetStatistics(fileCount int, totalSize int64, tokenCount, charCount int, duration time.Duration) {
 	f.report.Statistics.FileCount = fileCount
@@ -120,17 +197,36 @@ func (f *Formatter) SetStatistics(fileCount int, totalSize int64, tokenCount, ch
 	f.report.Statistics.AvgFileSize = totalSize / int64(max(1, fileCount))
 	f.report.Statistics.TokenCount = tokenCount
 	f.report.Statistics.CharCount = charCount
-	f.report.Statistics.FilesPerSecond = float64(fileCount) / duration.Seconds()
+	if !f.reproducible {
+		f.report.Statistics.FilesPerSecond = float64(fileCount) / duration.Seconds()
+	}
+}
+
+// SetReproducible makes the output depend only on the files, so that the same tree
+// always gives byte-identical output: the generation time (and the output filename)
+// is pinned to sourceDate, and the host and the processing speed are omitted
+func (f *Formatter) SetReproducible(sourceDate time.Time) {
+	f.reproducible = true
+	f.report.ProjectInfo.GeneratedAt = sourceDate.UTC()
+	f.report.ProjectInfo.Host = ""
+	f.report.Statistics.FilesPerSecond = 0
 }
 
-// SetFileTypes sets the file types in the report
+// SetFileTypes sets the file types in the report, sorted by extension
 func (f *Formatter) SetFileTypes(fileTypes map[string]int) {
 	f.report.FileTypes = make([]struct {
 		Extension string `json:"extension" xml:"extension,attr"`
 		Count     int    `json:"count" xml:"count"`
 	}, 0)
 
-	for ext, count := range fileTypes {
+	extensions := make([]string, 0, len(fileTypes))
+	for ext := range fileTypes {
+		extensions = append(extensions, ext)
+	}
+	sort.Strings(extensions)
+
+	for _, ext := range extensions {
+		count := fileTypes[ext]
 		f.report.FileTypes = append(f.report.FileTypes, struct {
 			Extension string `json:"extension" xml:"extension,attr"`
 			Count     int    `json:"count" xml:"count"`
@@ -156,6 +252,22 @@ func (f *Formatter) SetIssues(issues []string) {
 	f.report.Issues = issues
 }
 
+// SetRedactions sets the summary of the secrets redacted from file contents,
+// written with the statistics since it is only known once every file is read
+func (f *Formatter) SetRedactions(summary string) {
+	f.report.Statistics.Redactions = summary
+}
+
+// SetRecentChanges sets the recently changed files in the report
+func (f *Formatter) SetRecentChanges(changes []ChangedFile) {
+	f.report.RecentChanges = changes
+}
+
+// SetOmittedFiles sets the files left out of the report to respect the token budget
+func (f *Formatter) SetOmittedFiles(files []string) {
+	f.report.OmittedFiles = files
+}
+
 // SetFilePrefix sets a custom prefix for the output filename
 func (f *Formatter) SetFilePrefix(prefix string) {
 	f.filePrefix = prefix
@@ -171,122 +283,129 @@ func (f *Formatter) SetProjectName(name string) {
 
 // AddFile adds a file to the report
 func (f *Formatter) AddFile(fileInfo FileInfo) {
-	f.report.Files = append(f.report.Files, struct {
-		Path     string `json:"path" xml:"path"`
-		Size     int64  `json:"size" xml:"size"`
-		Content  string `json:"content,omitempty" xml:"content,omitempty"`
-		Language string `json:"language" xml:"language"`
-	}{
-		Path:     fileInfo.Path,
-		Size:     fileInfo.Size,
-		Content:  fileInfo.Content,
-		Language: fileInfo.Language,
-	})
+	f.report.Files = append(f.report.Files, reportFile(fileInfo))
+}
+
+// reportFile converts file information to its report entry
+func reportFile(fileInfo FileInfo) ReportFile {
+	file := ReportFile{
+		Path:       fileInfo.Path,
+		Size:       fileInfo.Size,
+		Content:    fileInfo.Content,
+		Language:   fileInfo.Language,
+		Summarized: fileInfo.Summarized,
+		ChangeType: fileInfo.ChangeType,
+		Truncated:  fileInfo.Truncated,
+		LineCount:  fileInfo.LineCount,
+		Tokens:     fileInfo.Tokens,
+		SHA256:     fileInfo.SHA256,
+		Encoding:   fileInfo.Encoding,
+		LastCommit: fileInfo.LastCommit,
+	}
+	if !fileInfo.ModTime.IsZero() {
+		file.ModTime = &fileInfo.ModTime
+	}
+	return file
+}
+
+// ClearFiles removes every file added to the report
+func (f *Formatter) ClearFiles() {
+	f.report.Files = nil
 }
 
 // WriteToFile writes the formatted output to a file
 func (f *Formatter) WriteToFile() (string, error) {
-	// Create output directory if it doesn't exist
-	if err := os.MkdirAll(f.outputDir, 0755); err != nil {
-		return "", fmt.Errorf("failed to create output directory: %w", err)
+	file, outputPath, err := f.CreateOutputFile()
+	if err != nil {
+		return "", err
 	}
 
-	// Build filename with optional custom prefix
-	var filename string
-	timestamp := time.Now().Format("20060102_150405")
-
-	if f.filePrefix != "" {
-		// Custom prefix: repoName_prompt_timestamp
-		filename = fmt.Sprintf("%s_prompt_%s.%s", f.filePrefix, timestamp, f.format)
-	} else {
-		// Default: prompt_timestamp
-		filename = fmt.Sprintf("prompt_%s.%s", timestamp, f.format)
+	if err := f.writeReport(file); err != nil {
+		file.Close()
+		return "", err
+	}
+	if err := file.Close(); err != nil {
+		return "", fmt.Errorf("failed to write output file: %w", err)
 	}
-	outputPath := filepath.Join(f.outputDir, filename)
-
-	var content []byte
-	var err error
-
-	switch f.format {
-	case FormatJSON:
-		content, err = json.MarshalIndent(f.report, "", "  ")
-	case FormatXML:
-		content, err = xml.MarshalIndent(f.report, "", "  ")
-		// Add XML header
-		content = append([]byte(xml.Header), content...)
-	default: // FormatTXT
-		var textContent strings.Builder
-		textContent.WriteString(f.headerContent)
-		textContent.WriteString("\nPROJECT STRUCTURE:\n")
-		textContent.WriteString("-----------------------------------------------------\n\n")
-		textContent.WriteString(f.structure)
-		textContent.WriteString("\nFILE CONTENTS:\n")
-		textContent.WriteString("-----------------------------------------------------\n")
-
-		// Add file contents
-		for _, file := range f.report.Files {
-			textContent.WriteString("\n================================================\n")
-			textContent.WriteString(fmt.Sprintf("File: %s\n", file.Path))
-			textContent.WriteString("================================================\n")
-			textContent.WriteString(file.Content)
-			textContent.WriteString("\n")
-		}
 
-		content = []byte(textContent.String())
+	return outputPath, nil
+}
+
+// CreateOutputFile creates the output file, and its directory if needed, and returns
+// it with its path. The caller writes the output to it and closes it.
+func (f *Formatter) CreateOutputFile() (*os.File, string, error) {
+	// Create output directory if it doesn't exist
+	if err := os.MkdirAll(f.outputDir, 0755); err != nil {
+		return nil, "", fmt.Errorf("failed to create output directory: %w", err)
 	}
 
+	outputPath := filepath.Join(f.outputDir, fmt.Sprintf("%s.%s", f.outputBaseName(), f.extension()))
+	f.noteReplaced(outputPath)
+	file, err := os.Create(outputPath)
 	if err != nil {
-		return "", fmt.Errorf("error formatting output: %w", err)
+		return nil, "", fmt.Errorf("failed to create output file: %w", err)
 	}
 
-	// Write to file
-	if err := os.WriteFile(outputPath, content, 0644); err != nil {
-		return "", fmt.Errorf("failed to write output file: %w", err)
+	return file, outputPath, nil
+}
+
+// noteReplaced records an output file about to be overwritten, which happens when the
+// name does not change from one run to the next (reproducible output)
+func (f *Formatter) noteReplaced(outputPath string) {
+	if _, err := os.Stat(outputPath); err == nil {
+		f.replaced = append(f.replaced, outputPath)
 	}
+}
 
-	return outputPath, nil
+// ReplacedFiles returns the output files that existed and were overwritten
+func (f *Formatter) ReplacedFiles() []string {
+	return f.replaced
+}
+
+// ManifestPath returns the path of the manifest written next to the output
+func (f *Formatter) ManifestPath() string {
+	return filepath.Join(f.outputDir, f.outputBaseName()+".manifest.json")
+}
+
+// extension returns the output filename extension of the format
+func (f *Formatter) extension() string {
+	if f.templateExt != "" {
+		return f.templateExt
+	}
+	if f.format == FormatXMLDocs {
+		return "xml"
+	}
+	return string(f.format)
+}
+
+// outputBaseName returns the output filename without extension, timestamped with
+// the generation time of the report (the same for every part of a split prompt)
+func (f *Formatter) outputBaseName() string {
+	timestamp := f.report.ProjectInfo.GeneratedAt.Format("20060102_150405")
+
+	if f.filePrefix != "" {
+		// Custom prefix: repoName_prompt_timestamp
+		return fmt.Sprintf("%s_prompt_%s", f.filePrefix, timestamp)
+	}
+	// Default: prompt_timestamp
+	return fmt.Sprintf("prompt_%s", timestamp)
 }
 
 // WriteToStdout writes the formatted output to stdout
 func (f *Formatter) WriteToStdout() error {
-	var content []byte
-	var err error
-
-	switch f.format {
-	case FormatJSON:
-		content, err = json.MarshalIndent(f.report, "", "  ")
-	case FormatXML:
-		content, err = xml.MarshalIndent(f.report, "", "  ")
-		// Add XML header
-		content = append([]byte(xml.Header), content...)
-	default: // FormatTXT
-		var textContent strings.Builder
-		textContent.WriteString(f.headerContent)
-		textContent.WriteString("\nPROJECT STRUCTURE:\n")
-		textContent.WriteString("-----------------------------------------------------\n\n")
-		textContent.WriteString(f.structure)
-		textContent.WriteString("\nFILE CONTENTS:\n")
-		textContent.WriteString("-----------------------------------------------------\n")
-
-		// Add file contents
-		for _, file := range f.report.Files {
-			textContent.WriteString("\n================================================\n")
-			textContent.WriteString(fmt.Sprintf("File: %s\n", file.Path))
-			textContent.WriteString("================================================\n")
-			textContent.WriteString(file.Content)
-			textContent.WriteString("\n")
+	if !f.IsSplit() {
+		if err := f.writeReport(os.Stdout); err != nil {
+			return fmt.Errorf("failed to write to stdout: %w", err)
 		}
-
-		content = []byte(textContent.String())
+		return nil
 	}
 
+	// Parts are separated by a delimiter so they can be pasted one by one
+	parts, err := f.renderParts()
 	if err != nil {
-		return fmt.Errorf("error formatting output: %w", err)
+		return err
 	}
-
-	// Write to stdout
-	_, err = fmt.Print(string(content))
-	if err != nil {
+	if _, err := fmt.Print(strings.Join(byteStrings(parts), PartDelimiter)); err != nil {
 		return fmt.Errorf("failed to write to stdout: %w", err)
 	}
 
@@ -295,42 +414,48 @@ func (f *Formatter) WriteToStdout() error {
 
 // GetFormattedContent returns the formatted content as a string
 func (f *Formatter) GetFormattedContent() (string, error) {
-	var content []byte
-	var err error
-
-	switch f.format {
-	case FormatJSON:
-		content, err = json.MarshalIndent(f.report, "", "  ")
-	case FormatXML:
-		content, err = xml.MarshalIndent(f.report, "", "  ")
-		// Add XML header
-		content = append([]byte(xml.Header), content...)
-	default: // FormatTXT
-		var textContent strings.Builder
-		textContent.WriteString(f.headerContent)
-		textContent.WriteString("\nPROJECT STRUCTURE:\n")
-		textContent.WriteString("-----------------------------------------------------\n\n")
-		textContent.WriteString(f.structure)
-		textContent.WriteString("\nFILE CONTENTS:\n")
-		textContent.WriteString("-----------------------------------------------------\n")
-
-		// Add file contents
-		for _, file := range f.report.Files {
-			textContent.WriteString("\n================================================\n")
-			textContent.WriteString(fmt.Sprintf("File: %s\n", file.Path))
-			textContent.WriteString("================================================\n")
-			textContent.WriteString(file.Content)
-			textContent.WriteString("\n")
-		}
+	content, err := f.render()
+	if err != nil {
+		return "", err
+	}
 
-		content = []byte(textContent.String())
+	return string(content), nil
+}
+
+// render formats the report in the configured output format or template
+func (f *Formatter) render() ([]byte, error) {
+	var content bytes.Buffer
+	if err := f.writeReport(&content); err != nil {
+		return nil, err
 	}
+	return content.Bytes(), nil
+}
 
-	if err != nil {
-		return "", fmt.Errorf("error formatting output: %w", err)
+// fileNotes describes how a file appears in the output (chunk, change, summary)
+func fileNotes(file ReportFile) []string {
+	var notes []string
+	if file.StartLine > 0 {
+		notes = append(notes, fmt.Sprintf("lines %d-%d", file.StartLine, file.EndLine))
+	}
+	if file.ChangeType != "" {
+		notes = append(notes, "recently "+file.ChangeType)
+	}
+	if file.Summarized {
+		notes = append(notes, "summary")
 	}
+	if file.Truncated != nil {
+		notes = append(notes, fmt.Sprintf("truncated, %d of %d lines omitted", file.Truncated.OmittedLines, file.Truncated.Lines))
+	}
+	return notes
+}
 
-	return string(content), nil
+// byteStrings converts rendered parts to strings
+func byteStrings(parts [][]byte) []string {
+	result := make([]string, len(parts))
+	for i, part := range parts {
+		result[i] = string(part)
+	}
+	return result
 }
 
 // max returns the maximum of two integers
@@ -0,0 +1,249 @@
+package formatter
+
+import (
+	"html"
+	"html/template"
+	"strings"
+)
+
+// syntax describes the lexical elements of a language for the html highlighter
+type syntax struct {
+	keywords      map[string]bool
+	lineComments  []string
+	blockComments [][2]string
+	quotes        string // Quotes of strings ending at the end of the line
+	rawQuotes     string // Quotes of strings spanning lines, without escapes
+	tripleQuotes  bool   // Python """docstrings"""
+	spacedHash    bool   // "#" starts a comment only after a blank (shell)
+	foldCase      bool   // Keywords are case-insensitive (SQL)
+}
+
+// keywords builds a keyword set from a space-separated list
+func keywords(list string) map[string]bool {
+	set := make(map[string]bool)
+	for _, word := range strings.Fields(list) {
+		set[word] = true
+	}
+	return set
+}
+
+var (
+	cComments = [][2]string{{"/*", "*/"}}
+
+	cKeywords = "auto break case char const continue default do double else enum extern float for goto if " +
+		"inline int long register restrict return short signed sizeof static struct switch typedef union " +
+		"unsigned void volatile while NULL true false bool"
+	jsKeywords = "async await break case catch class const continue debugger default delete do else export " +
+		"extends false finally for from function if import in instanceof let new null of return static super " +
+		"switch this throw true try typeof undefined var void while with yield"
+)
+
+// syntaxes maps the languages detected by the analyzer to their syntax
+var syntaxes = map[string]*syntax{
+	"Go": {
+		keywords: keywords("break case chan const continue default defer else fallthrough for func go goto if " +
+			"import interface map package range return select struct switch type var " +
+			"true false nil iota any error bool byte rune string int int8 int16 int32 int64 " +
+			"uint uint8 uint16 uint32 uint64 uintptr float32 float64 complex64 complex128"),
+		lineComments: []string{"//"}, blockComments: cComments, quotes: `"'`, rawQuotes: "`",
+	},
+	"JavaScript": {
+		keywords:     keywords(jsKeywords),
+		lineComments: []string{"//"}, blockComments: cComments, quotes: `"'`, rawQuotes: "`",
+	},
+	"TypeScript": {
+		keywords: keywords(jsKeywords + " abstract any as boolean declare enum implements interface keyof " +
+			"namespace never number private protected public readonly string type unknown"),
+		lineComments: []string{"//"}, blockComments: cComments, quotes: `"'`, rawQuotes: "`",
+	},
+	"Python": {
+		keywords: keywords("False None True and as assert async await break class continue def del elif else " +
+			"except finally for from global if import in is lambda nonlocal not or pass raise return self " +
+			"try while with yield"),
+		lineComments: []string{"#"}, quotes: `"'`, tripleQuotes: true,
+	},
+	"Java": {
+		keywords: keywords("abstract assert boolean break byte case catch char class const continue default do " +
+			"double else enum extends final finally float for goto if implements import instanceof int " +
+			"interface long native new null package private protected public return short static super " +
+			"switch synchronized this throw throws transient true false try var void volatile while record"),
+		lineComments: []string{"//"}, blockComments: cComments, quotes: `"'`,
+	},
+	"Ruby": {
+		keywords: keywords("BEGIN END alias and begin break case class def defined do else elsif end ensure " +
+			"false for if in module next nil not or redo rescue retry return self super then true undef " +
+			"unless until when while yield require attr_reader attr_accessor"),
+		lineComments: []string{"#"}, quotes: `"'`,
+	},
+	"PHP": {
+		keywords: keywords("abstract and array as break callable case catch class clone const continue declare " +
+			"default do echo else elseif empty enddeclare endfor endforeach endif endswitch endwhile extends " +
+			"final finally fn for foreach function global if implements include instanceof interface isset " +
+			"list match namespace new null or print private protected public readonly require return static " +
+			"switch this throw trait true false try unset use var while yield"),
+		lineComments: []string{"//", "#"}, blockComments: cComments, quotes: `"'`,
+	},
+	"C#": {
+		keywords: keywords("abstract as async await base bool break byte case catch char checked class const " +
+			"continue decimal default delegate do double else enum event explicit extern false finally fixed " +
+			"float for foreach goto if implicit in int interface internal is lock long namespace new null " +
+			"object operator out override params private protected public readonly record ref return sbyte " +
+			"sealed short sizeof static string struct switch this throw true try typeof uint ulong unchecked " +
+			"unsafe ushort using var virtual void volatile while"),
+		lineComments: []string{"//"}, blockComments: cComments, quotes: `"'`,
+	},
+	"C":            {keywords: keywords(cKeywords), lineComments: []string{"//"}, blockComments: cComments, quotes: `"'`},
+	"C/C++ Header": {keywords: keywords(cKeywords), lineComments: []string{"//"}, blockComments: cComments, quotes: `"'`},
+	"C++": {
+		keywords: keywords(cKeywords + " catch class constexpr delete explicit friend namespace new noexcept " +
+			"nullptr operator override private protected public template this throw try typename using virtual"),
+		lineComments: []string{"//"}, blockComments: cComments, quotes: `"'`,
+	},
+	"CSS":  {blockComments: cComments, quotes: `"'`},
+	"JSON": {keywords: keywords("true false null"), quotes: `"`},
+	"Shell": {
+		keywords: keywords("if then else elif fi case esac for select while until do done in function " +
+			"return local export readonly declare set unset shift exit"),
+		lineComments: []string{"#"}, quotes: `"'`, spacedHash: true,
+	},
+	"SQL": {
+		keywords: keywords("add all alter and as asc begin between by case check column commit constraint " +
+			"create cross database default delete desc distinct drop else end exists foreign from full " +
+			"group having if in index inner insert into is join key left like limit not null on or order " +
+			"outer primary references returning right rollback select set table then transaction union " +
+			"unique update values view when where with"),
+		lineComments: []string{"--"}, blockComments: cComments, quotes: `'"`, foldCase: true,
+	},
+	"HTML": {blockComments: [][2]string{{"<!--", "-->"}}},
+	"XML":  {blockComments: [][2]string{{"<!--", "-->"}}},
+}
+
+// highlight returns the content as HTML with its comments, strings, numbers and
+// keywords wrapped in spans. Languages without a syntax are only escaped.
+func highlight(language, content string) template.HTML {
+	syn, ok := syntaxes[language]
+	if !ok {
+		return template.HTML(html.EscapeString(content))
+	}
+
+	var b strings.Builder
+	plain := 0 // Start of the text not written yet
+	span := func(start, end int, class string) {
+		b.WriteString(html.EscapeString(content[plain:start]))
+		b.WriteString(`<span class="hl-` + class + `">`)
+		b.WriteString(html.EscapeString(content[start:end]))
+		b.WriteString("</span>")
+		plain = end
+	}
+
+	for i := 0; i < len(content); {
+		rest := content[i:]
+		c := content[i]
+
+		if end := syn.comment(content, i); end > i {
+			span(i, end, "c")
+			i = end
+			continue
+		}
+
+		if syn.tripleQuotes && (strings.HasPrefix(rest, `"""`) || strings.HasPrefix(rest, "'''")) {
+			end := len(content)
+			if close := strings.Index(rest[3:], rest[:3]); close >= 0 {
+				end = i + 3 + close + 3
+			}
+			span(i, end, "s")
+			i = end
+			continue
+		}
+
+		if strings.IndexByte(syn.quotes, c) >= 0 || strings.IndexByte(syn.rawQuotes, c) >= 0 {
+			end := stringEnd(content, i, strings.IndexByte(syn.rawQuotes, c) >= 0)
+			span(i, end, "s")
+			i = end
+			continue
+		}
+
+		if isDigit(c) && (i == 0 || !isIdentByte(content[i-1])) {
+			end := i + 1
+			for end < len(content) && (isIdentByte(content[end]) || content[end] == '.') {
+				end++
+			}
+			span(i, end, "n")
+			i = end
+			continue
+		}
+
+		if isIdentByte(c) {
+			end := i + 1
+			for end < len(content) && isIdentByte(content[end]) {
+				end++
+			}
+			word := content[i:end]
+			if syn.foldCase {
+				word = strings.ToLower(word)
+			}
+			if (i == 0 || !isIdentByte(content[i-1])) && syn.keywords[word] {
+				span(i, end, "k")
+			}
+			i = end
+			continue
+		}
+
+		i++
+	}
+	b.WriteString(html.EscapeString(content[plain:]))
+
+	return template.HTML(b.String())
+}
+
+// comment returns the end of the comment starting at i, or i if there is none
+func (syn *syntax) comment(content string, i int) int {
+	rest := content[i:]
+	for _, prefix := range syn.lineComments {
+		if !strings.HasPrefix(rest, prefix) {
+			continue
+		}
+		if prefix == "#" && syn.spacedHash && i > 0 && !strings.ContainsRune(" \t\n", rune(content[i-1])) {
+			continue
+		}
+		if end := strings.IndexByte(rest, '\n'); end >= 0 {
+			return i + end
+		}
+		return len(content)
+	}
+	for _, delimiters := range syn.blockComments {
+		if !strings.HasPrefix(rest, delimiters[0]) {
+			continue
+		}
+		if end := strings.Index(rest[len(delimiters[0]):], delimiters[1]); end >= 0 {
+			return i + len(delimiters[0]) + end + len(delimiters[1])
+		}
+		return len(content)
+	}
+	return i
+}
+
+// stringEnd returns the end of the string literal opened at i. Strings end at the
+// end of the line unless raw, and raw strings have no escapes.
+func stringEnd(content string, i int, raw bool) int {
+	quote := content[i]
+	for j := i + 1; j < len(content); j++ {
+		switch {
+		case content[j] == quote:
+			return j + 1
+		case content[j] == '\\' && !raw:
+			j++
+		case content[j] == '\n' && !raw:
+			return j
+		}
+	}
+	return len(content)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || isDigit(c) || (c|0x20 >= 'a' && c|0x20 <= 'z')
+}
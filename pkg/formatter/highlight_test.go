@@ -0,0 +1,22 @@
+package formatter
+
+import "testing"
+
+func TestHighlight(t *testing.T) {
+	tests := []struct {
+		language, content, want string
+	}{
+		{"Go", `return "a<b" // x`, `<span class="hl-k">return</span> <span class="hl-s">&#34;a&lt;b&#34;</span> <span class="hl-c">// x</span>`},
+		{"Go", "x := `a\nb` + 42", "x := <span class=\"hl-s\">`a\nb`</span> + <span class=\"hl-n\">42</span>"},
+		{"Python", "def f():\n    '''a # b'''", "<span class=\"hl-k\">def</span> f():\n    <span class=\"hl-s\">&#39;&#39;&#39;a # b&#39;&#39;&#39;</span>"},
+		{"Shell", "echo a#b # c", `echo a#b <span class="hl-c"># c</span>`},
+		{"SQL", "SELECT x1 FROM t", `<span class="hl-k">SELECT</span> x1 <span class="hl-k">FROM</span> t`},
+		{"Unknown", "if <x>", "if &lt;x&gt;"},
+	}
+
+	for _, test := range tests {
+		if got := string(highlight(test.language, test.content)); got != test.want {
+			t.Errorf("highlight(%q, %q) =\n%s\nwant\n%s", test.language, test.content, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package formatter
+
+import (
+	"crypto/sha1"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"html/template"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/benoitpetit/prompt-my-project/pkg/utils"
+	"github.com/dustin/go-humanize"
+)
+
+// htmlAssets holds the page template, style and script of the html format. They are
+// inlined in the page so that it works offline.
+//
+//go:embed html
+var htmlAssets embed.FS
+
+var htmlTemplate = template.Must(template.New("report.html.tmpl").Funcs(template.FuncMap{
+	"fileid": fileID,
+	"bytes": func(size int64) string {
+		return humanize.Bytes(uint64(size))
+	},
+}).ParseFS(htmlAssets, "html/report.html.tmpl"))
+
+// htmlPage is the data of the "header" and "footer" parts of the html page
+type htmlPage struct {
+	*ProjectReport
+	Structure string
+	Tree      template.HTML
+	Charts    []template.HTML
+	Style     template.CSS
+	Script    template.JS
+}
+
+// htmlFile is the data of the "file" part of the html page
+type htmlFile struct {
+	ReportFile
+	ID     string
+	Class  string        // Language as a CSS class
+	Notes  []string      // How the file appears: line range, recent change, summary
+	Code   template.HTML // Highlighted content
+	Gutter string        // Line numbers, when enabled
+}
+
+// htmlStream writes the report as a single page with a collapsible project tree,
+// highlighted files with copy buttons, and charts of the statistics
+type htmlStream struct {
+	tokens    map[string]int // Estimated tokens of each file written, for the chart
+	estimator *utils.TokenEstimator
+}
+
+func (h *htmlStream) header(s *StreamWriter) error {
+	h.tokens = make(map[string]int)
+	h.estimator = utils.NewTokenEstimator()
+	return h.execute(s, "header", h.page(s, nil))
+}
+
+func (h *htmlStream) file(s *StreamWriter, file ReportFile) error {
+	data := htmlFileData(file)
+	h.tokens[file.Path] += h.estimator.EstimateTokens(file.Content+strings.Join(file.Lines, "\n"), true)
+	return h.execute(s, "file", data)
+}
+
+func (h *htmlStream) footer(s *StreamWriter) error {
+	charts := []template.HTML{fileTypesChart(s.f.report), largestFilesChart(h.tokens)}
+	return h.execute(s, "footer", h.page(s, charts))
+}
+
+// page returns the data of the header and footer
+func (h *htmlStream) page(s *StreamWriter, charts []template.HTML) htmlPage {
+	style, _ := htmlAssets.ReadFile("html/style.css")
+	script, _ := htmlAssets.ReadFile("html/script.js")
+	return htmlPage{
+		ProjectReport: s.f.report,
+		Structure:     s.f.structure,
+		Tree:          treeHTML(s.f.tree),
+		Charts:        charts,
+		Style:         template.CSS(style),
+		Script:        template.JS(script),
+	}
+}
+
+func (h *htmlStream) execute(s *StreamWriter, name string, data any) error {
+	if err := htmlTemplate.ExecuteTemplate(s.w, name, data); err != nil {
+		return fmt.Errorf("error executing template: %w", err)
+	}
+	return nil
+}
+
+// htmlFileData prepares a file for the page. Numbered lines are shown in a gutter
+// so that copying the code leaves the numbers out.
+func htmlFileData(file ReportFile) htmlFile {
+	data := htmlFile{
+		ReportFile: file,
+		ID:         fileID(file.Path),
+		Class:      strings.ToLower(strings.NewReplacer("#", "sharp", "+", "p", "/", "-", " ", "-").Replace(file.Language)),
+	}
+
+	// Numbering sets the start line of whole files, which are not a line range
+	notes := file
+	if file.Lines != nil && file.EndLine == 0 {
+		notes.StartLine = 0
+	}
+	data.Notes = fileNotes(notes)
+
+	content := file.Content
+	if file.Lines != nil {
+		content = strings.Join(file.Lines, "\n") + "\n"
+		numbers := make([]string, len(file.Lines))
+		for i := range file.Lines {
+			numbers[i] = fmt.Sprint(file.StartLine + i)
+		}
+		data.Gutter = strings.Join(numbers, "\n")
+	}
+	data.Code = highlight(file.Language, content)
+
+	return data
+}
+
+// fileID returns the anchor of a file in the page
+func fileID(path string) string {
+	sum := sha1.Sum([]byte(path))
+	return "f-" + hex.EncodeToString(sum[:6])
+}
+
+// treeHTML renders the project tree as nested <details> linking to the files
+func treeHTML(root *utils.Directory) template.HTML {
+	if root == nil {
+		return ""
+	}
+
+	var b strings.Builder
+	var walk func(dir *utils.Directory, prefix string, open bool)
+	walk = func(dir *utils.Directory, prefix string, open bool) {
+		if open {
+			b.WriteString("<details open>")
+		} else {
+			b.WriteString("<details>")
+		}
+		fmt.Fprintf(&b, "<summary>%s/</summary><ul>", html.EscapeString(dir.Name))
+
+		names := make([]string, 0, len(dir.SubDirs))
+		for name := range dir.SubDirs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			b.WriteString("<li>")
+			walk(dir.SubDirs[name], prefix+name+"/", false)
+			b.WriteString("</li>")
+		}
+
+		files := append([]string(nil), dir.Files...)
+		sort.Strings(files)
+		for _, file := range files {
+			name := filepath.Base(file)
+			fmt.Fprintf(&b, `<li><a href="#%s">%s</a></li>`, fileID(prefix+name), html.EscapeString(name))
+		}
+		b.WriteString("</ul></details>")
+	}
+	walk(root, "", true)
+
+	return template.HTML(b.String())
+}
+
+// chartBar is a bar of a horizontal bar chart
+type chartBar struct {
+	label string
+	value int
+}
+
+// maxChartBars is the number of bars of a chart, the rest being left out
+const maxChartBars = 10
+
+// fileTypesChart charts the number of files of each extension
+func fileTypesChart(report *ProjectReport) template.HTML {
+	bars := make([]chartBar, 0, len(report.FileTypes))
+	for _, fileType := range report.FileTypes {
+		bars = append(bars, chartBar{label: fileType.Extension, value: fileType.Count})
+	}
+	return barChart("File types", "files", bars)
+}
+
+// largestFilesChart charts the files with the most estimated tokens
+func largestFilesChart(tokens map[string]int) template.HTML {
+	bars := make([]chartBar, 0, len(tokens))
+	for path, count := range tokens {
+		bars = append(bars, chartBar{label: path, value: count})
+	}
+	return barChart("Largest files", "tokens", bars)
+}
+
+// barChart renders the largest bars as an inline SVG horizontal bar chart
+func barChart(title, unit string, bars []chartBar) template.HTML {
+	if len(bars) == 0 {
+		return ""
+	}
+	sort.Slice(bars, func(i, j int) bool {
+		if bars[i].value != bars[j].value {
+			return bars[i].value > bars[j].value
+		}
+		return bars[i].label < bars[j].label
+	})
+	if len(bars) > maxChartBars {
+		bars = bars[:maxChartBars]
+	}
+
+	const (
+		labelWidth = 220
+		barWidth   = 300
+		rowHeight  = 22
+	)
+	largest := max(1, bars[0].value)
+	height := len(bars)*rowHeight + 30
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<figure class="chart"><figcaption>%s</figcaption>`, html.EscapeString(title))
+	fmt.Fprintf(&b, `<svg viewBox="0 0 %d %d" width="%d" height="%d" role="img" aria-label="%s">`,
+		labelWidth+barWidth+80, height, labelWidth+barWidth+80, height, html.EscapeString(title))
+	for i, bar := range bars {
+		y := 10 + i*rowHeight
+		label := bar.label
+		if runes := []rune(label); len(runes) > 32 {
+			label = "…" + string(runes[len(runes)-31:])
+		}
+		width := max(1, bar.value*barWidth/largest)
+		units := unit
+		if bar.value == 1 {
+			units = strings.TrimSuffix(unit, "s")
+		}
+		fmt.Fprintf(&b, `<g><title>%s: %d %s</title>`, html.EscapeString(bar.label), bar.value, units)
+		fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="end" class="label">%s</text>`, labelWidth-8, y+14, html.EscapeString(label))
+		fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%d" height="%d" rx="3" class="bar"/>`, labelWidth, y+2, width, rowHeight-6)
+		fmt.Fprintf(&b, `<text x="%d" y="%d" class="value">%d</text></g>`, labelWidth+width+6, y+14, bar.value)
+	}
+	b.WriteString("</svg></figure>")
+
+	return template.HTML(b.String())
+}
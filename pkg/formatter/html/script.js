@@ -0,0 +1,87 @@
+(function () {
+  "use strict";
+
+  // copyText writes text to the clipboard, falling back on a hidden textarea where
+  // the clipboard API is unavailable (pages opened from file:// in some browsers)
+  function copyText(text) {
+    if (navigator.clipboard && window.isSecureContext) {
+      return navigator.clipboard.writeText(text);
+    }
+    return new Promise(function (resolve, reject) {
+      var area = document.createElement("textarea");
+      area.value = text;
+      area.style.position = "fixed";
+      area.style.opacity = "0";
+      document.body.appendChild(area);
+      area.select();
+      var ok = document.execCommand("copy");
+      document.body.removeChild(area);
+      if (ok) {
+        resolve();
+      } else {
+        reject(new Error("copy failed"));
+      }
+    });
+  }
+
+  function fileText(article) {
+    return article.querySelector("code").textContent;
+  }
+
+  // promptText rebuilds the whole prompt as plain text
+  function promptText() {
+    var parts = [];
+    var instructions = document.querySelector("#instructions pre");
+    if (instructions) {
+      parts.push(instructions.textContent.trim());
+    }
+    parts.push("PROJECT STRUCTURE:\n" + document.getElementById("structure").textContent);
+    document.querySelectorAll("article.file").forEach(function (article) {
+      parts.push("File: " + article.dataset.path + "\n```\n" + fileText(article).replace(/\n$/, "") + "\n```");
+    });
+    var question = document.querySelector("#question pre");
+    if (question) {
+      parts.push("QUESTION:\n" + question.textContent.trim());
+    }
+    return parts.join("\n\n") + "\n";
+  }
+
+  function flash(button, label) {
+    var original = button.textContent;
+    button.textContent = label;
+    button.classList.add("done");
+    setTimeout(function () {
+      button.textContent = original;
+      button.classList.remove("done");
+    }, 1500);
+  }
+
+  document.addEventListener("click", function (event) {
+    var button = event.target.closest("button");
+    if (!button) {
+      return;
+    }
+
+    if (button.dataset.tree) {
+      var open = button.dataset.tree === "open";
+      document.querySelectorAll(".sidebar details").forEach(function (details) {
+        details.open = open;
+      });
+      return;
+    }
+
+    var text;
+    if (button.dataset.copy === "prompt") {
+      text = promptText();
+    } else if (button.dataset.copy === "file") {
+      text = fileText(button.closest("article.file"));
+    } else {
+      return;
+    }
+    copyText(text).then(function () {
+      flash(button, "Copied");
+    }, function () {
+      flash(button, "Copy failed");
+    });
+  });
+})();
@@ -0,0 +1,212 @@
+package formatter
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/benoitpetit/prompt-my-project/pkg/summarizer"
+	"github.com/benoitpetit/prompt-my-project/pkg/truncate"
+	"github.com/benoitpetit/prompt-my-project/pkg/utils"
+)
+
+// jsonlProject is the first record of the jsonl format: the project metadata
+type jsonlProject struct {
+	Type          string        `json:"type"`
+	ProjectInfo   any           `json:"project_info"`
+	Part          *PartInfo     `json:"part,omitempty"`
+	Instructions  string        `json:"instructions,omitempty"`
+	Technologies  []string      `json:"technologies"`
+	KeyFiles      []string      `json:"key_files"`
+	Issues        []string      `json:"issues"`
+	FileTypes     any           `json:"file_types"`
+	RecentChanges []ChangedFile `json:"recent_changes,omitempty"`
+	Question      string        `json:"question,omitempty"`
+}
+
+// jsonlFile is the record of a single file
+type jsonlFile struct {
+	Type       string               `json:"type"`
+	Path       string               `json:"path"`
+	Language   string               `json:"language"`
+	Size       int64                `json:"size"`
+	SHA256     string               `json:"sha256"`
+	Tokens     int                  `json:"tokens"`
+	LineCount  int                  `json:"line_count"`
+	ModTime    *time.Time           `json:"mtime,omitempty"`
+	Encoding   string               `json:"encoding,omitempty"`
+	LastCommit *CommitInfo          `json:"last_commit,omitempty"`
+	Summarized bool                 `json:"summarized,omitempty"`
+	ChangeType string               `json:"change_type,omitempty"`
+	Truncated  *truncate.Truncation `json:"truncated,omitempty"`
+	StartLine  int                  `json:"start_line,omitempty"`
+	EndLine    int                  `json:"end_line,omitempty"`
+	Content    string               `json:"content,omitempty"`
+	Lines      []string             `json:"lines,omitempty"`
+}
+
+// jsonlStatistics is the last record, written once every file is known
+type jsonlStatistics struct {
+	Type         string   `json:"type"`
+	Statistics   any      `json:"statistics"`
+	OmittedFiles []string `json:"omitted_files,omitempty"`
+}
+
+// jsonlStream writes one JSON object per line so that the output can be consumed
+// record by record: the project, then each file, then the statistics
+type jsonlStream struct {
+	estimator *utils.TokenEstimator
+}
+
+func (j *jsonlStream) header(s *StreamWriter) error {
+	report := s.f.report
+	return writeJSONLine(s, jsonlProject{
+		Type:          "project",
+		ProjectInfo:   report.ProjectInfo,
+		Part:          report.Part,
+		Instructions:  report.Instructions,
+		Technologies:  report.Technologies,
+		KeyFiles:      report.KeyFiles,
+		Issues:        report.Issues,
+		FileTypes:     report.FileTypes,
+		RecentChanges: report.RecentChanges,
+		Question:      report.Question,
+	})
+}
+
+func (j *jsonlStream) file(s *StreamWriter, file ReportFile) error {
+	return writeJSONLine(s, jsonlFileRecord(file, j.estimator))
+}
+
+func (j *jsonlStream) footer(s *StreamWriter) error {
+	report := s.f.report
+	return writeJSONLine(s, jsonlStatistics{
+		Type:         "statistics",
+		Statistics:   report.Statistics,
+		OmittedFiles: report.OmittedFiles,
+	})
+}
+
+// jsonlFileRecord builds the record of a file. The hash and the token estimate are
+// those of the content, whether it is given as text or as numbered lines.
+func jsonlFileRecord(file ReportFile, estimator *utils.TokenEstimator) jsonlFile {
+	content := file.Content
+	if file.Lines != nil {
+		content = strings.Join(file.Lines, "\n")
+	}
+	sum := sha256.Sum256([]byte(content))
+
+	return jsonlFile{
+		Type:       "file",
+		Path:       file.Path,
+		Language:   file.Language,
+		Size:       file.Size,
+		SHA256:     hex.EncodeToString(sum[:]),
+		Tokens:     estimator.EstimateTokens(content, true),
+		LineCount:  file.LineCount,
+		ModTime:    file.ModTime,
+		Encoding:   file.Encoding,
+		LastCommit: file.LastCommit,
+		Summarized: file.Summarized,
+		ChangeType: file.ChangeType,
+		Truncated:  file.Truncated,
+		StartLine:  file.StartLine,
+		EndLine:    file.EndLine,
+		Content:    file.Content,
+		Lines:      file.Lines,
+	}
+}
+
+// writeJSONLine writes a record on its own line
+func writeJSONLine(s *StreamWriter, record any) error {
+	content, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("error formatting output: %w", err)
+	}
+	s.w.Write(content)
+	return s.w.WriteByte('\n')
+}
+
+// jsonlChunk is the record of a chunk of a file in the chunks format
+type jsonlChunk struct {
+	Type      string `json:"type"`
+	ID        string `json:"id"`
+	Path      string `json:"path"`
+	Language  string `json:"language"`
+	Symbol    string `json:"symbol,omitempty"`
+	Kind      string `json:"kind"`
+	Parent    string `json:"parent,omitempty"`
+	StartLine int    `json:"start_line"`
+	EndLine   int    `json:"end_line"`
+	Tokens    int    `json:"tokens"`
+	Content   string `json:"content"`
+}
+
+// chunksStream writes the jsonl records with each file split into chunks along its
+// declarations instead of a single file record
+type chunksStream struct {
+	jsonlStream
+	summarizer *summarizer.Summarizer
+	overlap    int
+}
+
+func (c *chunksStream) file(s *StreamWriter, file ReportFile) error {
+	for _, record := range c.chunkRecords(file) {
+		if err := writeJSONLine(s, record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// chunkRecords splits a file into chunk records. Summaries are not source code and
+// are split into windows of lines.
+func (c *chunksStream) chunkRecords(file ReportFile) []jsonlChunk {
+	opts := summarizer.ChunkOptions{Overlap: c.overlap}
+
+	var chunks []summarizer.Chunk
+	if file.Summarized {
+		chunks = summarizer.ChunkLines(file.Path, file.Content, opts)
+	} else {
+		chunks = c.summarizer.ChunkFile(file.Path, file.Content, opts)
+	}
+
+	// Chunks of a split part of a file are numbered from the first line of the part
+	offset := max(0, file.StartLine-1)
+
+	records := make([]jsonlChunk, len(chunks))
+	for i, chunk := range chunks {
+		records[i] = jsonlChunk{
+			Type:      "chunk",
+			ID:        chunk.ID,
+			Path:      file.Path,
+			Language:  file.Language,
+			Symbol:    chunk.Symbol,
+			Kind:      chunk.Kind,
+			Parent:    chunk.Parent,
+			StartLine: chunk.StartLine + offset,
+			EndLine:   chunk.EndLine + offset,
+			Tokens:    c.estimator.EstimateTokens(chunk.Content, true),
+			Content:   chunk.Content,
+		}
+	}
+	return records
+}
+
+// SetChunkOverlap repeats the given number of lines before each chunk of the chunks
+// format, so that a chunk retrieved alone keeps some of its context
+func (f *Formatter) SetChunkOverlap(lines int) {
+	f.chunkOverlap = max(0, lines)
+}
+
+// newChunksStream returns the encoder of the chunks format
+func (f *Formatter) newChunksStream() *chunksStream {
+	return &chunksStream{
+		jsonlStream: jsonlStream{estimator: utils.NewTokenEstimator()},
+		summarizer:  summarizer.NewSummarizer(),
+		overlap:     f.chunkOverlap,
+	}
+}
@@ -0,0 +1,59 @@
+package formatter
+
+import (
+	"fmt"
+	"strings"
+)
+
+// NumberLines prefixes every line of content with its right-aligned line number,
+// starting at startLine, so that models can cite precise path:line references
+func NumberLines(content string, startLine int) string {
+	if content == "" {
+		return content
+	}
+
+	startLine = max(1, startLine)
+	lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	width := len(fmt.Sprint(startLine + len(lines) - 1))
+
+	var numbered strings.Builder
+	numbered.Grow(len(content) + len(lines)*(width+3))
+	for i, line := range lines {
+		if line == "" {
+			numbered.WriteString(fmt.Sprintf("%*d |\n", width, startLine+i))
+		} else {
+			numbered.WriteString(fmt.Sprintf("%*d | %s\n", width, startLine+i, line))
+		}
+	}
+
+	if !strings.HasSuffix(content, "\n") {
+		return strings.TrimSuffix(numbered.String(), "\n")
+	}
+	return numbered.String()
+}
+
+// SetLineNumbers prefixes file contents with line numbers (txt, md, xml-docs and
+// templates) or gives them as an array of lines with a start line (json, xml)
+func (f *Formatter) SetLineNumbers(enabled bool) {
+	// Chunks already give their line range
+	f.lineNumbers = enabled && f.format != FormatChunks
+}
+
+// numberedFile returns the file as written with line numbers. Summaries and
+// truncated files are not numbered since their lines do not match the source file.
+func (f *Formatter) numberedFile(file ReportFile) ReportFile {
+	if file.Summarized || file.Truncated != nil || file.Content == "" {
+		return file
+	}
+
+	startLine := max(1, file.StartLine)
+	if f.tmpl != nil {
+		file.Content = NumberLines(file.Content, startLine)
+		return file
+	}
+
+	file.Lines = strings.Split(strings.TrimSuffix(file.Content, "\n"), "\n")
+	file.StartLine = startLine
+	file.Content = ""
+	return file
+}
@@ -0,0 +1,56 @@
+package formatter
+
+import "strings"
+
+// markdownLanguages maps the languages detected by the analyzer to code fence tags
+var markdownLanguages = map[string]string{
+	"Go":           "go",
+	"JavaScript":   "javascript",
+	"TypeScript":   "typescript",
+	"Python":       "python",
+	"Java":         "java",
+	"Ruby":         "ruby",
+	"PHP":          "php",
+	"C#":           "csharp",
+	"C":            "c",
+	"C++":          "cpp",
+	"C/C++ Header": "c",
+	"HTML":         "html",
+	"CSS":          "css",
+	"JSON":         "json",
+	"XML":          "xml",
+	"Markdown":     "markdown",
+	"Shell":        "bash",
+	"Batch":        "batch",
+	"SQL":          "sql",
+	"Plain Text":   "text",
+}
+
+// markdownFence wraps content in a fenced code block whose fence is longer than
+// any backtick run of the content, so the content can never close it early
+func markdownFence(language, content string) string {
+	fence := strings.Repeat("`", max(3, longestBacktickRun(content)+1))
+	return fence + language + "\n" + strings.TrimSuffix(content, "\n") + "\n" + fence
+}
+
+// longestBacktickRun returns the length of the longest sequence of backticks in s
+func longestBacktickRun(s string) int {
+	longest, current := 0, 0
+	for _, r := range s {
+		if r == '`' {
+			current++
+			longest = max(longest, current)
+		} else {
+			current = 0
+		}
+	}
+	return longest
+}
+
+// markdownLanguage returns the code fence tag of a detected language
+func markdownLanguage(language string) string {
+	if tag, ok := markdownLanguages[language]; ok {
+		return tag
+	}
+	return strings.ToLower(strings.ReplaceAll(language, " ", ""))
+}
@@ -0,0 +1,355 @@
+package formatter
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/benoitpetit/prompt-my-project/pkg/truncate"
+	"github.com/benoitpetit/prompt-my-project/pkg/utils"
+)
+
+// PartDelimiter separates the parts of a split prompt written to stdout
+const PartDelimiter = "\n<<<<< PMP PART BREAK >>>>>\n"
+
+// PartInfo locates a part within a split prompt
+type PartInfo struct {
+	Index        int    `json:"index" xml:"index"`
+	Total        int    `json:"total" xml:"total"`
+	Instructions string `json:"instructions" xml:"instructions"`
+}
+
+// splitSafetyMargin is the share of the budget kept free when chunking a file,
+// since the estimate of a chunk alone differs slightly from its rendered cost
+const splitSafetyMargin = 0.05
+
+// SetSplitTokens splits the output into parts of at most n tokens (0 = single output)
+func (f *Formatter) SetSplitTokens(n int) {
+	f.splitTokens = n
+}
+
+// IsSplit reports whether the output is split into several parts
+func (f *Formatter) IsSplit() bool {
+	return f.splitTokens > 0
+}
+
+// WriteParts writes each part of the split output to its own numbered file
+// (prompt_<ts>_part01.txt, ...) and returns their paths
+func (f *Formatter) WriteParts() ([]string, error) {
+	parts, err := f.renderParts()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(f.outputDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	width := max(2, len(fmt.Sprint(len(parts))))
+	paths := make([]string, 0, len(parts))
+	for i, content := range parts {
+		filename := fmt.Sprintf("%s_part%0*d.%s", f.outputBaseName(), width, i+1, f.extension())
+		outputPath := filepath.Join(f.outputDir, filename)
+		f.noteReplaced(outputPath)
+		if err := os.WriteFile(outputPath, content, 0644); err != nil {
+			return paths, fmt.Errorf("failed to write output file: %w", err)
+		}
+		paths = append(paths, outputPath)
+	}
+
+	return paths, nil
+}
+
+// renderParts renders the report as a sequence of parts, each one holding a compact
+// header, the project structure, as many whole files as the token budget allows and
+// continuation instructions. Files larger than a part are chunked on line boundaries.
+func (f *Formatter) renderParts() ([][]byte, error) {
+	estimator := utils.NewTokenEstimator()
+	countTokens := func(content []byte) int {
+		return estimator.EstimateTokens(string(content), true)
+	}
+
+	// Overhead of a part without files. Part numbers are as wide as the part count,
+	// which is only known once the files are packed: pack again if it is wider.
+	var groups [][]ReportFile
+	for digits := 1; ; {
+		widest := 1
+		for i := 0; i < digits; i++ {
+			widest *= 10
+		}
+		emptyPart, err := f.renderPart(nil, widest-1, widest-1)
+		if err != nil {
+			return nil, err
+		}
+		overhead := countTokens(emptyPart)
+		available := f.splitTokens - overhead
+		if available <= 0 {
+			return nil, fmt.Errorf("split budget too small: the header and project structure of a part need %d tokens (budget: %d)", overhead, f.splitTokens)
+		}
+
+		if groups, err = f.packFiles(available, estimator); err != nil {
+			return nil, err
+		}
+		if width := len(strconv.Itoa(len(groups))); width > digits {
+			digits = width
+			continue
+		}
+		break
+	}
+
+	// Moving files while checking the parts may add a part and widen the numbers of the
+	// parts already checked: check them all again until the count no longer changes
+	var parts [][]byte
+	for total := 0; total != len(groups); {
+		total = len(groups)
+		var err error
+		if groups, parts, err = f.fitGroups(groups, countTokens); err != nil {
+			return nil, err
+		}
+	}
+
+	return parts, nil
+}
+
+// packFiles packs files greedily into groups of at most available tokens,
+// chunking the ones that cannot fit in any group
+func (f *Formatter) packFiles(available int, estimator *utils.TokenEstimator) ([][]ReportFile, error) {
+	var groups [][]ReportFile
+	var current []ReportFile
+	used := 0
+	for _, file := range f.report.Files {
+		cost, err := f.fileTokens(file, estimator)
+		if err != nil {
+			return nil, err
+		}
+
+		pieces := []ReportFile{file}
+		if cost > available {
+			if pieces, err = f.chunkToFit(file, cost, available, estimator); err != nil {
+				return nil, err
+			}
+		}
+
+		for _, piece := range pieces {
+			pieceCost := cost
+			if len(pieces) > 1 {
+				if pieceCost, err = f.fileTokens(piece, estimator); err != nil {
+					return nil, err
+				}
+			}
+			if len(current) > 0 && used+pieceCost > available {
+				groups = append(groups, current)
+				current, used = nil, 0
+			}
+			current = append(current, piece)
+			used += pieceCost
+		}
+	}
+	if len(current) > 0 || len(groups) == 0 {
+		groups = append(groups, current)
+	}
+
+	return groups, nil
+}
+
+// fitGroups renders every group as a part, pushing the last file of an oversized
+// part to the next one, and returns the groups with their rendered parts
+func (f *Formatter) fitGroups(groups [][]ReportFile, countTokens func([]byte) int) ([][]ReportFile, [][]byte, error) {
+	var parts [][]byte
+	for i := 0; i < len(groups); i++ {
+		for {
+			content, err := f.renderPart(groups[i], i+1, len(groups))
+			if err != nil {
+				return nil, nil, err
+			}
+			if countTokens(content) <= f.splitTokens {
+				parts = append(parts, content)
+				break
+			}
+
+			// Move the last file to the next part, or halve a lone chunk
+			var moved []ReportFile
+			switch last := groups[i][len(groups[i])-1]; {
+			case len(groups[i]) > 1:
+				groups[i] = groups[i][:len(groups[i])-1]
+				moved = []ReportFile{last}
+			case len(groups[i]) == 1 && strings.Contains(last.Content, "\n"):
+				halves := splitInHalf(last)
+				groups[i] = halves[:1]
+				moved = halves[1:]
+			default:
+				fmt.Fprintf(os.Stderr, "Warning: part %d exceeds the split budget (a single line is larger than a part)\n", i+1)
+				parts = append(parts, content)
+			}
+			if moved == nil {
+				break
+			}
+
+			if i+1 == len(groups) {
+				groups = append(groups, nil)
+			}
+			groups[i+1] = append(moved, groups[i+1]...)
+		}
+	}
+
+	return groups, parts, nil
+}
+
+// renderPart renders one part of a split output
+func (f *Formatter) renderPart(files []ReportFile, index, total int) ([]byte, error) {
+	report := *f.report
+	report.Files = files
+	report.Part = &PartInfo{
+		Index:        index,
+		Total:        total,
+		Instructions: partInstructions(report.ProjectInfo.Name, index, total),
+	}
+
+	// Only the first part carries the instructions and the complete project
+	// overview, and only the last one asks the question
+	if index < total {
+		report.Question = ""
+	}
+	if index > 1 {
+		report.Instructions = ""
+		report.KeyFiles = nil
+		report.Issues = nil
+		report.FileTypes = nil
+		report.RecentChanges = nil
+		report.OmittedFiles = nil
+	}
+
+	part := *f
+	part.report = &report
+	return part.render()
+}
+
+// fileTokens estimates the rendered cost of a single file in the output format
+func (f *Formatter) fileTokens(file ReportFile, estimator *utils.TokenEstimator) (int, error) {
+	if f.lineNumbers {
+		plain := *f
+		plain.lineNumbers = false
+		return plain.fileTokens(f.numberedFile(file), estimator)
+	}
+	if f.tmpl != nil {
+		return f.templateFileTokens(file, estimator)
+	}
+
+	var content []byte
+	var err error
+
+	switch f.format {
+	case FormatJSON:
+		content, err = json.MarshalIndent(file, "    ", "  ")
+	case FormatJSONL:
+		content, err = json.Marshal(jsonlFileRecord(file, estimator))
+	case FormatChunks:
+		content, err = json.Marshal(f.newChunksStream().chunkRecords(file))
+	case FormatHTML:
+		var page bytes.Buffer
+		err = htmlTemplate.ExecuteTemplate(&page, "file", htmlFileData(file))
+		content = page.Bytes()
+	default: // FormatXML
+		content, err = xml.MarshalIndent(struct {
+			XMLName xml.Name `xml:"file"`
+			ReportFile
+		}{ReportFile: file}, "    ", "  ")
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error formatting output: %w", err)
+	}
+
+	return estimator.EstimateTokens(string(content), true), nil
+}
+
+// chunkToFit chunks a file whose rendered cost exceeds the tokens available in a part
+func (f *Formatter) chunkToFit(file ReportFile, cost, available int, estimator *utils.TokenEstimator) ([]ReportFile, error) {
+	// Rendered cost of the banner or markup around the content, line range included
+	empty := file
+	empty.Content = ""
+	empty.StartLine, empty.EndLine = 99999, 99999
+	emptyCost, err := f.fileTokens(empty, estimator)
+	if err != nil {
+		return nil, err
+	}
+
+	// Escaping makes the rendered content costlier than the raw content
+	rawTokens := estimator.EstimateTokens(file.Content, true)
+	ratio := 1.0
+	if contentCost := cost - emptyCost; contentCost > 0 && rawTokens > 0 {
+		ratio = float64(rawTokens) / float64(contentCost)
+	}
+
+	maxTokens := int(float64(available-emptyCost) * (1 - splitSafetyMargin) * ratio)
+	return chunkFile(file, max(1, maxTokens), estimator), nil
+}
+
+// chunkFile splits a file on line boundaries into pieces whose content holds at most
+// maxTokens tokens. A line longer than maxTokens gets a piece of its own.
+func chunkFile(file ReportFile, maxTokens int, estimator *utils.TokenEstimator) []ReportFile {
+	lines := truncate.SplitLines(file.Content)
+	startLine := max(1, file.StartLine)
+
+	var pieces []ReportFile
+	var chunk strings.Builder
+	chunkStart, chunkTokens := startLine, 0
+
+	flush := func(endLine int) {
+		piece := file
+		piece.Content = strings.TrimSuffix(chunk.String(), "\n")
+		piece.StartLine = chunkStart
+		piece.EndLine = endLine
+		pieces = append(pieces, piece)
+		chunk.Reset()
+		chunkStart, chunkTokens = endLine+1, 0
+	}
+
+	for i, line := range lines {
+		lineTokens := estimator.EstimateTokens(line, true)
+		if chunk.Len() > 0 && chunkTokens+lineTokens > maxTokens {
+			flush(startLine + i - 1)
+		}
+		chunk.WriteString(line)
+		chunkTokens += lineTokens
+	}
+	if chunk.Len() > 0 {
+		flush(startLine + len(lines) - 1)
+	}
+
+	return pieces
+}
+
+// splitInHalf splits a file or chunk into two pieces with the same number of lines
+func splitInHalf(file ReportFile) []ReportFile {
+	lines := truncate.SplitLines(file.Content)
+	half := len(lines) / 2
+	startLine := max(1, file.StartLine)
+
+	first, second := file, file
+	first.Content = strings.TrimSuffix(strings.Join(lines[:half], ""), "\n")
+	first.StartLine, first.EndLine = startLine, startLine+half-1
+	second.Content = strings.TrimSuffix(strings.Join(lines[half:], ""), "\n")
+	second.StartLine, second.EndLine = startLine+half, startLine+len(lines)-1
+
+	return []ReportFile{first, second}
+}
+
+// partInstructions tells the model how to handle a part of a split prompt
+func partInstructions(projectName string, index, total int) string {
+	if index < total {
+		return fmt.Sprintf("This is part %d of %d of the prompt for project %s. "+
+			"Do not answer yet: reply only with \"Part %d of %d received\" and wait for the next part.",
+			index, total, projectName, index, total)
+	}
+	if total == 1 {
+		return fmt.Sprintf("This is part 1 of 1 of the prompt for project %s. The whole project context has been sent.", projectName)
+	}
+	return fmt.Sprintf("This is part %d of %d, the last part of the prompt for project %s. "+
+		"All parts have been sent: use the context of every part to answer.",
+		index, total, projectName)
+}
@@ -0,0 +1,200 @@
+package formatter
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/benoitpetit/prompt-my-project/pkg/utils"
+)
+
+func TestRenderParts(t *testing.T) {
+	estimator := utils.NewTokenEstimator()
+
+	tests := []struct {
+		format      string
+		files       int
+		lines       int
+		splitTokens int
+		minParts    int
+	}{
+		{"json", 6, 20, 2000, 3},
+		{"xml", 6, 20, 2000, 3},
+		{"txt", 6, 20, 2000, 2},
+		{"json", 30, 5, 800, 10}, // Two-digit part numbers
+		{"xml", 1, 400, 1500, 2}, // A file larger than a part is chunked
+	}
+	for _, tt := range tests {
+		name := fmt.Sprintf("%s/%d files", tt.format, tt.files)
+		f := splitFormatter(tt.format, tt.files, tt.lines, tt.splitTokens)
+		parts, err := f.renderParts()
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if len(parts) < tt.minParts {
+			t.Errorf("%s: %d parts, want at least %d", name, len(parts), tt.minParts)
+		}
+
+		var files []ReportFile
+		for i, part := range parts {
+			if tokens := estimator.EstimateTokens(string(part), true); tokens > tt.splitTokens {
+				t.Errorf("%s: part %d has %d tokens", name, i+1, tokens)
+			}
+
+			var report ProjectReport
+			switch tt.format {
+			case "json":
+				err = json.Unmarshal(part, &report)
+			case "xml":
+				err = xml.Unmarshal(part, &report)
+			default:
+				if want := fmt.Sprintf("part %d of %d", i+1, len(parts)); !strings.Contains(string(part), want) {
+					err = fmt.Errorf("%q missing", want)
+				}
+			}
+			if err != nil {
+				t.Errorf("%s: part %d: %v", name, i+1, err)
+				continue
+			}
+			if tt.format != "txt" {
+				if report.Part == nil || report.Part.Index != i+1 || report.Part.Total != len(parts) {
+					t.Errorf("%s: part %d numbered %+v", name, i+1, report.Part)
+				}
+				files = append(files, report.Files...)
+			}
+		}
+		if tt.format == "txt" {
+			continue
+		}
+
+		// Files come in order and only a file larger than a part is cut, on line boundaries
+		var pieces []string
+		for i := 0; i < len(files); i++ {
+			content := files[i].Content
+			for files[i].StartLine > 0 && files[i].EndLine < tt.lines && i+1 < len(files) && files[i+1].Path == files[i].Path {
+				if files[i+1].StartLine != files[i].EndLine+1 {
+					t.Errorf("%s: %s lines %d-%d followed by %d", name, files[i].Path, files[i].StartLine, files[i].EndLine, files[i+1].StartLine)
+				}
+				i++
+				content += "\n" + files[i].Content
+			}
+			if tt.files > 1 && files[i].StartLine > 0 {
+				t.Errorf("%s: %s cut although it fits in a part", name, files[i].Path)
+			}
+			pieces = append(pieces, files[i].Path)
+			if content != splitContent(tt.lines) {
+				t.Errorf("%s: %s content changed", name, files[i].Path)
+			}
+		}
+		if len(pieces) != tt.files {
+			t.Errorf("%s: files %v", name, pieces)
+		}
+		for i, path := range pieces {
+			if want := fmt.Sprintf("file%02d.go", i); path != want {
+				t.Errorf("%s: file %d is %s, want %s", name, i, path, want)
+			}
+		}
+	}
+}
+
+func TestRenderPartsTrailingNewline(t *testing.T) {
+	f := NewFormatter("json", "", "project")
+	f.SetReproducible(time.Unix(0, 0))
+	f.SetSplitTokens(1500)
+	content := splitContent(400) + "\n"
+	f.AddFile(FileInfo{Path: "file.go", Size: int64(len(content)), Content: content, Language: "Go"})
+	parts, err := f.renderParts()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var pieces []string
+	var last ReportFile
+	for i, part := range parts {
+		var report ProjectReport
+		if err := json.Unmarshal(part, &report); err != nil {
+			t.Fatalf("part %d: %v", i+1, err)
+		}
+		for _, file := range report.Files {
+			if strings.HasSuffix(file.Content, "\n") {
+				t.Errorf("lines %d-%d end with a line feed", file.StartLine, file.EndLine)
+			}
+			pieces = append(pieces, file.Content)
+			last = file
+		}
+	}
+	if len(pieces) < 2 || last.EndLine != 400 {
+		t.Errorf("%d pieces, the last one ending at line %d, want 400", len(pieces), last.EndLine)
+	}
+	if strings.Join(pieces, "\n")+"\n" != content {
+		t.Error("content changed")
+	}
+
+	halves := splitInHalf(ReportFile{Path: "file.go", Content: content})
+	if halves[1].EndLine != 400 || strings.HasSuffix(halves[1].Content, "\n") {
+		t.Errorf("second half ends at line %d with %q", halves[1].EndLine, halves[1].Content[len(halves[1].Content)-5:])
+	}
+}
+
+func TestWriteToStdoutSplit(t *testing.T) {
+	f := splitFormatter("json", 6, 20, 2000)
+	parts, err := f.renderParts()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = writer
+	err = f.WriteToStdout()
+	os.Stdout = stdout
+	writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	written := strings.Split(string(output), PartDelimiter)
+	if len(written) != len(parts) || len(parts) < 2 {
+		t.Fatalf("%d parts written, %d rendered", len(written), len(parts))
+	}
+	for i := range parts {
+		if written[i] != string(parts[i]) {
+			t.Errorf("part %d differs from the rendered part", i+1)
+		}
+	}
+}
+
+// splitFormatter returns a reproducible formatter holding n files of the given lines,
+// split into parts of at most splitTokens tokens
+func splitFormatter(format string, n, lines, splitTokens int) *Formatter {
+	f := NewFormatter(format, "", "project")
+	f.SetReproducible(time.Unix(0, 0))
+	f.SetSplitTokens(splitTokens)
+	content := splitContent(lines)
+	for i := 0; i < n; i++ {
+		f.AddFile(FileInfo{Path: fmt.Sprintf("file%02d.go", i), Size: int64(len(content)), Content: content, Language: "Go"})
+	}
+	return f
+}
+
+// splitContent returns a file of the given number of lines
+func splitContent(lines int) string {
+	content := make([]string, lines)
+	for i := range content {
+		content[i] = fmt.Sprintf("var value%d = compute(%d) // line %d", i, i*i, i+1)
+	}
+	return strings.Join(content, "\n")
+}
@@ -0,0 +1,342 @@
+package formatter
+
+import (
+	"bufio"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+
+	"github.com/benoitpetit/prompt-my-project/pkg/utils"
+)
+
+// StreamWriter writes a report to an io.Writer piece by piece: the header, then each
+// file as soon as it is available, then the trailer with the statistics. Only the
+// file being written is held in memory, whatever the size of the project.
+type StreamWriter struct {
+	f       *Formatter
+	w       *bufio.Writer
+	enc     streamEncoder
+	files   []ReportFile // Every file when they are known before writing
+	written int          // Number of files written so far
+}
+
+// streamEncoder writes the pieces of an output format
+type streamEncoder interface {
+	header(s *StreamWriter) error
+	file(s *StreamWriter, file ReportFile) error
+	footer(s *StreamWriter) error
+}
+
+// NewStreamWriter returns a writer streaming the report to w in the output format.
+// Metadata (technologies, structure...) must be set before WriteHeader and the
+// statistics before Close.
+func (f *Formatter) NewStreamWriter(w io.Writer) *StreamWriter {
+	s := &StreamWriter{f: f, w: bufio.NewWriter(w)}
+
+	switch {
+	case f.tmpl != nil:
+		s.enc = &templateStream{}
+	case f.format == FormatJSON:
+		s.enc = &jsonStream{}
+	case f.format == FormatJSONL:
+		s.enc = &jsonlStream{estimator: utils.NewTokenEstimator()}
+	case f.format == FormatChunks:
+		s.enc = f.newChunksStream()
+	case f.format == FormatHTML:
+		s.enc = &htmlStream{}
+	default: // FormatXML
+		s.enc = &xmlStream{}
+	}
+
+	return s
+}
+
+// WriteHeader writes everything that comes before the files
+func (s *StreamWriter) WriteHeader() error {
+	return s.enc.header(s)
+}
+
+// WriteFile writes a single file
+func (s *StreamWriter) WriteFile(fileInfo FileInfo) error {
+	return s.writeReportFile(reportFile(fileInfo))
+}
+
+// Close writes the trailer and flushes the output. The underlying writer is not closed.
+func (s *StreamWriter) Close() error {
+	if err := s.enc.footer(s); err != nil {
+		return err
+	}
+	if err := s.w.Flush(); err != nil {
+		return fmt.Errorf("failed to write output: %w", err)
+	}
+	return nil
+}
+
+// writeReportFile writes a file of the report, with its line numbers if enabled
+func (s *StreamWriter) writeReportFile(file ReportFile) error {
+	if s.f.lineNumbers {
+		file = s.f.numberedFile(file)
+	}
+	if err := s.enc.file(s, file); err != nil {
+		return err
+	}
+	s.written++
+	return nil
+}
+
+// writeReport writes the whole report, with the files already added, to w
+func (f *Formatter) writeReport(w io.Writer) error {
+	s := f.NewStreamWriter(w)
+	s.files = f.report.Files
+
+	if err := s.WriteHeader(); err != nil {
+		return err
+	}
+	for _, file := range f.report.Files {
+		if err := s.writeReportFile(file); err != nil {
+			return err
+		}
+	}
+	return s.Close()
+}
+
+// templateStream executes the "header", "file" and "footer" templates in turn.
+// Templates without these blocks are executed once with every file at Close.
+type templateStream struct {
+	buffered []ReportFile
+}
+
+func (t *templateStream) streamable(s *StreamWriter) bool {
+	return s.f.tmpl.Lookup("header") != nil && s.f.tmpl.Lookup("file") != nil && s.f.tmpl.Lookup("footer") != nil
+}
+
+func (t *templateStream) header(s *StreamWriter) error {
+	if !t.streamable(s) {
+		return nil
+	}
+	return t.execute(s, "header", s.f.templateData(s.files))
+}
+
+func (t *templateStream) file(s *StreamWriter, file ReportFile) error {
+	if !t.streamable(s) {
+		t.buffered = append(t.buffered, file)
+		return nil
+	}
+	return t.execute(s, "file", TemplateFile{ReportFile: file, Index: s.written + 1, Notes: fileNotes(file)})
+}
+
+func (t *templateStream) footer(s *StreamWriter) error {
+	if !t.streamable(s) {
+		return t.execute(s, "", s.f.templateData(t.buffered))
+	}
+
+	data := s.f.templateData(s.files)
+	data.FilesWritten = s.written
+	return t.execute(s, "footer", data)
+}
+
+// execute runs a named template of the output template (the main one when name is empty)
+func (t *templateStream) execute(s *StreamWriter, name string, data any) error {
+	var err error
+	if name == "" {
+		err = s.f.tmpl.Execute(s.w, data)
+	} else {
+		err = s.f.tmpl.ExecuteTemplate(s.w, name, data)
+	}
+	if err != nil {
+		return fmt.Errorf("error executing template: %w", err)
+	}
+	return nil
+}
+
+// jsonStream writes the report as an indented JSON object whose "files" array is
+// written one element at a time. The statistics come last since they are only
+// known once every file has been processed.
+type jsonStream struct{}
+
+func (j *jsonStream) header(s *StreamWriter) error {
+	report := s.f.report
+
+	s.w.WriteString("{\n")
+	fields := []struct {
+		key   string
+		value any
+		skip  bool
+	}{
+		{"project_info", report.ProjectInfo, false},
+		{"part", report.Part, report.Part == nil},
+		{"instructions", report.Instructions, report.Instructions == ""},
+		{"technologies", report.Technologies, false},
+		{"key_files", report.KeyFiles, false},
+		{"issues", report.Issues, false},
+		{"file_types", report.FileTypes, false},
+		{"recent_changes", report.RecentChanges, len(report.RecentChanges) == 0},
+	}
+	for _, field := range fields {
+		if field.skip {
+			continue
+		}
+		if err := writeJSONField(s.w, field.key, field.value); err != nil {
+			return err
+		}
+		s.w.WriteString(",\n")
+	}
+	_, err := s.w.WriteString("  \"files\": [")
+	return err
+}
+
+func (j *jsonStream) file(s *StreamWriter, file ReportFile) error {
+	if s.written > 0 {
+		s.w.WriteString(",")
+	}
+	s.w.WriteString("\n    ")
+
+	content, err := json.MarshalIndent(file, "    ", "  ")
+	if err != nil {
+		return fmt.Errorf("error formatting output: %w", err)
+	}
+	_, err = s.w.Write(content)
+	return err
+}
+
+func (j *jsonStream) footer(s *StreamWriter) error {
+	report := s.f.report
+
+	if s.written > 0 {
+		s.w.WriteString("\n  ")
+	}
+	s.w.WriteString("]")
+
+	if len(report.OmittedFiles) > 0 {
+		s.w.WriteString(",\n")
+		if err := writeJSONField(s.w, "omitted_files", report.OmittedFiles); err != nil {
+			return err
+		}
+	}
+	if report.Question != "" {
+		s.w.WriteString(",\n")
+		if err := writeJSONField(s.w, "question", report.Question); err != nil {
+			return err
+		}
+	}
+	s.w.WriteString(",\n")
+	if err := writeJSONField(s.w, "statistics", report.Statistics); err != nil {
+		return err
+	}
+	_, err := s.w.WriteString("\n}")
+	return err
+}
+
+// writeJSONField writes a "key": value member of the top-level JSON object
+func writeJSONField(w *bufio.Writer, key string, value any) error {
+	content, err := json.MarshalIndent(value, "  ", "  ")
+	if err != nil {
+		return fmt.Errorf("error formatting output: %w", err)
+	}
+	fmt.Fprintf(w, "  %q: ", key)
+	_, err = w.Write(content)
+	return err
+}
+
+// xmlStream writes the report as an XML document, encoding each element as it comes
+type xmlStream struct {
+	enc *xml.Encoder
+	err error
+}
+
+func (x *xmlStream) header(s *StreamWriter) error {
+	report := s.f.report
+
+	s.w.WriteString(xml.Header)
+	x.enc = xml.NewEncoder(s.w)
+	x.enc.Indent("", "  ")
+
+	x.start("ProjectReport")
+	x.element("project_info", report.ProjectInfo)
+	if report.Part != nil {
+		x.element("part", report.Part)
+	}
+	if report.Instructions != "" {
+		x.element("instructions", report.Instructions)
+	}
+	x.list("technologies", "technology", report.Technologies)
+	x.list("key_files", "file", report.KeyFiles)
+	x.list("issues", "issue", report.Issues)
+	if report.FileTypes != nil {
+		x.start("file_types")
+		for _, fileType := range report.FileTypes {
+			x.element("type", fileType)
+		}
+		x.end("file_types")
+	}
+	if report.RecentChanges != nil {
+		x.start("recent_changes")
+		for _, change := range report.RecentChanges {
+			x.element("file", change)
+		}
+		x.end("recent_changes")
+	}
+	x.start("files")
+
+	return x.flush()
+}
+
+func (x *xmlStream) file(s *StreamWriter, file ReportFile) error {
+	x.element("file", file)
+	return x.flush()
+}
+
+func (x *xmlStream) footer(s *StreamWriter) error {
+	report := s.f.report
+
+	x.end("files")
+	x.list("omitted_files", "file", report.OmittedFiles)
+	if report.Question != "" {
+		x.element("question", report.Question)
+	}
+	x.element("statistics", report.Statistics)
+	x.end("ProjectReport")
+
+	return x.flush()
+}
+
+// start, end and element keep the first encoding error, returned by flush
+func (x *xmlStream) start(name string) {
+	x.keep(x.enc.EncodeToken(xml.StartElement{Name: xml.Name{Local: name}}))
+}
+
+func (x *xmlStream) end(name string) {
+	x.keep(x.enc.EncodeToken(xml.EndElement{Name: xml.Name{Local: name}}))
+}
+
+func (x *xmlStream) element(name string, value any) {
+	x.keep(x.enc.EncodeElement(value, xml.StartElement{Name: xml.Name{Local: name}}))
+}
+
+func (x *xmlStream) keep(err error) {
+	if x.err == nil {
+		x.err = err
+	}
+}
+
+// list writes a parent element wrapping items, like the "parent>child" field tags
+// (an empty but non-nil list is written as an empty parent)
+func (x *xmlStream) list(parent, child string, items []string) {
+	if items == nil {
+		return
+	}
+	x.start(parent)
+	for _, item := range items {
+		x.element(child, item)
+	}
+	x.end(parent)
+}
+
+func (x *xmlStream) flush() error {
+	x.keep(x.enc.Flush())
+	if x.err != nil {
+		return fmt.Errorf("error formatting output: %w", x.err)
+	}
+	return nil
+}
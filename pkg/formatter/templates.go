@@ -0,0 +1,203 @@
+package formatter
+
+import (
+	"bytes"
+	"embed"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/benoitpetit/prompt-my-project/pkg/utils"
+)
+
+// builtinTemplates holds the templates of the textual output formats
+//
+//go:embed templates/*.tmpl
+var builtinTemplates embed.FS
+
+// TemplateData is the data given to output templates: the report fields
+// (.ProjectInfo, .Instructions, .Technologies, .Statistics...) plus the rendered structure
+type TemplateData struct {
+	*ProjectReport
+	Files           []TemplateFile // Files of the report, with their position
+	Structure       string         // Project tree
+	FileTypeSummary []string       // File types as "ext (count)", sorted
+	FilesWritten    int            // Number of files written before the footer
+}
+
+// TemplateFile is a file as seen by output templates
+type TemplateFile struct {
+	ReportFile
+	Index int      // 1-based position of the file in the output
+	Notes []string // How the file appears: line range, recent change, summary
+}
+
+// BuiltinTemplateNames returns the names of the templates shipped in the binary
+func BuiltinTemplateNames() []string {
+	entries, err := builtinTemplates.ReadDir("templates")
+	if err != nil {
+		return nil
+	}
+
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, strings.TrimSuffix(entry.Name(), ".tmpl"))
+	}
+	return names
+}
+
+// BuiltinTemplate returns the source of a built-in template, to be copied and adapted
+func BuiltinTemplate(name string) (string, error) {
+	content, err := builtinTemplates.ReadFile("templates/" + name + ".tmpl")
+	if err != nil {
+		return "", fmt.Errorf("unknown template %q (available: %s)", name, strings.Join(BuiltinTemplateNames(), ", "))
+	}
+	return string(content), nil
+}
+
+// SetTemplate renders the output with a user-defined text/template file instead of
+// the output format. The output extension is taken from the template filename
+// (report.md.tmpl writes .md files) and defaults to txt.
+func (f *Formatter) SetTemplate(path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read template: %w", err)
+	}
+
+	tmpl, err := template.New(filepath.Base(path)).Funcs(templateFuncs(f.projectDir)).Parse(string(content))
+	if err != nil {
+		return fmt.Errorf("invalid template %s: %w", path, err)
+	}
+
+	f.tmpl = tmpl
+	f.templateExt = "txt"
+	if ext := filepath.Ext(strings.TrimSuffix(filepath.Base(path), ".tmpl")); ext != "" {
+		f.templateExt = strings.TrimPrefix(ext, ".")
+	}
+	return nil
+}
+
+// builtinTemplate parses the built-in template of a textual format
+func builtinTemplate(format OutputFormat, projectDir string) *template.Template {
+	name := string(format)
+	content, err := builtinTemplates.ReadFile("templates/" + name + ".tmpl")
+	if err != nil {
+		name = string(FormatTXT)
+		content, _ = builtinTemplates.ReadFile("templates/txt.tmpl")
+	}
+	return template.Must(template.New(name).Funcs(templateFuncs(projectDir)).Parse(string(content)))
+}
+
+// templateFileTokens estimates the rendered cost of a single file with the "file"
+// template, or from the difference it makes to the whole output without one
+func (f *Formatter) templateFileTokens(file ReportFile, estimator *utils.TokenEstimator) (int, error) {
+	if f.tmpl.Lookup("file") != nil {
+		var content bytes.Buffer
+		if err := f.tmpl.ExecuteTemplate(&content, "file", TemplateFile{ReportFile: file, Index: 1, Notes: fileNotes(file)}); err != nil {
+			return 0, fmt.Errorf("error executing template: %w", err)
+		}
+		return estimator.EstimateTokens(content.String(), true), nil
+	}
+
+	with, err := f.renderPart([]ReportFile{file}, 1, 1)
+	if err != nil {
+		return 0, err
+	}
+	without, err := f.renderPart(nil, 1, 1)
+	if err != nil {
+		return 0, err
+	}
+	return max(0, estimator.EstimateTokens(string(with), true)-estimator.EstimateTokens(string(without), true)), nil
+}
+
+// templateData prepares the report for the output template. When the output is
+// streamed, files are not known before writing and files is empty.
+func (f *Formatter) templateData(files []ReportFile) TemplateData {
+	data := TemplateData{
+		ProjectReport: f.report,
+		Files:         make([]TemplateFile, len(files)),
+		Structure:     f.structure,
+		FilesWritten:  len(files),
+	}
+
+	for i, file := range files {
+		data.Files[i] = TemplateFile{ReportFile: file, Index: i + 1, Notes: fileNotes(file)}
+	}
+	for _, fileType := range f.report.FileTypes {
+		data.FileTypeSummary = append(data.FileTypeSummary, fmt.Sprintf("%s (%d)", fileType.Extension, fileType.Count))
+	}
+	sort.Strings(data.FileTypeSummary)
+
+	return data
+}
+
+// templateFuncs returns the helper functions available in output templates
+func templateFuncs(projectDir string) template.FuncMap {
+	estimator := utils.NewTokenEstimator()
+
+	return template.FuncMap{
+		// fence wraps content in a Markdown code block that the content cannot close
+		"fence": markdownFence,
+		// lang converts a detected language to a Markdown code fence tag
+		"lang": markdownLanguage,
+		// tokens estimates the number of tokens of a text
+		"tokens": func(text string) int {
+			return estimator.EstimateTokens(text, true)
+		},
+		// truncate keeps the first n characters of a text
+		"truncate": func(n int, text string) string {
+			runes := []rune(text)
+			if len(runes) <= n {
+				return text
+			}
+			return string(runes[:n]) + "..."
+		},
+		// indent prefixes every non-empty line with n spaces
+		"indent": func(n int, text string) string {
+			lines := strings.Split(text, "\n")
+			for i, line := range lines {
+				if line != "" {
+					lines[i] = strings.Repeat(" ", n) + line
+				}
+			}
+			return strings.Join(lines, "\n")
+		},
+		// relpath returns a path relative to the project directory
+		"relpath": func(path string) string {
+			if !filepath.IsAbs(path) {
+				return filepath.ToSlash(path)
+			}
+			if rel, err := filepath.Rel(projectDir, path); err == nil {
+				return filepath.ToSlash(rel)
+			}
+			return path
+		},
+		"join":      strings.Join,
+		"add":       func(a, b int) int { return a + b },
+		"cdata":     cdata,
+		"cdatatext": cdataText,
+		"xmlescape": func(text string) string {
+			var escaped strings.Builder
+			xml.EscapeText(&escaped, []byte(text))
+			return escaped.String()
+		},
+	}
+}
+
+// cdata wraps text in a CDATA section
+func cdata(text string) string {
+	if text == "" {
+		return ""
+	}
+	return "<![CDATA[" + cdataText(text) + "]]>"
+}
+
+// cdataText escapes text written inside a CDATA section: a "]]>" would end the
+// section, so it is split across two sections
+func cdataText(text string) string {
+	return strings.ReplaceAll(text, "]]>", "]]]]><![CDATA[>")
+}
@@ -2,11 +2,15 @@ package git
 
 import (
 	"fmt"
+	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/go-git/go-git/v5/utils/merkletrie"
 )
 
 // ChangeType represents the type of change in a file
@@ -20,9 +24,10 @@ const (
 
 // FileChange represents a file that has been changed
 type FileChange struct {
-	Path       string
-	ChangeType ChangeType
-	IsStaged   bool
+	Path        string
+	ChangeType  ChangeType
+	IsStaged    bool
+	IsCommitted bool // Changed by a recent commit rather than in the worktree or index
 }
 
 // ChangesAnalyzer analyzes git changes in a repository
@@ -32,9 +37,10 @@ type ChangesAnalyzer struct {
 	worktree *git.Worktree
 }
 
-// NewChangesAnalyzer creates a new git changes analyzer
+// NewChangesAnalyzer creates a new git changes analyzer.
+// The project path may be any directory inside the repository.
 func NewChangesAnalyzer(projectPath string) (*ChangesAnalyzer, error) {
-	repo, err := git.PlainOpen(projectPath)
+	repo, err := git.PlainOpenWithOptions(projectPath, &git.PlainOpenOptions{DetectDotGit: true})
 	if err != nil {
 		return nil, fmt.Errorf("not a git repository: %w", err)
 	}
@@ -46,11 +52,16 @@ func NewChangesAnalyzer(projectPath string) (*ChangesAnalyzer, error) {
 
 	return &ChangesAnalyzer{
 		repo:     repo,
-		repoPath: projectPath,
+		repoPath: worktree.Filesystem.Root(),
 		worktree: worktree,
 	}, nil
 }
 
+// RepoPath returns the root directory of the repository worktree
+func (ca *ChangesAnalyzer) RepoPath() string {
+	return ca.repoPath
+}
+
 // GetChangedFiles returns all files that have been modified, added, or staged
 func (ca *ChangesAnalyzer) GetChangedFiles() ([]FileChange, error) {
 	status, err := ca.worktree.Status()
@@ -102,6 +113,7 @@ func (ca *ChangesAnalyzer) GetChangedFiles() ([]FileChange, error) {
 			changes = append(changes, change)
 		}
 	}
+	sortChanges(changes)
 
 	return changes, nil
 }
@@ -125,36 +137,37 @@ func (ca *ChangesAnalyzer) GetRecentCommitsFiles(numCommits int) ([]FileChange,
 	}
 
 	var commits []*object.Commit
-	count := 0
 	err = commitIter.ForEach(func(c *object.Commit) error {
-		if count < numCommits {
-			commits = append(commits, c)
-			count++
+		if len(commits) >= numCommits {
+			return storer.ErrStop
 		}
+		commits = append(commits, c)
 		return nil
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to iterate commits: %w", err)
 	}
 
-	changedFilesMap := make(map[string]bool)
-
-	for i, commit := range commits {
-		var parentTree *object.Tree
-
-		if i < len(commits)-1 {
-			parentTree, _ = commits[i+1].Tree()
-		}
+	changedFilesMap := make(map[string]ChangeType)
 
+	for _, commit := range commits {
 		currentTree, err := commit.Tree()
 		if err != nil {
 			continue
 		}
 
+		// Diff against the first parent; a root commit adds every file of its tree
+		var parentTree *object.Tree
+		if parent, err := commit.Parent(0); err == nil {
+			parentTree, _ = parent.Tree()
+		}
+
 		if parentTree == nil {
 			err = currentTree.Files().ForEach(func(f *object.File) error {
 				absPath := filepath.Join(ca.repoPath, f.Name)
-				changedFilesMap[absPath] = true
+				if _, exists := changedFilesMap[absPath]; !exists {
+					changedFilesMap[absPath] = ChangeTypeAdded
+				}
 				return nil
 			})
 			if err != nil {
@@ -174,22 +187,39 @@ func (ca *ChangesAnalyzer) GetRecentCommitsFiles(numCommits int) ([]FileChange,
 					path = change.From.Name
 				}
 
-				if path != "" {
-					absPath := filepath.Join(ca.repoPath, path)
-					changedFilesMap[absPath] = true
+				if path == "" {
+					continue
+				}
+
+				// Commits are visited newest first, so the most recent change wins
+				absPath := filepath.Join(ca.repoPath, path)
+				if _, exists := changedFilesMap[absPath]; exists {
+					continue
+				}
+
+				changeType := ChangeTypeModified
+				if action, err := change.Action(); err == nil {
+					switch action {
+					case merkletrie.Insert:
+						changeType = ChangeTypeAdded
+					case merkletrie.Delete:
+						changeType = ChangeTypeDeleted
+					}
 				}
+				changedFilesMap[absPath] = changeType
 			}
 		}
 	}
 
 	var changes []FileChange
-	for path := range changedFilesMap {
+	for path, changeType := range changedFilesMap {
 		changes = append(changes, FileChange{
-			Path:       path,
-			ChangeType: ChangeTypeModified,
-			IsStaged:   false,
+			Path:        path,
+			ChangeType:  changeType,
+			IsCommitted: true,
 		})
 	}
+	sortChanges(changes)
 
 	return changes, nil
 }
@@ -210,7 +240,7 @@ func (ca *ChangesAnalyzer) GetAllChangedFiles(includeRecentCommits bool, numComm
 	if includeRecentCommits && numCommits > 0 {
 		recentChanges, err := ca.GetRecentCommitsFiles(numCommits)
 		if err != nil {
-			fmt.Printf("Warning: failed to get recent commits: %v\n", err)
+			fmt.Fprintf(os.Stderr, "Warning: failed to get recent commits: %v\n", err)
 		} else {
 			for _, change := range recentChanges {
 				if _, exists := changedFilesMap[change.Path]; !exists {
@@ -224,10 +254,18 @@ func (ca *ChangesAnalyzer) GetAllChangedFiles(includeRecentCommits bool, numComm
 	for _, change := range changedFilesMap {
 		allChanges = append(allChanges, change)
 	}
+	sortChanges(allChanges)
 
 	return allChanges, nil
 }
 
+// sortChanges sorts changes by path so that results are stable between runs
+func sortChanges(changes []FileChange) {
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+}
+
 // IsGitRepository checks if the given path is a git repository
 func IsGitRepository(projectPath string) bool {
 	_, err := git.PlainOpen(projectPath)
@@ -294,6 +332,7 @@ func FormatChangeSummary(changes []FileChange, repoPath string) string {
 
 	staged := 0
 	unstaged := 0
+	committed := 0
 
 	for _, change := range changes {
 		relPath, err := filepath.Rel(repoPath, change.Path)
@@ -302,7 +341,10 @@ func FormatChangeSummary(changes []FileChange, repoPath string) string {
 		}
 
 		status := ""
-		if change.IsStaged {
+		if change.IsCommitted {
+			status = "[committed]"
+			committed++
+		} else if change.IsStaged {
 			status = "[staged]"
 			staged++
 		} else {
@@ -313,7 +355,7 @@ func FormatChangeSummary(changes []FileChange, repoPath string) string {
 		sb.WriteString(fmt.Sprintf("  %s %s (%s)\n", status, relPath, change.ChangeType))
 	}
 
-	sb.WriteString(fmt.Sprintf("\nSummary: %d staged, %d unstaged\n", staged, unstaged))
+	sb.WriteString(fmt.Sprintf("\nSummary: %d staged, %d unstaged, %d committed\n", staged, unstaged, committed))
 
 	return sb.String()
 }
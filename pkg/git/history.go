@@ -0,0 +1,153 @@
+package git
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+)
+
+// CommitInfo describes the last commit that changed a file
+type CommitInfo struct {
+	Hash   string
+	Author string
+	Date   time.Time
+}
+
+// LastCommits returns the last commit that changed each of the files, by absolute
+// path, in a single walk of the history from a revision (HEAD when empty). Like git
+// log, a merge only counts for the files it changed compared to every parent. Files
+// that are not tracked at the revision are left out.
+func (ca *ChangesAnalyzer) LastCommits(rev string, paths []string) (map[string]CommitInfo, error) {
+	if rev == "" {
+		rev = "HEAD"
+	}
+	from, err := ca.repo.ResolveRevision(plumbing.Revision(rev))
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %w", rev, err)
+	}
+	tip, err := ca.repo.CommitObject(*from)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get commit: %w", err)
+	}
+	tipTree, err := tip.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tree: %w", err)
+	}
+
+	// Files still to be found, by path relative to the repository root
+	pending := make(map[string]string, len(paths))
+	for _, path := range paths {
+		relPath, err := filepath.Rel(ca.repoPath, path)
+		if err != nil {
+			continue
+		}
+		relPath = filepath.ToSlash(relPath)
+		if _, err := tipTree.FindEntry(relPath); err == nil {
+			pending[relPath] = path
+		}
+	}
+
+	result := make(map[string]CommitInfo, len(pending))
+	if len(pending) == 0 {
+		return result, nil
+	}
+
+	commitIter, err := ca.repo.Log(&git.LogOptions{From: *from, Order: git.LogOrderCommitterTime})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get commit log: %w", err)
+	}
+
+	err = commitIter.ForEach(func(commit *object.Commit) error {
+		changed, err := changedFiles(commit, pending)
+		if err != nil {
+			return err
+		}
+		// Commits are visited newest first, so the first change found is the last one
+		for _, relPath := range changed {
+			result[pending[relPath]] = CommitInfo{
+				Hash:   commit.Hash.String(),
+				Author: commit.Author.Name,
+				Date:   commit.Author.When,
+			}
+			delete(pending, relPath)
+		}
+		if len(pending) == 0 {
+			return storer.ErrStop
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to iterate commits: %w", err)
+	}
+
+	return result, nil
+}
+
+// changedFiles returns the pending files that a commit changed compared to each of
+// its parents. A root commit adds every file of its tree.
+func changedFiles(commit *object.Commit, pending map[string]string) ([]string, error) {
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	if commit.NumParents() == 0 {
+		var added []string
+		for relPath := range pending {
+			if _, err := tree.FindEntry(relPath); err == nil {
+				added = append(added, relPath)
+			}
+		}
+		return added, nil
+	}
+
+	parents := make([]*object.Tree, 0, commit.NumParents())
+	err = commit.Parents().ForEach(func(parent *object.Commit) error {
+		parentTree, err := parent.Tree()
+		if err != nil {
+			return err
+		}
+		parents = append(parents, parentTree)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	changes, err := parents[0].Diff(tree)
+	if err != nil {
+		return nil, err
+	}
+
+	var changed []string
+	for _, change := range changes {
+		relPath := change.To.Name
+		if _, ok := pending[relPath]; !ok {
+			continue
+		}
+		if sameInAnyParent(tree, parents[1:], relPath) {
+			continue // Brought by a merged branch, which is walked too
+		}
+		changed = append(changed, relPath)
+	}
+	return changed, nil
+}
+
+// sameInAnyParent reports whether a file of the tree is identical in one of the parents
+func sameInAnyParent(tree *object.Tree, parents []*object.Tree, relPath string) bool {
+	entry, err := tree.FindEntry(relPath)
+	if err != nil {
+		return false
+	}
+	for _, parent := range parents {
+		if parentEntry, err := parent.FindEntry(relPath); err == nil && parentEntry.Hash == entry.Hash {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,292 @@
+package secrets
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Pattern is a kind of secret recognized by a regular expression. When the
+// expression has a group named "secret", only that group is the secret and the
+// rest of the match (e.g. the name of the variable) is kept.
+type Pattern struct {
+	Name     string // Description used in reports (e.g. "AWS Access Key")
+	Type     string // Identifier used in redactions (e.g. "aws-access-key")
+	Severity string // critical, high, medium or low
+	Regexp   *regexp.Regexp
+
+	files func(path string) bool  // Files the pattern applies to (all files if nil)
+	valid func(match string) bool // Filters out the matches that are not secrets
+}
+
+// Applies reports whether the pattern must be searched for in a file
+func (p Pattern) Applies(path string) bool {
+	return p.files == nil || p.files(path)
+}
+
+// Patterns are the credentials searched for by the security analysis and the prompt
+var Patterns = []Pattern{
+	// API Keys
+	{Name: "AWS Access Key", Type: "aws-access-key", Severity: "critical",
+		Regexp: regexp.MustCompile(`(?i)aws[_-]?access[_-]?key[_-]?id['"\s]*[:=]\s*['"]?(?P<secret>[A-Z0-9]{20})['"]?`)},
+	{Name: "AWS Access Key", Type: "aws-access-key", Severity: "critical",
+		Regexp: regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{Name: "AWS Secret Key", Type: "aws-secret-key", Severity: "critical",
+		Regexp: regexp.MustCompile(`(?i)aws[_-]?secret[_-]?access[_-]?key['"\s]*[:=]\s*['"]?(?P<secret>[A-Za-z0-9/+=]{40})['"]?`)},
+	{Name: "GitHub Token", Type: "github-token", Severity: "critical",
+		Regexp: regexp.MustCompile(`(?i)gh[pousr]_[A-Za-z0-9_]{36,}`)},
+	{Name: "Generic API Key", Type: "api-key", Severity: "critical",
+		Regexp: regexp.MustCompile(`(?i)api[_-]?key['"\s]*[:=]\s*['"](?P<secret>[A-Za-z0-9_\-]{20,})['"]`)},
+
+	// Private Keys, up to the end of the key (or of the file when it is truncated)
+	{Name: "Private Key", Type: "private-key", Severity: "critical",
+		Regexp: regexp.MustCompile(`-----BEGIN\s+(?:(?:RSA|DSA|EC|OPENSSH|PGP|ENCRYPTED)\s+)?PRIVATE\s+KEY(?:\s+BLOCK)?-----(?:[\s\S]*?-----END[A-Z ]*PRIVATE KEY(?:\s+BLOCK)?-----|[\s\S]*)`)},
+
+	// Passwords
+	{Name: "Password in Code", Type: "password", Severity: "high",
+		Regexp: regexp.MustCompile(`(?i)(?:password|passwd|pwd)['"\s]*[:=]\s*['"](?P<secret>[^'"]{8,})['"]`)},
+
+	// Tokens
+	{Name: "JWT Token", Type: "jwt", Severity: "critical",
+		Regexp: regexp.MustCompile(`eyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}`)},
+	{Name: "Bearer Token", Type: "bearer-token", Severity: "critical",
+		Regexp: regexp.MustCompile(`(?i)bearer\s+(?P<secret>[A-Za-z0-9_\-\.=]{20,})`)},
+	{Name: "Slack Token", Type: "slack-token", Severity: "critical",
+		Regexp: regexp.MustCompile(`xox[baprs]-[0-9]{12}-[0-9]{12}-[A-Za-z0-9]{24}`)},
+	{Name: "Stripe Key", Type: "stripe-key", Severity: "critical",
+		Regexp: regexp.MustCompile(`(?i)(?:sk|pk)_(?:test|live)_[A-Za-z0-9]{24,}`)},
+
+	// Database Credentials
+	{Name: "Database URL", Type: "database-password", Severity: "critical",
+		Regexp: regexp.MustCompile(`(?i)(?:postgres(?:ql)?|mysql|mongodb(?:\+srv)?|redis|amqp)://[^:/\s]+:(?P<secret>[^@\s]+)@`)},
+
+	// OAuth
+	{Name: "OAuth Client Secret", Type: "client-secret", Severity: "critical",
+		Regexp: regexp.MustCompile(`(?i)client[_-]?secret['"\s]*[:=]\s*['"](?P<secret>[A-Za-z0-9_\-]{20,})['"]`)},
+
+	// Generic Secrets
+	{Name: "Secret in Code", Type: "secret", Severity: "high",
+		Regexp: regexp.MustCompile(`(?i)secret['"\s]*[:=]\s*['"](?P<secret>[A-Za-z0-9_\-]{16,})['"]`)},
+	{Name: "Secret in Environment File", Type: "env-secret", Severity: "high",
+		Regexp: regexp.MustCompile(`(?m)^[ \t]*(?:export[ \t]+)?[A-Za-z0-9_]*(?i:secret|token|password|passwd|pwd|api_?key|private_?key|credentials?|auth)[A-Za-z0-9_]*[ \t]*=[ \t]*['"]?(?P<secret>[^\s'"#]+)`),
+		files:  isEnvFile},
+}
+
+// privacyPatterns are the personal data and unknown keys redacted from the prompt in
+// addition to the credentials
+var privacyPatterns = []Pattern{
+	{Name: "Email Address", Type: "email", Severity: "low",
+		Regexp: regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9\-]+(?:\.[A-Za-z0-9\-]+)*\.[A-Za-z]{2,}`),
+		valid:  isPersonalEmail},
+	{Name: "IP Address", Type: "ip-address", Severity: "low",
+		Regexp: regexp.MustCompile(`(?:^|[^\w.])(?P<secret>(?:\d{1,3}\.){3}\d{1,3})(?:$|[^\w.]|\.(?:$|\D))`),
+		valid:  isPublicIP},
+	{Name: "High-Entropy String", Type: "high-entropy", Severity: "medium",
+		Regexp: regexp.MustCompile("(?m)(?:['\"`]|[:=][ \t]*)(?P<secret>[A-Za-z0-9+/_\\-]{24,}={0,2})(?:['\"`,;]|\\s|$)"),
+		files:  func(path string) bool { return !lockFiles[strings.ToLower(filepath.Base(path))] },
+		valid:  isHighEntropy},
+}
+
+// Mode is what the prompt does with the secrets found in the files
+type Mode int
+
+const (
+	Redact Mode = iota // Replace secrets with [REDACTED:<type>]
+	Block              // Refuse to write the prompt
+	Allow              // Keep secrets as is
+)
+
+// ParseMode parses a mode name: redact, block or allow
+func ParseMode(name string) (Mode, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "redact":
+		return Redact, nil
+	case "block":
+		return Block, nil
+	case "allow":
+		return Allow, nil
+	default:
+		return Redact, fmt.Errorf("unknown secret mode %q (available: redact, block, allow)", name)
+	}
+}
+
+// Finding is a secret found in a file
+type Finding struct {
+	Type       string
+	Line       int // 1-based
+	start, end int
+}
+
+// Scanner finds credentials, email addresses, public IP addresses and high-entropy
+// strings in file contents
+type Scanner struct {
+	patterns []Pattern
+}
+
+// NewScanner creates a scanner with the credential and privacy patterns
+func NewScanner() *Scanner {
+	patterns := make([]Pattern, 0, len(Patterns)+len(privacyPatterns))
+	patterns = append(patterns, Patterns...)
+	patterns = append(patterns, privacyPatterns...)
+	return &Scanner{patterns: patterns}
+}
+
+// Scan returns the secrets of a file, in order. When matches of several patterns
+// overlap, the first pattern wins.
+func (s *Scanner) Scan(path, content string) []Finding {
+	type match struct {
+		Finding
+		priority int
+	}
+
+	var matches []match
+	for priority, pattern := range s.patterns {
+		if !pattern.Applies(path) {
+			continue
+		}
+		group := pattern.Regexp.SubexpIndex("secret")
+		for _, loc := range pattern.Regexp.FindAllStringSubmatchIndex(content, -1) {
+			start, end := loc[0], loc[1]
+			if group > 0 {
+				if loc[2*group] < 0 {
+					continue
+				}
+				start, end = loc[2*group], loc[2*group+1]
+			}
+			if pattern.valid != nil && !pattern.valid(content[start:end]) {
+				continue
+			}
+			matches = append(matches, match{Finding{Type: pattern.Type, start: start, end: end}, priority})
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].start != matches[j].start {
+			return matches[i].start < matches[j].start
+		}
+		return matches[i].priority < matches[j].priority
+	})
+
+	var findings []Finding
+	line, counted := 1, 0
+	for _, m := range matches {
+		if len(findings) > 0 && m.start < findings[len(findings)-1].end {
+			continue
+		}
+		line += strings.Count(content[counted:m.start], "\n")
+		counted = m.start
+		m.Line = line
+		findings = append(findings, m.Finding)
+	}
+	return findings
+}
+
+// Replace replaces the secrets found in a content with [REDACTED:<type>]. With
+// keepLines, the line breaks of a secret (e.g. a private key) are kept after it so
+// that line numbers still match the source file.
+func Replace(content string, findings []Finding, keepLines bool) string {
+	if len(findings) == 0 {
+		return content
+	}
+
+	var result strings.Builder
+	result.Grow(len(content))
+	position := 0
+	for _, f := range findings {
+		result.WriteString(content[position:f.start])
+		result.WriteString("[REDACTED:" + f.Type + "]")
+		if keepLines {
+			result.WriteString(strings.Repeat("\n", strings.Count(content[f.start:f.end], "\n")))
+		}
+		position = f.end
+	}
+	result.WriteString(content[position:])
+	return result.String()
+}
+
+// lockFiles hold checksums, which look like random strings but are not secrets
+var lockFiles = map[string]bool{
+	"go.sum": true, "package-lock.json": true, "npm-shrinkwrap.json": true, "yarn.lock": true,
+	"pnpm-lock.yaml": true, "cargo.lock": true, "poetry.lock": true, "pipfile.lock": true,
+	"composer.lock": true, "gemfile.lock": true, "flake.lock": true, "bun.lock": true,
+}
+
+// isEnvFile reports whether a file holds environment variables (.env, .env.local, prod.env)
+func isEnvFile(path string) bool {
+	name := strings.ToLower(filepath.Base(path))
+	return name == ".env" || strings.HasPrefix(name, ".env.") || strings.HasSuffix(name, ".env")
+}
+
+// isPersonalEmail excludes the reserved example domains and the git@host form of
+// SSH remotes
+func isPersonalEmail(email string) bool {
+	at := strings.LastIndexByte(email, '@')
+	if email[:at] == "git" {
+		return false
+	}
+	domain := strings.ToLower(email[at+1:])
+	for _, reserved := range []string{"example.com", "example.org", "example.net", "localhost"} {
+		if domain == reserved || strings.HasSuffix(domain, "."+reserved) {
+			return false
+		}
+	}
+	return true
+}
+
+// documentationNets are reserved for examples (RFC 5737)
+var documentationNets = []*net.IPNet{
+	{IP: net.IPv4(192, 0, 2, 0), Mask: net.CIDRMask(24, 32)},
+	{IP: net.IPv4(198, 51, 100, 0), Mask: net.CIDRMask(24, 32)},
+	{IP: net.IPv4(203, 0, 113, 0), Mask: net.CIDRMask(24, 32)},
+}
+
+// isPublicIP keeps the addresses that can identify a host: private, loopback and
+// documentation addresses are not redacted
+func isPublicIP(address string) bool {
+	ip := net.ParseIP(address)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsMulticast() || ip.Equal(net.IPv4bcast) {
+		return false
+	}
+	for _, documentation := range documentationNets {
+		if documentation.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// isHighEntropy recognizes random keys: quoted or assigned strings of letters and
+// digits whose Shannon entropy is close to the maximum for their length. Hexadecimal hashes (4 bits per
+// character at most), identifiers and long encoded blobs are not redacted.
+func isHighEntropy(s string) bool {
+	if len(s) > 128 {
+		return false
+	}
+
+	var letters, digits bool
+	counts := make(map[rune]int)
+	for _, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			digits = true
+		case r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z':
+			letters = true
+		}
+		counts[r]++
+	}
+	if !letters || !digits {
+		return false
+	}
+
+	entropy := 0.0
+	for _, count := range counts {
+		p := float64(count) / float64(len(s))
+		entropy -= p * math.Log2(p)
+	}
+	return entropy >= math.Min(4.5, 0.9*math.Log2(float64(len(s))))
+}
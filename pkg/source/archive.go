@@ -0,0 +1,450 @@
+package source
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Extensions of the supported archives
+var archiveExtensions = []string{".zip", ".tar.gz", ".tgz", ".tar"}
+
+// archiveSeparator separates an archive from a path inside it, as in pkg.zip!/src
+const archiveSeparator = "!/"
+
+// IsArchive reports whether a file is a supported archive, from its extension
+func IsArchive(name string) bool {
+	return archiveExtension(name) != ""
+}
+
+// archiveExtension returns the archive extension of a file name, or an empty string
+func archiveExtension(name string) string {
+	lower := strings.ToLower(name)
+	for _, ext := range archiveExtensions {
+		if strings.HasSuffix(lower, ext) {
+			return ext
+		}
+	}
+	return ""
+}
+
+// archiveName returns the name of an archive without its directory and extension
+func archiveName(name string) string {
+	name = path.Base(name)
+	return name[:len(name)-len(archiveExtension(name))]
+}
+
+// Archive is a .zip, .tar.gz or .tar archive read in place, without extracting it.
+// Zip entries are decompressed on demand; tar entries, which can only be read in
+// sequence, and nested archives are copied to a temporary file when the archive is
+// opened, so that only their index is held in memory. Symbolic links and entries
+// outside of the archive root are left out. When every entry is under a single
+// top-level directory, as in release-1.0/..., that directory is the root.
+type Archive struct {
+	fs.FS
+	target  string // Archive path, followed by the path inside it if any
+	name    string
+	closers []io.Closer
+}
+
+// OpenArchive opens an archive, or a directory or an archive inside an archive when
+// the path continues after "!/": pkg.zip!/src, vendor.tar.gz!/lib/dep.zip!/src...
+// Paths inside an archive are relative to its root, with or without the top-level
+// directory.
+func OpenArchive(target string) (*Archive, error) {
+	segments := archiveSegments(target)
+	archivePath := filepath.FromSlash(segments[0])
+	root, closer, err := openArchive(archivePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", archivePath, err)
+	}
+	a := &Archive{FS: root, target: target, name: archiveName(segments[0]), closers: []io.Closer{closer}}
+
+	location := archivePath
+	for i, segment := range segments[1:] {
+		name, info, err := root.lookup(strings.Trim(segment, "/"))
+		if err != nil {
+			a.Close()
+			return nil, fmt.Errorf("%s does not exist in %s", segment, location)
+		}
+		location += archiveSeparator + segment
+
+		switch {
+		case info.IsDir() && i == len(segments)-2:
+			if a.FS, err = fs.Sub(a.FS, name); err != nil {
+				a.Close()
+				return nil, err
+			}
+			a.name = path.Base(name)
+		case IsArchive(name):
+			if root, closer, err = openNestedArchive(a.FS, name); err != nil {
+				a.Close()
+				return nil, fmt.Errorf("failed to read %s: %w", location, err)
+			}
+			a.FS, a.name = root, archiveName(name)
+			a.closers = append(a.closers, closer)
+		default:
+			a.Close()
+			return nil, fmt.Errorf("%s is not a supported archive (%s)", location, strings.Join(archiveExtensions, ", "))
+		}
+	}
+	return a, nil
+}
+
+// archiveSegments splits a path inside an archive into the archive and the paths of
+// the nested directories or archives, ignoring a trailing "!/"
+func archiveSegments(target string) []string {
+	target = strings.TrimSuffix(strings.TrimSuffix(filepath.ToSlash(target), "/"), "!")
+	return strings.Split(target, archiveSeparator)
+}
+
+// archiveRoot is the tree of an archive, from its top-level directory if it has one
+type archiveRoot struct {
+	fs.FS
+	top string // Top-level directory, empty if the archive has none
+}
+
+// lookup finds a path of the archive, relative to its root or to the archive itself
+// when it starts with the top-level directory, and returns it relative to the root
+func (r *archiveRoot) lookup(name string) (string, fs.FileInfo, error) {
+	name = path.Clean(name)
+	info, err := fs.Stat(r.FS, name)
+	if err != nil && r.top != "" && (name == r.top || strings.HasPrefix(name, r.top+"/")) {
+		if name = strings.TrimPrefix(strings.TrimPrefix(name, r.top), "/"); name == "" {
+			name = "."
+		}
+		info, err = fs.Stat(r.FS, name)
+	}
+	return name, info, err
+}
+
+// openArchive reads the entries of an archive on disk, returning what must be closed
+// once they are no longer read
+func openArchive(archivePath string) (*archiveRoot, io.Closer, error) {
+	if archiveExtension(archivePath) == ".zip" {
+		reader, err := zip.OpenReader(archivePath)
+		if err != nil && !errors.Is(err, zip.ErrInsecurePath) {
+			return nil, nil, err
+		}
+		return readZip(&reader.Reader), reader, nil
+	}
+
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+	return readTar(archivePath, file)
+}
+
+// openNestedArchive reads the entries of an archive inside another one. A zip archive
+// is copied to a temporary file first, to be read at random.
+func openNestedArchive(fsys fs.FS, name string) (*archiveRoot, io.Closer, error) {
+	file, err := fsys.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+	if archiveExtension(name) != ".zip" {
+		return readTar(name, file)
+	}
+
+	sp, err := newSpool()
+	if err != nil {
+		return nil, nil, err
+	}
+	content, err := sp.add(file)
+	if err != nil {
+		sp.Close()
+		return nil, nil, err
+	}
+	reader, err := zip.NewReader(content, content.Size())
+	if err != nil && !errors.Is(err, zip.ErrInsecurePath) {
+		sp.Close()
+		return nil, nil, err
+	}
+	return readZip(reader), sp, nil
+}
+
+// readZip indexes the regular files of a zip archive, decompressed when they are
+// opened. Entries with an absolute path or one outside of the archive, reported by
+// zip.ErrInsecurePath, are left out like in tar archives.
+func readZip(reader *zip.Reader) *archiveRoot {
+	mfs := newMemFS()
+	for _, file := range reader.File {
+		mode := file.Mode()
+		switch {
+		case mode.IsDir():
+			mfs.addDir(file.Name, file.Modified)
+		case mode.IsRegular():
+			mfs.addFile(file.Name, &memEntry{mode: mode.Perm(), modTime: file.Modified, size: int64(file.UncompressedSize64), zipFile: file})
+		}
+	}
+	return mfs.root()
+}
+
+// readTar copies the regular files of a tar archive, gzipped unless it is a .tar, to
+// a temporary file, returned to be closed once they are no longer read
+func readTar(name string, r io.Reader) (*archiveRoot, io.Closer, error) {
+	if archiveExtension(name) != ".tar" {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	sp, err := newSpool()
+	if err != nil {
+		return nil, nil, err
+	}
+	mfs := newMemFS()
+	reader := tar.NewReader(r)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return mfs.root(), sp, nil
+		}
+		if err != nil {
+			sp.Close()
+			return nil, nil, err
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			mfs.addDir(header.Name, header.ModTime)
+		case tar.TypeReg:
+			content, err := sp.add(reader)
+			if err != nil {
+				sp.Close()
+				return nil, nil, err
+			}
+			mfs.addFile(header.Name, &memEntry{mode: header.FileInfo().Mode().Perm(), modTime: header.ModTime, size: content.Size(), content: content})
+		}
+	}
+}
+
+// spool is a temporary file the entries of an archive are copied to, one after the
+// other, and read back at random
+type spool struct {
+	file *os.File
+	size int64
+}
+
+func newSpool() (*spool, error) {
+	file, err := os.CreateTemp("", "pmp-archive-*")
+	if err != nil {
+		return nil, err
+	}
+	return &spool{file: file}, nil
+}
+
+// add copies the content of an entry at the end of the spool and returns where it is
+func (sp *spool) add(r io.Reader) (*io.SectionReader, error) {
+	n, err := io.Copy(sp.file, r)
+	if err != nil {
+		return nil, err
+	}
+	content := io.NewSectionReader(sp.file, sp.size, n)
+	sp.size += n
+	return content, nil
+}
+
+// Close removes the temporary file
+func (sp *spool) Close() error {
+	sp.file.Close()
+	return os.Remove(sp.file.Name())
+}
+
+// memFS is the tree of the entries of an archive, held in memory
+type memFS struct {
+	entries map[string]*memEntry
+}
+
+// memEntry is a file or a directory of a memFS. The content of a file is either in
+// a spool or the zip entry it is decompressed from.
+type memEntry struct {
+	name     string // Path in the tree
+	mode     fs.FileMode
+	modTime  time.Time
+	size     int64
+	content  *io.SectionReader
+	zipFile  *zip.File
+	children []string // Names of the entries of a directory, sorted when listed
+}
+
+func newMemFS() *memFS {
+	return &memFS{entries: map[string]*memEntry{".": {name: ".", mode: fs.ModeDir | 0755}}}
+}
+
+// entryPath cleans the path of an archive entry, reporting false for an absolute
+// path or one outside of the archive
+func entryPath(name string) (string, bool) {
+	name = path.Clean(strings.TrimPrefix(name, "./"))
+	return name, fs.ValidPath(name) && name != "."
+}
+
+// addFile adds a file and its parent directories
+func (m *memFS) addFile(name string, entry *memEntry) {
+	var ok bool
+	if entry.name, ok = entryPath(name); ok {
+		m.add(entry)
+	}
+}
+
+// addDir adds a directory and its parents
+func (m *memFS) addDir(name string, modTime time.Time) {
+	if dir, ok := entryPath(name); ok {
+		m.mkdirAll(dir, modTime)
+	}
+}
+
+// add adds an entry with a valid path and its parent directories
+func (m *memFS) add(entry *memEntry) {
+	if _, exists := m.entries[entry.name]; exists {
+		return // The first entry of a path wins
+	}
+	parent := path.Dir(entry.name)
+	m.mkdirAll(parent, entry.modTime)
+	m.entries[entry.name] = entry
+	m.entries[parent].children = append(m.entries[parent].children, path.Base(entry.name))
+}
+
+// mkdirAll adds a directory and its parents
+func (m *memFS) mkdirAll(dir string, modTime time.Time) {
+	if _, exists := m.entries[dir]; exists {
+		return
+	}
+	m.add(&memEntry{name: dir, mode: fs.ModeDir | 0755, modTime: modTime})
+}
+
+// root returns the tree from the top-level directory when it holds every entry
+func (m *memFS) root() *archiveRoot {
+	if children := m.entries["."].children; len(children) == 1 && m.entries[children[0]].mode.IsDir() {
+		top, _ := fs.Sub(m, children[0])
+		return &archiveRoot{FS: top, top: children[0]}
+	}
+	return &archiveRoot{FS: m}
+}
+
+// Open opens a file or a directory
+func (m *memFS) Open(name string) (fs.File, error) {
+	entry, err := m.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if entry.mode.IsDir() {
+		entries, err := m.ReadDir(name)
+		if err != nil {
+			return nil, err
+		}
+		return &memDir{entry: entry, dirEntries: dirEntries{entries: entries}}, nil
+	}
+	if entry.zipFile == nil {
+		// Each open file reads the spool from its own offset
+		content := io.NewSectionReader(entry.content, 0, entry.size)
+		return &memFile{entry: entry, ReadCloser: io.NopCloser(content)}, nil
+	}
+	reader, err := entry.zipFile.Open()
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return &memFile{entry: entry, ReadCloser: reader}, nil
+}
+
+// ReadDir lists the entries of a directory, sorted by name
+func (m *memFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entry, err := m.lookup("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if !entry.mode.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	sort.Strings(entry.children)
+	entries := make([]fs.DirEntry, len(entry.children))
+	for i, child := range entry.children {
+		entries[i] = fs.FileInfoToDirEntry(m.entries[path.Join(name, child)])
+	}
+	return entries, nil
+}
+
+// Stat describes a file or a directory
+func (m *memFS) Stat(name string) (fs.FileInfo, error) {
+	return m.lookup("stat", name)
+}
+
+// lookup finds the entry of a path
+func (m *memFS) lookup(op, name string) (*memEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	entry, ok := m.entries[name]
+	if !ok {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	return entry, nil
+}
+
+func (e *memEntry) Name() string       { return path.Base(e.name) }
+func (e *memEntry) Size() int64        { return e.size }
+func (e *memEntry) Mode() fs.FileMode  { return e.mode }
+func (e *memEntry) ModTime() time.Time { return e.modTime }
+func (e *memEntry) IsDir() bool        { return e.mode.IsDir() }
+func (e *memEntry) Sys() any           { return nil }
+
+// memFile is an open file of a memFS
+type memFile struct {
+	io.ReadCloser
+	entry *memEntry
+}
+
+func (f *memFile) Stat() (fs.FileInfo, error) { return f.entry, nil }
+
+// memDir is an open directory of a memFS
+type memDir struct {
+	entry *memEntry
+	dirEntries
+}
+
+func (d *memDir) Stat() (fs.FileInfo, error) { return d.entry, nil }
+func (d *memDir) Close() error               { return nil }
+
+func (d *memDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.entry.name, Err: fs.ErrInvalid}
+}
+
+// Name returns the name of the archive without its extension, or that of the
+// directory or nested archive the path inside it leads to
+func (a *Archive) Name() string {
+	return a.name
+}
+
+// Dir returns an empty string: the files of an archive are not on disk
+func (a *Archive) Dir() string {
+	return ""
+}
+
+// Key identifies a file by the archive, its path, size and modification time
+func (a *Archive) Key(name string, info fs.FileInfo) string {
+	return fmt.Sprintf("%s!/%s:%d:%d", a.target, name, info.Size(), info.ModTime().UnixNano())
+}
+
+// Close closes the archive and removes its temporary files
+func (a *Archive) Close() error {
+	var errs []error
+	for _, closer := range a.closers {
+		errs = append(errs, closer.Close())
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,221 @@
+package source
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+var archiveTime = time.Unix(1700000000, 0)
+
+func TestArchive(t *testing.T) {
+	files := map[string]string{
+		"main.go":          "package main\n",
+		"pkg/a.go":         "package pkg\n",
+		"pkg/sub/b.go":     "package sub\n",
+		"docs/README.md":   "# Docs\n",
+		"../outside.go":    "package outside\n",
+		"/etc/absolute.go": "package absolute\n",
+		"link.go":          "-> main.go",
+	}
+	dir := t.TempDir()
+	zipPath := writeFile(t, dir, "project.zip", zipData(t, files))
+	tgzPath := writeFile(t, dir, "project.tar.gz", tarGzData(t, files))
+
+	for _, path := range []string{zipPath, tgzPath} {
+		archive, err := OpenArchive(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer archive.Close()
+
+		if archive.Name() != "project" {
+			t.Errorf("%s: name %q", path, archive.Name())
+		}
+		if err := fstest.TestFS(archive, "main.go", "pkg/a.go", "pkg/sub/b.go", "docs/README.md"); err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		for _, name := range []string{"link.go", "outside.go", "etc/absolute.go"} {
+			if _, err := fs.Stat(archive, name); err == nil {
+				t.Errorf("%s: %s exists", path, name)
+			}
+		}
+		info, err := fs.Stat(archive, "pkg/a.go")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() != int64(len("package pkg\n")) || !info.ModTime().Equal(archiveTime) {
+			t.Errorf("%s: pkg/a.go size %d, modified %v", path, info.Size(), info.ModTime())
+		}
+	}
+}
+
+func TestArchivePaths(t *testing.T) {
+	dep := zipData(t, map[string]string{"dep-2.0/x.go": "package x\n"})
+	release := tarGzData(t, map[string]string{
+		"release-1.0/README.md":   "# Release\n",
+		"release-1.0/src/a.go":    "package src\n",
+		"release-1.0/lib/dep.zip": string(dep),
+	})
+	archivePath := writeFile(t, t.TempDir(), "release.tar.gz", release)
+
+	tests := []struct {
+		target string
+		name   string
+		files  []string
+	}{
+		{"", "release", []string{"README.md", "src/a.go", "lib/dep.zip"}},
+		{"!/src", "src", []string{"a.go"}},
+		{"!/release-1.0/src/", "src", []string{"a.go"}},
+		{"!/lib/dep.zip", "dep", []string{"x.go"}},
+		{"!/lib/dep.zip!/", "dep", []string{"x.go"}},
+	}
+	for _, tt := range tests {
+		src, err := Open(archivePath+tt.target, "")
+		if err != nil {
+			t.Errorf("%s: %v", tt.target, err)
+			continue
+		}
+		defer src.Close()
+		if src.Name() != tt.name {
+			t.Errorf("%s: name %q, want %q", tt.target, src.Name(), tt.name)
+		}
+		if err := fstest.TestFS(src, tt.files...); err != nil {
+			t.Errorf("%s: %v", tt.target, err)
+		}
+	}
+
+	for _, target := range []string{"!/missing", "!/README.md", "!/src!/a.go"} {
+		if _, err := Open(archivePath+target, ""); err == nil {
+			t.Errorf("%s: opened", target)
+		}
+	}
+}
+
+func TestArchiveLargeEntry(t *testing.T) {
+	const large = 64 << 20
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+
+	// A tar.gz of a large, highly compressed entry, inside a zip
+	var tgz bytes.Buffer
+	gz := gzip.NewWriter(&tgz)
+	writer := tar.NewWriter(gz)
+	writer.WriteHeader(&tar.Header{Name: "data.bin", Typeflag: tar.TypeReg, Mode: 0644, Size: large, ModTime: archiveTime})
+	io.Copy(writer, io.LimitReader(zeros{}, large))
+	writer.WriteHeader(&tar.Header{Name: "main.go", Typeflag: tar.TypeReg, Mode: 0644, Size: 13, ModTime: archiveTime})
+	writer.Write([]byte("package main\n"))
+	writer.Close()
+	gz.Close()
+	dir := t.TempDir()
+	tgzPath := writeFile(t, dir, "large.tar.gz", tgz.Bytes())
+	zipPath := writeFile(t, dir, "outer.zip", zipData(t, map[string]string{"inner.tar.gz": tgz.String()}))
+
+	for _, target := range []string{tgzPath, zipPath + "!/inner.tar.gz"} {
+		var before, after runtime.MemStats
+		runtime.GC()
+		runtime.ReadMemStats(&before)
+		src, err := Open(target, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		runtime.GC()
+		runtime.ReadMemStats(&after)
+		if grown := int64(after.HeapAlloc) - int64(before.HeapAlloc); grown > large/4 {
+			t.Errorf("%s: %d bytes held in memory", target, grown)
+		}
+
+		file, err := src.Open("data.bin")
+		if err != nil {
+			t.Fatal(err)
+		}
+		n, err := io.Copy(io.Discard, file)
+		file.Close()
+		if err != nil || n != large {
+			t.Errorf("%s: read %d bytes, %v", target, n, err)
+		}
+		if data, err := fs.ReadFile(src, "main.go"); err != nil || string(data) != "package main\n" {
+			t.Errorf("%s: main.go %q, %v", target, data, err)
+		}
+
+		// The temporary files are removed when the archive is closed
+		if err := src.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if entries, _ := os.ReadDir(tmp); len(entries) > 0 {
+			t.Errorf("%s: %d temporary files left", target, len(entries))
+		}
+	}
+}
+
+// zeros reads as an endless run of zero bytes
+type zeros struct{}
+
+func (zeros) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+func zipData(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+	for name, content := range files {
+		if strings.HasPrefix(name, "/") || strings.HasPrefix(name, "..") {
+			continue // Rejected by zip.Writer
+		}
+		header := &zip.FileHeader{Name: name, Method: zip.Deflate, Modified: archiveTime}
+		if strings.HasPrefix(content, "-> ") {
+			header.SetMode(fs.ModeSymlink | 0777)
+			content = strings.TrimPrefix(content, "-> ")
+		}
+		w, err := writer.CreateHeader(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func tarGzData(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	writer := tar.NewWriter(gz)
+	writer.WriteHeader(&tar.Header{Name: "./", Typeflag: tar.TypeDir, Mode: 0755, ModTime: archiveTime})
+	for name, content := range files {
+		if strings.HasPrefix(content, "-> ") {
+			writer.WriteHeader(&tar.Header{Name: "./" + name, Typeflag: tar.TypeSymlink, Linkname: strings.TrimPrefix(content, "-> "), ModTime: archiveTime})
+			continue
+		}
+		writer.WriteHeader(&tar.Header{Name: "./" + name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(content)), ModTime: archiveTime})
+		writer.Write([]byte(content))
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func writeFile(t *testing.T, dir, name string, data []byte) string {
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
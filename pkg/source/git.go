@@ -0,0 +1,280 @@
+package source
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// GitTree is the tree of a directory at a git revision, read from the object store
+// without checking it out. Symbolic links and submodules are left out. Every file
+// has the date of the commit as modification time.
+type GitTree struct {
+	name    string
+	dir     string // Directory in the worktree, empty for a remote repository
+	repo    *git.Repository
+	tree    *object.Tree
+	commit  plumbing.Hash
+	modTime time.Time
+}
+
+// OpenGitRef returns the tree of a directory at a revision of the repository that
+// contains it: a commit hash (possibly abbreviated), a branch, a tag or any
+// revision understood by git rev-parse such as HEAD~2
+func OpenGitRef(dir, ref string) (*GitTree, error) {
+	repo, err := git.PlainOpenWithOptions(dir, &git.PlainOpenOptions{DetectDotGit: true})
+	if err != nil {
+		return nil, fmt.Errorf("not a git repository: %w", err)
+	}
+	gt, err := newGitTree(repo, ref)
+	if err != nil {
+		return nil, err
+	}
+	gt.name = filepath.Base(filepath.Clean(dir))
+	gt.dir = dir
+
+	// The directory is looked up in the tree by its path in the worktree
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get worktree: %w", err)
+	}
+	relDir, err := worktreePath(worktree.Filesystem.Root(), dir)
+	if err != nil {
+		return nil, err
+	}
+	if relDir != "." {
+		gt.tree, err = gt.tree.Tree(relDir)
+		if err != nil {
+			return nil, fmt.Errorf("%s does not exist at %s", relDir, ref)
+		}
+	}
+	return gt, nil
+}
+
+// newGitTree returns the tree of the repository at a revision
+func newGitTree(repo *git.Repository, ref string) (*GitTree, error) {
+	hash, err := repo.ResolveRevision(plumbing.Revision(ref))
+	if err != nil {
+		return nil, fmt.Errorf("unknown revision %q: %w", ref, err)
+	}
+	commit, err := repo.CommitObject(*hash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get commit %s: %w", hash, err)
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tree of %s: %w", hash, err)
+	}
+	return &GitTree{repo: repo, tree: tree, commit: *hash, modTime: commit.Committer.When}, nil
+}
+
+// worktreePath returns the slash-separated path of a directory relative to the root
+// of the worktree
+func worktreePath(root, dir string) (string, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	// Resolve symlinks so that paths are comparable with the worktree root
+	if resolved, err := filepath.EvalSymlinks(absDir); err == nil {
+		absDir = resolved
+	}
+	if resolved, err := filepath.EvalSymlinks(root); err == nil {
+		root = resolved
+	}
+	rel, err := filepath.Rel(root, absDir)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is outside of the worktree %s", dir, root)
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// Name returns the name of the directory or of the repository
+func (gt *GitTree) Name() string {
+	return gt.name
+}
+
+// Dir returns the directory of the project in the worktree, or an empty string for
+// a remote repository
+func (gt *GitTree) Dir() string {
+	return gt.dir
+}
+
+// Commit returns the hash of the commit the tree comes from
+func (gt *GitTree) Commit() string {
+	return gt.commit.String()
+}
+
+// Close does nothing: objects are read on demand and a remote repository is held in
+// memory
+func (gt *GitTree) Close() error {
+	return nil
+}
+
+// Key identifies a file by its path and the hash of its content
+func (gt *GitTree) Key(name string, info fs.FileInfo) string {
+	if hash, ok := info.Sys().(plumbing.Hash); ok {
+		return name + "@" + hash.String()
+	}
+	return name + "@" + gt.commit.String()
+}
+
+// Open opens a file or a directory of the tree
+func (gt *GitTree) Open(name string) (fs.File, error) {
+	info, err := gt.stat(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	if info.IsDir() {
+		entries, err := gt.ReadDir(name)
+		if err != nil {
+			return nil, err
+		}
+		return &treeDir{info: info, dirEntries: dirEntries{entries: entries}}, nil
+	}
+
+	blob, err := gt.repo.BlobObject(info.hash)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	reader, err := blob.Reader()
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return &treeFile{info: info, ReadCloser: reader}, nil
+}
+
+// Stat describes a file or a directory of the tree
+func (gt *GitTree) Stat(name string) (fs.FileInfo, error) {
+	info, err := gt.stat(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	return info, nil
+}
+
+// ReadDir lists the files and directories of a directory of the tree, sorted by name
+func (gt *GitTree) ReadDir(name string) ([]fs.DirEntry, error) {
+	tree := gt.tree
+	if name != "." {
+		if !fs.ValidPath(name) {
+			return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+		}
+		subtree, err := gt.tree.Tree(name)
+		if err != nil {
+			return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+		}
+		tree = subtree
+	}
+
+	entries := make([]fs.DirEntry, 0, len(tree.Entries))
+	for _, entry := range tree.Entries {
+		if entry.Mode != filemode.Dir && !entry.Mode.IsRegular() {
+			continue // Symbolic link or submodule
+		}
+		entries = append(entries, &treeEntry{tree: gt, entry: entry})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+// stat looks up an entry of the tree
+func (gt *GitTree) stat(name string) (*treeInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, fs.ErrInvalid
+	}
+	if name == "." {
+		return &treeInfo{name: ".", mode: fs.ModeDir | 0755, modTime: gt.modTime, hash: gt.tree.Hash}, nil
+	}
+	entry, err := gt.tree.FindEntry(name)
+	if err != nil || (entry.Mode != filemode.Dir && !entry.Mode.IsRegular()) {
+		return nil, fs.ErrNotExist
+	}
+	return gt.info(*entry)
+}
+
+// info describes an entry of the tree, reading the size of files from their blob
+func (gt *GitTree) info(entry object.TreeEntry) (*treeInfo, error) {
+	info := &treeInfo{name: entry.Name, modTime: gt.modTime, hash: entry.Hash}
+	if entry.Mode == filemode.Dir {
+		info.mode = fs.ModeDir | 0755
+		return info, nil
+	}
+
+	info.mode = 0644
+	if entry.Mode == filemode.Executable {
+		info.mode = 0755
+	}
+	size, err := gt.repo.Storer.EncodedObjectSize(entry.Hash)
+	if err != nil {
+		return nil, err
+	}
+	info.size = size
+	return info, nil
+}
+
+// treeInfo describes an entry of the tree. Sys returns the hash of its object.
+type treeInfo struct {
+	name    string
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+	hash    plumbing.Hash
+}
+
+func (ti *treeInfo) Name() string       { return ti.name }
+func (ti *treeInfo) Size() int64        { return ti.size }
+func (ti *treeInfo) Mode() fs.FileMode  { return ti.mode }
+func (ti *treeInfo) ModTime() time.Time { return ti.modTime }
+func (ti *treeInfo) IsDir() bool        { return ti.mode.IsDir() }
+func (ti *treeInfo) Sys() any           { return ti.hash }
+
+// treeEntry is an entry of a directory listing, described on demand
+type treeEntry struct {
+	tree  *GitTree
+	entry object.TreeEntry
+}
+
+func (te *treeEntry) Name() string { return te.entry.Name }
+func (te *treeEntry) IsDir() bool  { return te.entry.Mode == filemode.Dir }
+
+func (te *treeEntry) Type() fs.FileMode {
+	if te.IsDir() {
+		return fs.ModeDir
+	}
+	return 0
+}
+
+func (te *treeEntry) Info() (fs.FileInfo, error) {
+	return te.tree.info(te.entry)
+}
+
+// treeFile is an open file of the tree
+type treeFile struct {
+	io.ReadCloser
+	info *treeInfo
+}
+
+func (tf *treeFile) Stat() (fs.FileInfo, error) { return tf.info, nil }
+
+// treeDir is an open directory of the tree
+type treeDir struct {
+	info *treeInfo
+	dirEntries
+}
+
+func (td *treeDir) Stat() (fs.FileInfo, error) { return td.info, nil }
+func (td *treeDir) Close() error               { return nil }
+
+func (td *treeDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: td.info.name, Err: fs.ErrInvalid}
+}
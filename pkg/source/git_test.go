@@ -0,0 +1,87 @@
+package source
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+func TestGitTree(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	worktree, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	commit := func(files map[string]string, tag string) {
+		for name, content := range files {
+			path := filepath.Join(dir, filepath.FromSlash(name))
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := worktree.Add(name); err != nil {
+				t.Fatal(err)
+			}
+		}
+		signature := &object.Signature{Name: "A", Email: "a@example.com", When: time.Unix(1700000000, 0)}
+		hash, err := worktree.Commit("commit", &git.CommitOptions{Author: signature, Committer: signature})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tag != "" {
+			if _, err := repo.CreateTag(tag, hash, nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	commit(map[string]string{"main.go": "package main\n", "pkg/a.go": "package pkg\n"}, "v1")
+	commit(map[string]string{"main.go": "package main // v2\n", "pkg/b.go": "package pkg\n"}, "")
+
+	tree, err := OpenGitRef(dir, "v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fstest.TestFS(tree, "main.go", "pkg/a.go"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Stat(tree, "pkg/b.go"); err == nil {
+		t.Error("pkg/b.go exists at v1")
+	}
+	content, err := fs.ReadFile(tree, "main.go")
+	if err != nil || string(content) != "package main\n" {
+		t.Errorf("main.go at v1 = %q, %v", content, err)
+	}
+
+	// A subdirectory is read at the same revision
+	sub, err := OpenGitRef(filepath.Join(dir, "pkg"), "master")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fstest.TestFS(sub, "a.go", "b.go"); err != nil {
+		t.Fatal(err)
+	}
+	info, err := fs.Stat(sub, "b.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != int64(len("package pkg\n")) || !info.ModTime().Equal(time.Unix(1700000000, 0)) {
+		t.Errorf("b.go size %d, modified %v", info.Size(), info.ModTime())
+	}
+
+	if _, err := OpenGitRef(dir, "missing"); err == nil {
+		t.Error("OpenGitRef(missing) succeeded")
+	}
+}
@@ -0,0 +1,84 @@
+package source
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+// scpURL matches the scp-like syntax of ssh git URLs: user@host:path
+var scpURL = regexp.MustCompile(`^[\w.-]+@[\w.-]+:`)
+
+// IsGitURL reports whether a target is the URL of a remote git repository
+func IsGitURL(target string) bool {
+	for _, scheme := range []string{"https://", "http://", "ssh://", "git://", "file://"} {
+		if strings.HasPrefix(target, scheme) {
+			return true
+		}
+	}
+	return scpURL.MatchString(target)
+}
+
+// OpenGitURL clones a remote repository in memory and returns its tree at a
+// revision (the default branch when ref is empty). Branches and tags are cloned
+// shallowly; other revisions need the whole history.
+func OpenGitURL(url, ref string) (*GitTree, error) {
+	fmt.Fprintf(os.Stderr, "Cloning repository %s...\n", url)
+
+	repo, err := cloneShallow(url, ref)
+	if err != nil && ref != "" {
+		// A commit hash or a relative revision such as main~3
+		repo, err = git.Clone(memory.NewStorage(), nil, &git.CloneOptions{URL: url})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to clone repository: %w", err)
+	}
+
+	if ref == "" {
+		ref = "HEAD"
+	}
+	gt, err := newGitTree(repo, ref)
+	if err != nil {
+		return nil, err
+	}
+	gt.name = repositoryName(url)
+	return gt, nil
+}
+
+// cloneShallow clones the last commit of the default branch, or of the branch or
+// tag named ref
+func cloneShallow(url, ref string) (*git.Repository, error) {
+	options := &git.CloneOptions{URL: url, Depth: 1, SingleBranch: true}
+	if ref == "" {
+		return git.Clone(memory.NewStorage(), nil, options)
+	}
+
+	var err error
+	for _, name := range []plumbing.ReferenceName{plumbing.NewBranchReferenceName(ref), plumbing.NewTagReferenceName(ref)} {
+		options.ReferenceName = name
+		var repo *git.Repository
+		if repo, err = git.Clone(memory.NewStorage(), nil, options); err == nil {
+			return repo, nil
+		}
+	}
+	return nil, err
+}
+
+// repositoryName returns the name of a repository from its URL, e.g. "repo" for
+// https://github.com/owner/repo.git
+func repositoryName(url string) string {
+	url = strings.TrimSuffix(strings.TrimRight(url, "/"), ".git")
+	if i := strings.LastIndexAny(url, "/:"); i >= 0 {
+		url = url[i+1:]
+	}
+	if url == "" {
+		return "repository"
+	}
+	return path.Base(url)
+}
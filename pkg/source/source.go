@@ -0,0 +1,112 @@
+// Package source provides the files a prompt is built from: a directory on disk,
+// the tree of a git revision, an archive or a remote git repository
+package source
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Source is a tree of files. Entries are listed and read through fs.FS, with
+// slash-separated paths relative to the root of the source, and their size and
+// modification time are given by fs.FileInfo.
+type Source interface {
+	fs.FS
+	// Name is the name of the project: the base name of its directory, archive or
+	// repository
+	Name() string
+	// Dir is the directory of the project on disk, empty for archives and remote
+	// repositories
+	Dir() string
+	// Key identifies the version of a file, to cache what is learned about it
+	Key(name string, info fs.FileInfo) string
+	// Close releases what the source holds open
+	Close() error
+}
+
+// Open returns the source of a project, detected from its target: a git URL, an
+// archive, a path inside an archive (pkg.zip!/src) or a directory. The ref selects
+// a commit, branch or tag of a git repository, either remote or containing the
+// directory.
+func Open(target, ref string) (Source, error) {
+	if IsGitURL(target) {
+		return OpenGitURL(target, ref)
+	}
+
+	info, err := os.Stat(target)
+	if err == nil && info.IsDir() {
+		if ref != "" {
+			return OpenGitRef(target, ref)
+		}
+		return NewDir(target), nil
+	}
+
+	// An archive, or a path inside an archive such as pkg.zip!/src
+	if !IsArchive(archiveSegments(target)[0]) {
+		if err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%s is neither a directory nor a supported archive (%s)", target, strings.Join(archiveExtensions, ", "))
+	}
+	if ref != "" {
+		return nil, fmt.Errorf("--ref only applies to git repositories, not to the archive %s", target)
+	}
+	return OpenArchive(target)
+}
+
+// Dir is a directory on disk
+type Dir struct {
+	fs.FS
+	root string
+}
+
+// NewDir returns the source of the files of a directory
+func NewDir(root string) *Dir {
+	return &Dir{FS: os.DirFS(root), root: root}
+}
+
+// Name returns the base name of the directory
+func (d *Dir) Name() string {
+	return filepath.Base(filepath.Clean(d.root))
+}
+
+// Dir returns the directory
+func (d *Dir) Dir() string {
+	return d.root
+}
+
+// Key identifies a file by its path, size and modification time
+func (d *Dir) Key(name string, info fs.FileInfo) string {
+	return fmt.Sprintf("%s:%d:%d", filepath.Join(d.root, filepath.FromSlash(name)), info.Size(), info.ModTime().UnixNano())
+}
+
+// Close does nothing: files are opened on demand
+func (d *Dir) Close() error {
+	return nil
+}
+
+// dirEntries are the entries of an open directory, listed by ReadDir
+type dirEntries struct {
+	entries []fs.DirEntry
+	offset  int
+}
+
+// ReadDir returns the next n entries of the directory, or all the remaining ones
+// when n <= 0
+func (de *dirEntries) ReadDir(n int) ([]fs.DirEntry, error) {
+	remaining := de.entries[de.offset:]
+	if n <= 0 {
+		de.offset = len(de.entries)
+		return remaining, nil
+	}
+	if len(remaining) == 0 {
+		return nil, io.EOF
+	}
+	n = min(n, len(remaining))
+	de.offset += n
+	return remaining[:n], nil
+}
@@ -0,0 +1,572 @@
+package strip
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"regexp"
+	"strings"
+)
+
+// lexGo finds comments with go/scanner. Doc comments are those of exported symbols
+// and of the package; directives (//go:, // +build, //line, //export) and the cgo
+// preamble are kept.
+func lexGo(content string) lexed {
+	docs, directives := goDocComments(content)
+
+	var found lexed
+	fset := token.NewFileSet()
+	file := fset.AddFile("", fset.Base(), len(content))
+	var s scanner.Scanner
+	s.Init(file, []byte(content), nil, scanner.ScanComments)
+
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		offset := file.Offset(pos)
+
+		switch {
+		case tok == token.COMMENT:
+			end := commentEnd(content, offset, "//", "/*", "*/")
+			text := content[offset:end]
+			found.comments = append(found.comments, comment{
+				span: span{offset, end},
+				doc:  docs[offset],
+				directive: directives[offset] || strings.HasPrefix(text, "//go:") || strings.HasPrefix(text, "// +build") ||
+					strings.HasPrefix(text, "//line ") || strings.HasPrefix(text, "//export ") || strings.HasPrefix(text, "//extern "),
+			})
+		case tok == token.STRING && strings.HasPrefix(lit, "`"):
+			end := len(content)
+			if i := strings.IndexByte(content[offset+1:], '`'); i >= 0 {
+				end = offset + 1 + i + 1
+			}
+			found.protected = append(found.protected, span{offset, end})
+		}
+	}
+
+	return found
+}
+
+// goDocComments returns the offsets of the comments documenting the package and the
+// exported symbols, and of the comments of the cgo preamble
+func goDocComments(content string) (docs, directives map[int]bool) {
+	docs = make(map[int]bool)
+	directives = make(map[int]bool)
+
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", content, parser.ParseComments)
+	if err != nil {
+		return docs, directives
+	}
+
+	mark := func(set map[int]bool, group *ast.CommentGroup) {
+		if group == nil {
+			return
+		}
+		for _, c := range group.List {
+			set[fset.Position(c.Pos()).Offset] = true
+		}
+	}
+	anyExported := func(names []*ast.Ident) bool {
+		for _, name := range names {
+			if name.IsExported() {
+				return true
+			}
+		}
+		return false
+	}
+
+	mark(docs, file.Doc)
+	ast.Inspect(file, func(node ast.Node) bool {
+		switch n := node.(type) {
+		case *ast.FuncDecl:
+			if n.Name.IsExported() {
+				mark(docs, n.Doc)
+			}
+		case *ast.GenDecl:
+			if n.Tok == token.IMPORT {
+				for _, spec := range n.Specs {
+					if spec.(*ast.ImportSpec).Path.Value == `"C"` {
+						mark(directives, n.Doc)
+					}
+				}
+				return false
+			}
+			for _, spec := range n.Specs {
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					if s.Name.IsExported() {
+						mark(docs, n.Doc)
+						mark(docs, s.Doc)
+					}
+				case *ast.ValueSpec:
+					if anyExported(s.Names) {
+						mark(docs, n.Doc)
+						mark(docs, s.Doc)
+					}
+				}
+			}
+		case *ast.Field:
+			if anyExported(n.Names) {
+				mark(docs, n.Doc)
+			}
+		}
+		return true
+	})
+
+	return docs, directives
+}
+
+// cLike describes the comments and literals of a language with C-like syntax
+type cLike struct {
+	lineComments bool // "//" comments (not in CSS)
+	backticks    bool // `...` template literals that may span lines
+	verbatim     bool // C# @"..." strings where "" is a quote
+}
+
+var (
+	lexCFamily = cLike{lineComments: true, backticks: true}.lex
+	lexCSharp  = cLike{lineComments: true, verbatim: true}.lex
+	lexCSS     = cLike{}.lex
+)
+
+// cDirectives are comments read by tools, kept in C-like languages
+var cDirectives = []string{"@ts-", "eslint-", "prettier-ignore", "<reference", "#__PURE__", "@__PURE__", "NOLINT", "#region", "#endregion"}
+
+// lex finds the comments of a C-like source. Strings and character literals are
+// skipped so that "//" or "/*" inside them are never taken for comments. Doc
+// comments are /** */ and /*! */ blocks and ///, //! lines.
+func (l cLike) lex(content string) lexed {
+	var found lexed
+	for i := 0; i < len(content); {
+		switch {
+		case l.lineComments && strings.HasPrefix(content[i:], "//"):
+			end := commentEnd(content, i, "//", "/*", "*/")
+			text := content[i:end]
+			found.comments = append(found.comments, comment{
+				span:      span{i, end},
+				doc:       (strings.HasPrefix(text, "///") && !strings.HasPrefix(text, "////")) || strings.HasPrefix(text, "//!"),
+				directive: hasDirective(text[2:]),
+			})
+			i = end
+
+		case strings.HasPrefix(content[i:], "/*"):
+			end := commentEnd(content, i, "//", "/*", "*/")
+			text := content[i:end]
+			found.comments = append(found.comments, comment{
+				span:      span{i, end},
+				doc:       (strings.HasPrefix(text, "/**") && text != "/**/") || strings.HasPrefix(text, "/*!"),
+				directive: hasDirective(text[2:]),
+			})
+			i = end
+
+		case l.verbatim && (strings.HasPrefix(content[i:], `@"`) || strings.HasPrefix(content[i:], `@$"`) || strings.HasPrefix(content[i:], `$@"`)):
+			start := i
+			i += strings.IndexByte(content[i:], '"') + 1
+			for i < len(content) {
+				if content[i] == '"' {
+					if i+1 < len(content) && content[i+1] == '"' {
+						i += 2
+						continue
+					}
+					i++
+					break
+				}
+				i++
+			}
+			found.protect(content, start, i)
+
+		case content[i] == 'R' && strings.HasPrefix(content[i:], `R"`) && (i == 0 || !isWordByte(content[i-1]) || strings.ContainsRune("uUL8", rune(content[i-1]))):
+			// C++ raw string R"delim(...)delim"
+			start := i
+			open := strings.IndexByte(content[i:], '(')
+			if open < 0 || strings.ContainsAny(content[i+2:i+open], " \n\\)") {
+				i++
+				continue
+			}
+			closing := ")" + content[i+2:i+open] + `"`
+			if end := strings.Index(content[i+open:], closing); end >= 0 {
+				i += open + end + len(closing)
+			} else {
+				i = len(content)
+			}
+			found.protect(content, start, i)
+
+		case strings.HasPrefix(content[i:], `"""`):
+			// Text blocks (Java, Kotlin, Swift, Scala)
+			start := i
+			i = len(content)
+			if end := strings.Index(content[start+3:], `"""`); end >= 0 {
+				i = start + 3 + end + 3
+			}
+			found.protect(content, start, i)
+
+		case content[i] == '"' || content[i] == '\'' || (l.backticks && content[i] == '`'):
+			start := i
+			i = quotedEnd(content, i, content[i] == '`', true)
+			found.protect(content, start, i)
+
+		default:
+			i++
+		}
+	}
+	return found
+}
+
+// lexPython finds # comments and docstrings, skipping the other strings. Docstrings
+// are the strings alone at the start of a module or right after a def or class line;
+// those that are the whole body of their function are kept, since removing them
+// would leave it empty.
+func lexPython(content string) lexed {
+	var found lexed
+	lastCode := -1 // Offset of the last character of code
+
+	for i := 0; i < len(content); {
+		switch c := content[i]; {
+		case c == '#':
+			end := commentEnd(content, i, "#", "", "")
+			text := content[i:end]
+			found.comments = append(found.comments, comment{
+				span: span{i, end},
+				directive: (i == 0 && strings.HasPrefix(text, "#!")) || pythonCodingRe.MatchString(text) ||
+					strings.HasPrefix(text, "# type:") || strings.HasPrefix(text, "# noqa") || strings.HasPrefix(text, "# pragma"),
+			})
+			i = end
+
+		case c == '"' || c == '\'':
+			start := i
+			quote := content[i : i+1]
+			triple := strings.HasPrefix(content[i:], strings.Repeat(quote, 3))
+			if triple {
+				i += 3
+				for i < len(content) && !strings.HasPrefix(content[i:], strings.Repeat(quote, 3)) {
+					if content[i] == '\\' {
+						i++
+					}
+					i++
+				}
+				i = min(i+3, len(content))
+			} else {
+				i = quotedEnd(content, i, false, true)
+			}
+
+			// Strings prefixed with r, b, f... start at their prefix
+			for start > 0 && strings.ContainsRune("rRbBuUfF", rune(content[start-1])) {
+				start--
+			}
+			if kind := pythonDocstring(content, start, i, lastCode); kind != "" {
+				found.comments = append(found.comments, comment{span: span{start, i}, doc: true, directive: kind == "body"})
+			} else {
+				found.protect(content, start, i)
+			}
+			lastCode = i - 1
+
+		default:
+			if c != ' ' && c != '\t' && c != '\n' && c != '\r' {
+				lastCode = i
+			}
+			i++
+		}
+	}
+	return found
+}
+
+var (
+	pythonCodingRe    = regexp.MustCompile(`^#.*coding[:=]`)
+	pythonBlockHeader = regexp.MustCompile(`^\s*(?:async\s+def|def|class)\s`)
+)
+
+// pythonDocstring reports whether the string [start, end) is a docstring: "module",
+// "docstring", or "body" when it is the only statement of its block
+func pythonDocstring(content string, start, end, lastCode int) string {
+	lineStart := strings.LastIndexByte(content[:start], '\n') + 1
+	if strings.TrimSpace(content[lineStart:start]) != "" {
+		return ""
+	}
+	lineEnd := len(content)
+	if i := strings.IndexByte(content[end:], '\n'); i >= 0 {
+		lineEnd = end + i
+	}
+	if rest := strings.TrimSpace(content[end:lineEnd]); rest != "" && !strings.HasPrefix(rest, "#") {
+		return ""
+	}
+
+	if lastCode < 0 {
+		return "module"
+	}
+	if content[lastCode] != ':' {
+		return ""
+	}
+	headerStart := strings.LastIndexByte(content[:lastCode], '\n') + 1
+	if !pythonBlockHeader.MatchString(content[headerStart:lastCode]) {
+		return ""
+	}
+
+	// The docstring is the whole body when the next line of code is not indented more
+	// than the def or class line
+	headerIndent := indentation(content[headerStart:])
+	for _, line := range strings.Split(content[min(lineEnd+1, len(content)):], "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if indentation(line) > headerIndent {
+			return "docstring"
+		}
+		break
+	}
+	return "body"
+}
+
+// indentation returns the number of leading spaces and tabs of a line
+func indentation(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " \t"))
+}
+
+// hashLike describes a language with # comments
+type hashLike struct {
+	// Scripting languages (shell, Ruby, Perl...) have strings anywhere and heredocs.
+	// In YAML and TOML, quotes only start a string at the start of a value, so that
+	// apostrophes in plain values are not taken for strings.
+	script bool
+}
+
+var (
+	lexShell = hashLike{script: true}.lex
+	lexYAML  = hashLike{}.lex
+
+	heredocRe = regexp.MustCompile(`^<<(-|~)?\s*['"]?([A-Za-z_]\w*)['"]?`)
+)
+
+// lex finds the # comments that start a word, skipping strings and heredocs
+func (l hashLike) lex(content string) lexed {
+	var found lexed
+	for i := 0; i < len(content); {
+		wordStart := i == 0 || strings.IndexByte(" \t\n\r;|&(", content[i-1]) >= 0
+		valueStart := wordStart || strings.IndexByte("=:,[{", content[i-1]) >= 0
+
+		switch c := content[i]; {
+		case c == '#' && wordStart:
+			end := commentEnd(content, i, "#", "", "")
+			text := content[i:end]
+			found.comments = append(found.comments, comment{
+				span:      span{i, end},
+				directive: (i == 0 && strings.HasPrefix(text, "#!")) || strings.HasPrefix(text, "# syntax=") || strings.HasPrefix(text, "# escape="),
+			})
+			i = end
+
+		case (c == '"' || c == '\'') && (l.script || valueStart):
+			// Single-quoted strings have no escapes in shell and YAML
+			start := i
+			i = quotedEnd(content, i, true, c == '"' || (l.script && i > 0 && content[i-1] == '$'))
+			found.protect(content, start, i)
+
+		case l.script && c == '<' && heredocRe.MatchString(content[i:]):
+			match := heredocRe.FindStringSubmatch(content[i:])
+			start := i
+			i = len(content)
+			if bodyStart := strings.IndexByte(content[start:], '\n'); bodyStart >= 0 {
+				lineStart := start + bodyStart + 1
+				for lineStart < len(content) {
+					lineEnd := len(content)
+					if j := strings.IndexByte(content[lineStart:], '\n'); j >= 0 {
+						lineEnd = lineStart + j
+					}
+					line := content[lineStart:lineEnd]
+					if line == match[2] || (match[1] != "" && strings.TrimSpace(line) == match[2]) {
+						i = lineEnd
+						break
+					}
+					lineStart = lineEnd + 1
+				}
+			}
+			found.protect(content, start, i)
+
+		default:
+			i++
+		}
+	}
+	return found
+}
+
+var dollarQuoteRe = regexp.MustCompile(`^\$([A-Za-z_]\w*)?\$`)
+
+// lexSQL finds -- and /* */ comments, skipping strings, quoted identifiers and
+// PostgreSQL dollar-quoted bodies
+func lexSQL(content string) lexed {
+	var found lexed
+	for i := 0; i < len(content); {
+		switch c := content[i]; {
+		case strings.HasPrefix(content[i:], "--"):
+			end := commentEnd(content, i, "--", "", "")
+			found.comments = append(found.comments, comment{span: span{i, end}})
+			i = end
+
+		case strings.HasPrefix(content[i:], "/*"):
+			end := commentEnd(content, i, "", "/*", "*/")
+			found.comments = append(found.comments, comment{span: span{i, end}})
+			i = end
+
+		case c == '\'' || c == '"':
+			// Quotes are escaped by doubling them: 'it''s' reads as two strings
+			start := i
+			if end := strings.IndexByte(content[i+1:], c); end >= 0 {
+				i += end + 2
+			} else {
+				i = len(content)
+			}
+			found.protect(content, start, i)
+
+		case c == '$' && (i == 0 || !isWordByte(content[i-1])) && dollarQuoteRe.MatchString(content[i:]):
+			start := i
+			tag := dollarQuoteRe.FindString(content[i:])
+			if end := strings.Index(content[i+len(tag):], tag); end >= 0 {
+				i += len(tag) + end + len(tag)
+			} else {
+				i = len(content)
+			}
+			found.protect(content, start, i)
+
+		default:
+			i++
+		}
+	}
+	return found
+}
+
+// htmlRawElements hold text that is not HTML (scripts, styles) or whose whitespace
+// matters (pre, textarea)
+var htmlRawElements = []string{"script", "style", "pre", "textarea"}
+
+// lexHTML finds <!-- --> comments outside of tags, CDATA sections and raw text
+// elements. Conditional comments are kept.
+func lexHTML(content string) lexed {
+	var found lexed
+	lower := strings.ToLower(content)
+
+	for i := 0; i < len(content); {
+		switch {
+		case strings.HasPrefix(content[i:], "<!--"):
+			end := len(content)
+			if j := strings.Index(content[i+4:], "-->"); j >= 0 {
+				end = i + 4 + j + 3
+			}
+			text := content[i:end]
+			found.comments = append(found.comments, comment{
+				span:      span{i, end},
+				directive: strings.HasPrefix(text, "<!--[if") || strings.HasPrefix(text, "<!--<![endif]") || strings.HasPrefix(text, "<!-- ko "),
+			})
+			i = end
+
+		case strings.HasPrefix(content[i:], "<![CDATA["):
+			start := i
+			i = len(content)
+			if j := strings.Index(content[start:], "]]>"); j >= 0 {
+				i = start + j + 3
+			}
+			found.protect(content, start, i)
+
+		case content[i] == '<' && i+1 < len(content) && isWordByte(content[i+1]):
+			// Skip the tag, whose attribute values may contain anything
+			start := i
+			for i++; i < len(content) && content[i] != '>'; i++ {
+				if content[i] == '"' || content[i] == '\'' {
+					if j := strings.IndexByte(content[i+1:], content[i]); j >= 0 {
+						i += j + 1
+					}
+				}
+			}
+			i++
+
+			for _, name := range htmlRawElements {
+				if strings.HasPrefix(lower[start+1:], name) && !isWordByte(byteAt(lower, start+1+len(name))) {
+					end := len(content)
+					if j := strings.Index(lower[min(i, len(content)):], "</"+name); j >= 0 {
+						end = i + j
+					}
+					found.protect(content, start, end)
+					i = end
+					break
+				}
+			}
+
+		default:
+			i++
+		}
+	}
+	return found
+}
+
+// protect records a literal whose lines must be kept, when it spans several lines
+func (l *lexed) protect(content string, start, end int) {
+	end = min(end, len(content))
+	if strings.Contains(content[start:end], "\n") {
+		l.protected = append(l.protected, span{start, end})
+	}
+}
+
+// commentEnd returns the end of the comment starting at i: the end of the line for
+// line comments (the newline excluded), after the closing marker for block comments
+func commentEnd(content string, i int, line, blockStart, blockEnd string) int {
+	if blockStart != "" && strings.HasPrefix(content[i:], blockStart) {
+		if j := strings.Index(content[i+len(blockStart):], blockEnd); j >= 0 {
+			return i + len(blockStart) + j + len(blockEnd)
+		}
+		return len(content)
+	}
+	if j := strings.IndexByte(content[i:], '\n'); j >= 0 {
+		end := i + j
+		if end > i && content[end-1] == '\r' {
+			end--
+		}
+		return end
+	}
+	return len(content)
+}
+
+// quotedEnd returns the end of the string starting with the quote at i. With escapes,
+// backslashes escape the next character. Unless multiline, an unescaped newline ends
+// the string, which limits the damage of an unbalanced quote.
+func quotedEnd(content string, i int, multiline, escapes bool) int {
+	quote := content[i]
+	for i++; i < len(content); i++ {
+		switch content[i] {
+		case '\\':
+			if escapes {
+				i++
+			}
+		case quote:
+			return i + 1
+		case '\n':
+			if !multiline {
+				return i
+			}
+		}
+	}
+	return len(content)
+}
+
+// hasDirective reports whether a comment text is read by tools
+func hasDirective(text string) bool {
+	text = strings.TrimSpace(text)
+	for _, prefix := range cDirectives {
+		if strings.HasPrefix(text, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func isWordByte(b byte) bool {
+	return b == '_' || ('a' <= b && b <= 'z') || ('A' <= b && b <= 'Z') || ('0' <= b && b <= '9')
+}
+
+func byteAt(s string, i int) byte {
+	if i < len(s) {
+		return s[i]
+	}
+	return 0
+}
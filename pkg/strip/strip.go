@@ -0,0 +1,336 @@
+package strip
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Options selects what is removed from file contents
+type Options struct {
+	Comments       bool // Comments, except doc comments and directives
+	DocComments    bool // Doc comments (exported Go symbols, /** */ and /// blocks, Python docstrings)
+	BlankLines     bool // Empty lines outside of string literals
+	LicenseHeaders bool // Comment block at the top of a file mentioning a copyright or license
+	// KeepLines replaces removed lines with empty lines so that line numbers still
+	// match the source file (blank lines are then kept)
+	KeepLines bool
+}
+
+// Names lists the values accepted by ParseOptions
+var Names = []string{"comments", "doc-comments", "blank-lines", "license-headers"}
+
+// ParseOptions parses a list of things to strip (e.g. "comments", "blank-lines")
+func ParseOptions(values []string) (Options, error) {
+	var opts Options
+	for _, value := range values {
+		switch strings.ToLower(strings.TrimSpace(value)) {
+		case "comments":
+			opts.Comments = true
+		case "doc-comments":
+			opts.DocComments = true
+		case "blank-lines":
+			opts.BlankLines = true
+		case "license-headers":
+			opts.LicenseHeaders = true
+		case "":
+		default:
+			return opts, fmt.Errorf("unknown strip option %q (available: %s)", value, strings.Join(Names, ", "))
+		}
+	}
+	return opts, nil
+}
+
+// Enabled reports whether anything is stripped
+func (o Options) Enabled() bool {
+	return o.Comments || o.DocComments || o.BlankLines || o.LicenseHeaders
+}
+
+// span is a range of bytes of the content [start, end)
+type span struct {
+	start, end int
+}
+
+// comment is a comment found by a lexer
+type comment struct {
+	span
+	doc       bool // Documentation of a symbol or module
+	directive bool // Comment with a meaning for the tools (//go:build, shebang...), always kept
+}
+
+// lexed is what a lexer finds in a file: its comments, in order, and the literals
+// whose lines must be kept as is (multi-line strings, <pre> blocks...)
+type lexed struct {
+	comments  []comment
+	protected []span
+}
+
+// lexer finds the comments and literals of a file
+type lexer func(content string) lexed
+
+// Strip removes comments, blank lines and license headers from the content of a file.
+// The language is detected from the path; comments are only removed from the languages
+// that have a lexer, so that string literals are never damaged. Other files only have
+// their runs of blank lines collapsed.
+func Strip(path, content string, opts Options) string {
+	if !opts.Enabled() || content == "" {
+		return content
+	}
+
+	lex := lexerFor(path)
+	if lex == nil {
+		if opts.BlankLines && !opts.KeepLines {
+			return collapseBlankLines(content)
+		}
+		return content
+	}
+
+	found := lex(content)
+
+	// Choose the comments to remove. The lines of the others are kept as is, like
+	// those of literals (blank lines of a docstring are part of its value).
+	var removed []span
+	protected := found.protected
+	license := licenseHeader(content, found.comments)
+	for i, c := range found.comments {
+		switch {
+		case c.directive:
+			protected = append(protected, c.span)
+		case i < license && opts.LicenseHeaders:
+			removed = append(removed, c.span)
+		case c.doc && opts.DocComments:
+			removed = append(removed, c.span)
+		case !c.doc && opts.Comments:
+			removed = append(removed, c.span)
+		default:
+			protected = append(protected, c.span)
+		}
+	}
+	sort.Slice(protected, func(i, j int) bool { return protected[i].start < protected[j].start })
+
+	edits := commentEdits(content, removed, opts.KeepLines)
+	if opts.BlankLines && !opts.KeepLines {
+		edits = mergeEdits(edits, blankLineEdits(content, edits, protected))
+	}
+	return applyEdits(content, edits)
+}
+
+// lexerFor returns the lexer of a file, or nil when its language has none
+func lexerFor(path string) lexer {
+	name := strings.ToLower(filepath.Base(path))
+	switch name {
+	case "makefile", "gnumakefile", "dockerfile", "containerfile", "gemfile", "rakefile":
+		return lexShell
+	case "pipfile":
+		return lexYAML
+	}
+
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".go":
+		return lexGo
+	case ".c", ".h", ".cpp", ".hpp", ".cc", ".cxx", ".java", ".kt", ".kts", ".scala", ".swift",
+		".js", ".jsx", ".mjs", ".cjs", ".ts", ".tsx":
+		return lexCFamily
+	case ".cs":
+		return lexCSharp
+	case ".css":
+		return lexCSS
+	case ".py", ".pyw":
+		return lexPython
+	case ".sh", ".bash", ".zsh", ".ksh", ".rb", ".pl", ".r", ".mk", ".dockerfile":
+		return lexShell
+	case ".yml", ".yaml", ".toml":
+		return lexYAML
+	case ".sql":
+		return lexSQL
+	case ".html", ".htm", ".xhtml", ".xml", ".svg", ".vue":
+		return lexHTML
+	}
+	return nil
+}
+
+// licenseHeader returns the number of comments up to the end of the license header:
+// the comments at the top of the file, before any blank line, when they mention a
+// copyright or a license. Directives (shebang, build constraints) may come first.
+func licenseHeader(content string, comments []comment) int {
+	var header strings.Builder
+	end, previousEnd := 0, 0
+	for i, c := range comments {
+		between := content[previousEnd:c.start]
+		if strings.TrimSpace(between) != "" {
+			break
+		}
+		if c.directive {
+			if header.Len() > 0 {
+				break
+			}
+			previousEnd = c.end
+			continue
+		}
+		if header.Len() > 0 && strings.Count(between, "\n") > 1 {
+			break
+		}
+		header.WriteString(content[c.start:c.end])
+		previousEnd = c.end
+		end = i + 1
+	}
+
+	text := strings.ToLower(header.String())
+	for _, keyword := range []string{"copyright", "license", "licence", "spdx-license-identifier"} {
+		if strings.Contains(text, keyword) {
+			return end
+		}
+	}
+	return 0
+}
+
+// edit replaces a range of the content
+type edit struct {
+	span
+	text string
+}
+
+// commentEdits removes comments. A comment alone on its line removes the line, a
+// comment after code is removed with the spaces before it, and a comment between
+// code is replaced with its surrounding spaces by a space (or a line break if it
+// spans lines).
+func commentEdits(content string, removed []span, keepLines bool) []edit {
+	var edits []edit
+	for _, s := range removed {
+		lineStart := strings.LastIndexByte(content[:s.start], '\n') + 1
+		lineEnd := len(content)
+		if i := strings.IndexByte(content[s.end:], '\n'); i >= 0 {
+			lineEnd = s.end + i
+		}
+		newlines := strings.Count(content[s.start:s.end], "\n")
+
+		before := strings.TrimSpace(content[lineStart:s.start]) == ""
+		after := strings.TrimSpace(content[s.end:lineEnd]) == ""
+		if len(edits) > 0 && edits[len(edits)-1].end > lineStart {
+			// Another comment precedes this one on the line
+			before = false
+		}
+
+		switch {
+		case before && after:
+			e := edit{span: span{lineStart, min(lineEnd+1, len(content))}}
+			if keepLines {
+				e.text = strings.Repeat("\n", newlines+1)
+				if lineEnd == len(content) {
+					e.text = strings.Repeat("\n", newlines)
+				}
+			}
+			edits = append(edits, e)
+		case after:
+			start := s.start
+			for start > lineStart && (content[start-1] == ' ' || content[start-1] == '\t') {
+				start--
+			}
+			e := edit{span: span{start, s.end}}
+			if keepLines {
+				e.text = strings.Repeat("\n", newlines)
+			}
+			edits = append(edits, e)
+		default:
+			// Surrounding spaces are collapsed into one
+			start, end := s.start, s.end
+			for start > lineStart && (content[start-1] == ' ' || content[start-1] == '\t') {
+				start--
+			}
+			for end < lineEnd && (content[end] == ' ' || content[end] == '\t') {
+				end++
+			}
+			text := " "
+			if newlines > 0 {
+				text = "\n"
+				if keepLines {
+					text = strings.Repeat("\n", newlines)
+				}
+			}
+			edits = append(edits, edit{span: span{start, end}, text: text})
+		}
+	}
+	return edits
+}
+
+// blankLineEdits removes the empty lines that are neither edited nor in a literal
+func blankLineEdits(content string, edits []edit, protected []span) []edit {
+	var blank []edit
+	e, p := 0, 0
+	for lineStart := 0; lineStart < len(content); {
+		lineEnd := len(content)
+		if i := strings.IndexByte(content[lineStart:], '\n'); i >= 0 {
+			lineEnd = lineStart + i + 1
+		}
+
+		for e < len(edits) && edits[e].end <= lineStart {
+			e++
+		}
+		for p < len(protected) && protected[p].end <= lineStart {
+			p++
+		}
+		edited := e < len(edits) && edits[e].start < lineEnd
+		inLiteral := p < len(protected) && protected[p].start < lineEnd
+
+		if !edited && !inLiteral && strings.TrimSpace(content[lineStart:lineEnd]) == "" {
+			blank = append(blank, edit{span: span{lineStart, lineEnd}})
+		}
+		lineStart = lineEnd
+	}
+	return blank
+}
+
+// mergeEdits merges two lists of non-overlapping edits sorted by position
+func mergeEdits(a, b []edit) []edit {
+	merged := make([]edit, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		if j == len(b) || (i < len(a) && a[i].start <= b[j].start) {
+			merged = append(merged, a[i])
+			i++
+		} else {
+			merged = append(merged, b[j])
+			j++
+		}
+	}
+	return merged
+}
+
+// applyEdits applies non-overlapping edits sorted by position
+func applyEdits(content string, edits []edit) string {
+	if len(edits) == 0 {
+		return content
+	}
+
+	var result strings.Builder
+	result.Grow(len(content))
+	position := 0
+	for _, e := range edits {
+		if e.start < position {
+			continue
+		}
+		result.WriteString(content[position:e.start])
+		result.WriteString(e.text)
+		position = e.end
+	}
+	result.WriteString(content[position:])
+	return result.String()
+}
+
+// collapseBlankLines keeps at most one empty line in a row
+func collapseBlankLines(content string) string {
+	lines := strings.SplitAfter(content, "\n")
+	var result strings.Builder
+	result.Grow(len(content))
+	previousBlank := false
+	for _, line := range lines {
+		blank := strings.TrimSpace(line) == ""
+		if blank && previousBlank {
+			continue
+		}
+		result.WriteString(line)
+		previousBlank = blank
+	}
+	return result.String()
+}
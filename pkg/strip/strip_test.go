@@ -0,0 +1,91 @@
+package strip
+
+import "testing"
+
+func TestStrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		options []string
+		input   string
+		want    string
+	}{
+		{
+			name:    "go keeps strings, docs and directives",
+			path:    "a.go",
+			options: []string{"comments"},
+			input:   "//go:build linux\n\n// Package a is documented.\npackage a\n\n// Exported is documented.\nfunc Exported() string {\n\t// inner\n\treturn \"// kept\" /* inline */ + `\n// raw` // trailing\n}\n",
+			want:    "//go:build linux\n\n// Package a is documented.\npackage a\n\n// Exported is documented.\nfunc Exported() string {\n\treturn \"// kept\" + `\n// raw`\n}\n",
+		},
+		{
+			name:    "go doc comments and license header",
+			path:    "a.go",
+			options: []string{"doc-comments", "license-headers", "blank-lines"},
+			input:   "// Copyright 2024 The Authors.\n// SPDX-License-Identifier: MIT\n\n// Package a is documented.\npackage a\n\n// helper is not exported.\nfunc helper() {}\n",
+			want:    "package a\n// helper is not exported.\nfunc helper() {}\n",
+		},
+		{
+			name:    "python docstrings and hashes in strings",
+			path:    "a.py",
+			options: []string{"comments", "doc-comments"},
+			input:   "#!/usr/bin/env python\ndef f():\n    \"\"\"Doc.\"\"\"\n    return \"# kept\"  # removed\n\ndef g():\n    \"\"\"Whole body.\"\"\"\n",
+			want:    "#!/usr/bin/env python\ndef f():\n    return \"# kept\"\n\ndef g():\n    \"\"\"Whole body.\"\"\"\n",
+		},
+		{
+			name:    "blank lines in docstrings are kept",
+			path:    "a.py",
+			options: []string{"blank-lines"},
+			input:   "\"\"\"Doc.\n\nMore.\n\"\"\"\n\nx = 1\n",
+			want:    "\"\"\"Doc.\n\nMore.\n\"\"\"\nx = 1\n",
+		},
+		{
+			name:    "shell words and heredocs",
+			path:    "a.sh",
+			options: []string{"comments"},
+			input:   "echo \"a # b\" c#d ${#x} # removed\ncat <<EOF\n# kept\nEOF\n",
+			want:    "echo \"a # b\" c#d ${#x}\ncat <<EOF\n# kept\nEOF\n",
+		},
+		{
+			name:    "sql dollar quotes",
+			path:    "a.sql",
+			options: []string{"comments"},
+			input:   "-- removed\nSELECT '--kept' FROM t; -- removed\nDO $$ -- kept\n$$;\n",
+			want:    "SELECT '--kept' FROM t;\nDO $$ -- kept\n$$;\n",
+		},
+		{
+			name:    "javascript templates",
+			path:    "a.js",
+			options: []string{"comments"},
+			input:   "const u = 'http://x'; // removed\nconst t = `\n// kept`;\n",
+			want:    "const u = 'http://x';\nconst t = `\n// kept`;\n",
+		},
+		{
+			name:    "html comments outside attributes and scripts",
+			path:    "a.html",
+			options: []string{"comments"},
+			input:   "<!-- removed -->\n<p title=\"<!-- kept -->\">x</p>\n<script>s = \"<!-- kept -->\"</script>\n",
+			want:    "<p title=\"<!-- kept -->\">x</p>\n<script>s = \"<!-- kept -->\"</script>\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts, err := ParseOptions(tt.options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := Strip(tt.path, tt.input, opts); got != tt.want {
+				t.Errorf("Strip() =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStripKeepLines(t *testing.T) {
+	input := "package a\n\n// comment\n/* block\n   comment */\nvar x = 1 // trailing\n"
+	got := Strip("a.go", input, Options{Comments: true, BlankLines: true, KeepLines: true})
+	want := "package a\n\n\n\n\nvar x = 1\n"
+	if got != want {
+		t.Errorf("Strip() = %q, want %q", got, want)
+	}
+}
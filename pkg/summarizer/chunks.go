@@ -0,0 +1,334 @@
+package summarizer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// DefaultWindowLines is the number of lines of the chunks of files without a parser
+const DefaultWindowLines = 60
+
+// Chunk is a retrieval unit of a source file: a declaration, the code around the
+// declarations (package clause, imports...) or, without a parser, a window of lines
+type Chunk struct {
+	ID        string // Stable identifier, derived from the path, the symbol and the content
+	Path      string
+	Symbol    string // Name of the declaration, empty for other chunks
+	Kind      string // function, method, type, class, ..., "preamble" or "lines"
+	Parent    string // Enclosing package, class or receiver type
+	StartLine int    // First line, overlap included (1-based)
+	EndLine   int    // Last line (inclusive)
+	Content   string
+}
+
+// ChunkOptions controls how files are chunked
+type ChunkOptions struct {
+	Overlap     int // Lines preceding each chunk repeated at its start, for context
+	WindowLines int // Lines per window for files without a parser (DefaultWindowLines if 0)
+}
+
+// boundary is the first line of a declaration found by a parser (0-based)
+type boundary struct {
+	line   int
+	kind   string
+	symbol string
+	parent string
+}
+
+// ChunkFile splits a file into chunks along its declarations: Go files with go/ast,
+// JavaScript/TypeScript, Python, Java and C/C++ files with line-based patterns.
+// Other files, and Go files that do not parse, are split into windows of lines.
+func (s *Summarizer) ChunkFile(path string, content string, opts ChunkOptions) []Chunk {
+	if content == "" {
+		return nil
+	}
+
+	lines := strings.SplitAfter(content, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	var boundaries []boundary
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".go":
+		boundaries = goBoundaries(path, content)
+	case ".js", ".jsx", ".ts", ".tsx":
+		boundaries = patternBoundaries(lines, javaScriptPatterns, false)
+	case ".py":
+		boundaries = pythonBoundaries(lines)
+	case ".java":
+		boundaries = patternBoundaries(lines, javaPatterns, true)
+	case ".c", ".h", ".cpp", ".hpp", ".cc", ".cxx":
+		boundaries = patternBoundaries(lines, cPatterns, false)
+	}
+
+	if len(boundaries) == 0 {
+		return ChunkLines(path, content, opts)
+	}
+	return buildChunks(path, lines, boundaries, opts)
+}
+
+// ChunkLines splits a file into windows of lines
+func ChunkLines(path string, content string, opts ChunkOptions) []Chunk {
+	if content == "" {
+		return nil
+	}
+
+	lines := strings.SplitAfter(content, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	window := opts.WindowLines
+	if window <= 0 {
+		window = DefaultWindowLines
+	}
+
+	var boundaries []boundary
+	for start := 0; start < len(lines); start += window {
+		boundaries = append(boundaries, boundary{line: start, kind: "lines"})
+	}
+	return buildChunks(path, lines, boundaries, opts)
+}
+
+// buildChunks cuts the lines at each boundary. Lines before the first boundary form
+// a "preamble" chunk.
+func buildChunks(path string, lines []string, boundaries []boundary, opts ChunkOptions) []Chunk {
+	if boundaries[0].line > 0 {
+		boundaries = append([]boundary{{line: 0, kind: "preamble"}}, boundaries...)
+	}
+
+	chunks := make([]Chunk, 0, len(boundaries))
+	seen := make(map[string]int)
+	for i, b := range boundaries {
+		end := len(lines)
+		if i+1 < len(boundaries) {
+			end = boundaries[i+1].line
+		}
+		body := strings.Join(lines[b.line:end], "")
+		if strings.TrimSpace(body) == "" {
+			continue
+		}
+
+		start := max(0, b.line-max(0, opts.Overlap))
+		chunk := Chunk{
+			ID:        chunkID(path, b, body),
+			Path:      path,
+			Symbol:    b.symbol,
+			Kind:      b.kind,
+			Parent:    b.parent,
+			StartLine: start + 1,
+			EndLine:   end,
+			Content:   strings.Join(lines[start:end], ""),
+		}
+
+		// Identical chunks of a file (e.g. repeated blocks) get distinct identifiers
+		seen[chunk.ID]++
+		if n := seen[chunk.ID]; n > 1 {
+			chunk.ID = fmt.Sprintf("%s-%d", chunk.ID, n)
+		}
+		chunks = append(chunks, chunk)
+	}
+
+	return chunks
+}
+
+// chunkID hashes what identifies a chunk but not its position, so that the identifier
+// of a declaration does not change when code is added above it
+func chunkID(path string, b boundary, body string) string {
+	sum := sha256.Sum256([]byte(strings.Join([]string{filepath.ToSlash(path), b.kind, b.parent, b.symbol, body}, "\x00")))
+	return hex.EncodeToString(sum[:8])
+}
+
+// goBoundaries finds the top-level declarations of a Go file, doc comments included
+func goBoundaries(path string, content string) []boundary {
+	fset := token.NewFileSet()
+	node, err := parser.ParseFile(fset, path, content, parser.ParseComments)
+	if err != nil {
+		return nil
+	}
+
+	var boundaries []boundary
+	for _, decl := range node.Decls {
+		b := boundary{parent: node.Name.Name}
+		pos := decl.Pos()
+
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			b.kind, b.symbol = "function", d.Name.Name
+			if d.Recv != nil && len(d.Recv.List) > 0 {
+				b.kind, b.parent = "method", receiverType(d.Recv.List[0].Type)
+			}
+			if d.Doc != nil {
+				pos = d.Doc.Pos()
+			}
+
+		case *ast.GenDecl:
+			if d.Tok == token.IMPORT {
+				// Imports stay with the package clause
+				continue
+			}
+			b.kind = d.Tok.String()
+			if len(d.Specs) == 1 {
+				switch spec := d.Specs[0].(type) {
+				case *ast.TypeSpec:
+					b.symbol = spec.Name.Name
+					if _, ok := spec.Type.(*ast.InterfaceType); ok {
+						b.kind = "interface"
+					}
+				case *ast.ValueSpec:
+					b.symbol = spec.Names[0].Name
+				}
+			}
+			if d.Doc != nil {
+				pos = d.Doc.Pos()
+			}
+		}
+
+		b.line = fset.Position(pos).Line - 1
+		boundaries = append(boundaries, b)
+	}
+
+	return boundaries
+}
+
+// receiverType returns the name of the type of a method receiver
+func receiverType(expr ast.Expr) string {
+	switch e := expr.(type) {
+	case *ast.StarExpr:
+		return receiverType(e.X)
+	case *ast.IndexExpr:
+		return receiverType(e.X)
+	case *ast.IndexListExpr:
+		return receiverType(e.X)
+	default:
+		return formatExpr(expr)
+	}
+}
+
+// chunkPattern recognizes the first line of a declaration. The symbol is the last
+// submatch of the pattern.
+type chunkPattern struct {
+	kind string
+	re   *regexp.Regexp
+}
+
+var (
+	javaScriptPatterns = []chunkPattern{
+		{"function", regexp.MustCompile(`^(?:export\s+)?(?:default\s+)?(?:async\s+)?function\s*\*?\s*(\w+)`)},
+		{"class", regexp.MustCompile(`^(?:export\s+)?(?:default\s+)?(?:abstract\s+)?class\s+(\w+)`)},
+		{"interface", regexp.MustCompile(`^(?:export\s+)?(?:declare\s+)?interface\s+(\w+)`)},
+		{"type", regexp.MustCompile(`^(?:export\s+)?(?:declare\s+)?(?:type|enum)\s+(\w+)`)},
+		{"const", regexp.MustCompile(`^(?:export\s+)?(?:const|let|var)\s+(\w+)`)},
+	}
+
+	javaPatterns = []chunkPattern{
+		{"class", regexp.MustCompile(`^\s*(?:(?:public|protected|private|abstract|static|final|sealed)\s+)*(?:class|record)\s+(\w+)`)},
+		{"interface", regexp.MustCompile(`^\s*(?:(?:public|protected|private|abstract|static)\s+)*(?:interface|@interface)\s+(\w+)`)},
+		{"enum", regexp.MustCompile(`^\s*(?:(?:public|protected|private|static)\s+)*enum\s+(\w+)`)},
+		{"method", regexp.MustCompile(`^(?:\t|    |  )(?:(?:public|protected|private|abstract|static|final|synchronized|native|default)\s+)*(?:<[^>]+>\s+)?[\w<>\[\],.?]+\s+(\w+)\s*\([^;]*$`)},
+	}
+
+	cPatterns = []chunkPattern{
+		{"struct", regexp.MustCompile(`^(?:typedef\s+)?(?:struct|union|enum|class)\s+(\w+)[^;]*$`)},
+		{"function", regexp.MustCompile(`^(?:[A-Za-z_][\w:<>,]*[\s\*&]+)+\**(\w+(?:::~?\w+)?)\s*\([^;]*$`)},
+	}
+
+	pythonDefRe   = regexp.MustCompile(`^(\s*)(?:async\s+)?def\s+(\w+)`)
+	pythonClassRe = regexp.MustCompile(`^(\s*)class\s+(\w+)`)
+
+	// Statements that look like C function definitions
+	cKeywords = map[string]bool{"if": true, "for": true, "while": true, "switch": true, "return": true, "else": true, "sizeof": true, "new": true, "catch": true}
+)
+
+// patternBoundaries finds the declarations matched by the patterns. With nested set,
+// declarations inside a class (Java methods) get the class as parent.
+func patternBoundaries(lines []string, patterns []chunkPattern, nested bool) []boundary {
+	var boundaries []boundary
+	class := ""
+
+	for i, line := range lines {
+		for _, pattern := range patterns {
+			match := pattern.re.FindStringSubmatch(line)
+			if match == nil {
+				continue
+			}
+			symbol := match[len(match)-1]
+			if cKeywords[symbol] {
+				break
+			}
+
+			b := boundary{line: commentStart(lines, i), kind: pattern.kind, symbol: symbol}
+			switch {
+			case pattern.kind == "method":
+				b.parent = class
+			case nested && line == strings.TrimLeft(line, " \t"):
+				class = symbol
+			}
+			boundaries = append(boundaries, b)
+			break
+		}
+	}
+
+	return boundaries
+}
+
+// pythonBoundaries finds the top-level functions and classes of a Python file and
+// the methods of top-level classes
+func pythonBoundaries(lines []string) []boundary {
+	var boundaries []boundary
+	class, methodIndent := "", ""
+
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		if indent == "" {
+			class, methodIndent = "", ""
+		}
+
+		if match := pythonClassRe.FindStringSubmatch(line); match != nil && match[1] == "" {
+			class = match[2]
+			boundaries = append(boundaries, boundary{line: commentStart(lines, i), kind: "class", symbol: class})
+			continue
+		}
+
+		match := pythonDefRe.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		switch {
+		case match[1] == "":
+			boundaries = append(boundaries, boundary{line: commentStart(lines, i), kind: "function", symbol: match[2]})
+		case class != "" && (methodIndent == "" || match[1] == methodIndent):
+			// Only the methods of the class, not the functions nested in them
+			methodIndent = match[1]
+			boundaries = append(boundaries, boundary{line: commentStart(lines, i), kind: "method", symbol: match[2], parent: class})
+		}
+	}
+
+	return boundaries
+}
+
+// commentStart moves the start of a declaration up to the comments, annotations and
+// decorators right above it
+func commentStart(lines []string, i int) int {
+	for i > 0 {
+		previous := strings.TrimSpace(lines[i-1])
+		if previous == "" || !(strings.HasPrefix(previous, "//") || strings.HasPrefix(previous, "/*") ||
+			strings.HasPrefix(previous, "*") || strings.HasPrefix(previous, "# ") || strings.HasPrefix(previous, "@")) {
+			break
+		}
+		i--
+	}
+	return i
+}
@@ -35,6 +35,16 @@ func NewSummarizer() *Summarizer {
 	return &Summarizer{}
 }
 
+// IsSupported reports whether detailed summarization is available for the file
+func IsSupported(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".go", ".js", ".jsx", ".ts", ".tsx", ".py", ".java", ".c", ".h", ".cpp", ".hpp", ".cc", ".cxx":
+		return true
+	default:
+		return false
+	}
+}
+
 // SummarizeFile generates a summary for a given file
 func (s *Summarizer) SummarizeFile(path string, content string) (*Summary, error) {
 	ext := strings.ToLower(filepath.Ext(path))
@@ -297,7 +307,7 @@ func (s *Summarizer) summarizePython(path string, content string) (*Summary, err
 	// Extract module docstring (first thing in file)
 	if len(lines) > 0 {
 		docRegex := regexp.MustCompile(`^"""(.*?)"""`)
-		if match := docRegex.FindStringSubmatch(strings.Join(lines[0:10], "\n")); len(match) > 1 {
+		if match := docRegex.FindStringSubmatch(strings.Join(lines[:min(len(lines), 10)], "\n")); len(match) > 1 {
 			summary.DocString = strings.TrimSpace(match[1])
 		}
 	}
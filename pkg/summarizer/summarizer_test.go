@@ -0,0 +1,21 @@
+package summarizer
+
+import "testing"
+
+func TestSummarizePythonShortFile(t *testing.T) {
+	// Fewer lines than the docstring is looked for in
+	content := "\"\"\"Helpers.\"\"\"\n\nfrom os import path\n\n\ndef join(a, b):\n    return path.join(a, b)\n"
+	summary, err := NewSummarizer().SummarizeFile("util.py", content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.DocString != "Helpers." {
+		t.Errorf("docstring %q", summary.DocString)
+	}
+	if len(summary.Imports) != 1 || summary.Imports[0] != "os" {
+		t.Errorf("imports %v", summary.Imports)
+	}
+	if len(summary.Exports) != 1 || summary.Exports[0].Signature != "def join(a, b)" {
+		t.Errorf("exports %+v", summary.Exports)
+	}
+}
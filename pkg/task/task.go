@@ -0,0 +1,86 @@
+package task
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Presets holds the built-in instructions written before the project structure
+var Presets = map[string]string{
+	"review": `You are a senior software engineer reviewing the project below.
+Review the code for bugs, edge cases, error handling, concurrency issues and readability.
+For each finding, give the file and the relevant code, explain the problem and propose a fix.
+Order the findings from the most to the least severe and finish with a short overall assessment.`,
+
+	"explain": `You are an experienced engineer onboarding a new team member on the project below.
+Explain what the project does, how it is organized and how the main components interact.
+Describe the entry points, the data flow and the key abstractions, referring to files by their path.
+Point out the non-obvious parts of the code a newcomer should read first.`,
+
+	"write-tests": `You are a software engineer writing tests for the project below.
+Identify the untested or poorly tested behaviour and write tests for it, following the test
+framework, layout and conventions already used by the project.
+Cover the nominal cases, the edge cases and the error paths, and give each test file its path.`,
+
+	"refactor": `You are a senior software engineer refactoring the project below.
+Identify duplicated code, overly complex functions, unclear names and leaky abstractions.
+Propose refactorings that keep the behaviour unchanged, in small independent steps, and show
+the resulting code for each step with the paths of the files it touches.`,
+
+	"security-audit": `You are an application security engineer auditing the project below.
+Look for injection flaws, unsafe input handling, authentication and authorization issues,
+secrets in the code, insecure defaults, vulnerable dependencies and unsafe file or network access.
+For each issue, give its severity, the file and code involved, an exploitation scenario and a fix.`,
+
+	"document": `You are a technical writer documenting the project below.
+Write documentation for its users and contributors: purpose, installation, configuration,
+usage examples and architecture overview. Add missing doc comments to exported symbols,
+following the documentation conventions of each language, and give the path of every file you change.`,
+}
+
+// Names returns the names of the built-in and configured presets, sorted
+func Names(overrides map[string]string) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for name := range Presets {
+		seen[name] = true
+		names = append(names, name)
+	}
+	for name := range overrides {
+		if !seen[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Instructions builds the prompt instructions from a preset and an instructions file.
+// Presets defined in overrides (.pmprc "tasks") replace or extend the built-in ones.
+// Either part may be empty; when both are set the file content follows the preset.
+func Instructions(name, instructionsFile string, overrides map[string]string) (string, error) {
+	var parts []string
+
+	if name != "" {
+		preset, ok := overrides[name]
+		if !ok {
+			preset, ok = Presets[name]
+		}
+		if !ok {
+			return "", fmt.Errorf("unknown task %q (available: %s)", name, strings.Join(Names(overrides), ", "))
+		}
+		parts = append(parts, strings.TrimSpace(preset))
+	}
+
+	if instructionsFile != "" {
+		content, err := os.ReadFile(instructionsFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to read instructions: %w", err)
+		}
+		parts = append(parts, strings.TrimSpace(string(content)))
+	}
+
+	return strings.Join(parts, "\n\n"), nil
+}
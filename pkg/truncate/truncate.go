@@ -0,0 +1,387 @@
+package truncate
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/benoitpetit/prompt-my-project/pkg/utils"
+)
+
+// Options limits the size of each file
+type Options struct {
+	MaxTokens int // Maximum estimated tokens of a file (0 = unlimited)
+	MaxLines  int // Maximum lines of a file (0 = unlimited)
+}
+
+// Enabled reports whether files are limited
+func (o Options) Enabled() bool {
+	return o.MaxTokens > 0 || o.MaxLines > 0
+}
+
+// Modes of truncation
+const (
+	ModeBodies   = "bodies"    // Long function bodies elided
+	ModeHeadTail = "head-tail" // First and last lines kept
+	// ModeBodiesHeadTail is used when eliding bodies was not enough
+	ModeBodiesHeadTail = "bodies+head-tail"
+)
+
+// Truncation describes what was left out of a file
+type Truncation struct {
+	Mode          string `json:"mode" xml:"mode"`
+	Lines         int    `json:"lines" xml:"lines"` // Lines of the file before truncation
+	OmittedLines  int    `json:"omitted_lines" xml:"omitted_lines"`
+	OmittedTokens int    `json:"omitted_tokens" xml:"omitted_tokens"`
+}
+
+// minBody is the number of lines under which a body is not worth eliding
+const minBody = 3
+
+// Truncate cuts a content that exceeds the options. The long function bodies of Go
+// and Python files are elided first, longest first; the first and last lines are
+// kept otherwise. Every cut is replaced by a "… [N lines / ~T tokens omitted] …"
+// marker. The truncation is nil when the content fits.
+func Truncate(path, content string, opts Options) (string, *Truncation) {
+	lines := SplitLines(content)
+	t := &truncater{opts: opts, estimator: utils.NewTokenEstimator()}
+	if t.fits(lines) {
+		return content, nil
+	}
+
+	result := &Truncation{Lines: len(lines)}
+	var elided map[int]elision
+	if bodies := functionBodies(path, content, lines); len(bodies) > 0 {
+		lines, elided = t.elideBodies(path, lines, bodies, result)
+		result.Mode = ModeBodies
+	}
+	if !t.fits(lines) {
+		lines = t.headTail(lines, elided, result)
+		if result.Mode == ModeBodies {
+			result.Mode = ModeBodiesHeadTail
+		} else {
+			result.Mode = ModeHeadTail
+		}
+	}
+	return strings.Join(lines, ""), result
+}
+
+// Marker returns the line replacing the lines left out
+func Marker(lines, tokens int) string {
+	return fmt.Sprintf("… [%d lines / ~%d tokens omitted] …", lines, tokens)
+}
+
+type truncater struct {
+	opts      Options
+	estimator *utils.TokenEstimator
+}
+
+// fits reports whether lines are within the limits
+func (t *truncater) fits(lines []string) bool {
+	if t.opts.MaxLines > 0 && len(lines) > t.opts.MaxLines {
+		return false
+	}
+	return t.opts.MaxTokens <= 0 || t.tokens(lines) <= t.opts.MaxTokens
+}
+
+// tokens estimates the tokens of lines
+func (t *truncater) tokens(lines []string) int {
+	return t.estimator.EstimateTokens(strings.Join(lines, ""), true)
+}
+
+// body is a range of lines [start, end) of a function body, braces excluded
+type body struct {
+	start, end int
+}
+
+// elision is what the marker of an elided body stands for in the original content
+type elision struct {
+	lines, tokens int
+}
+
+// elideBodies replaces function bodies with a marker, longest first, until the lines
+// fit the limits. It returns the lines kept and, by their index, the elided bodies.
+func (t *truncater) elideBodies(path string, lines []string, bodies []body, result *Truncation) ([]string, map[int]elision) {
+	sort.SliceStable(bodies, func(i, j int) bool {
+		return bodies[i].end-bodies[i].start > bodies[j].end-bodies[j].start
+	})
+
+	comment := "//"
+	if strings.ToLower(filepath.Ext(path)) == ".py" {
+		comment = "#"
+	}
+
+	elided := make(map[int]string)
+	spans := make(map[int]elision)
+	remaining := len(lines)
+	tokens := t.tokens(lines)
+	for _, b := range bodies {
+		if t.fitsCount(remaining, tokens) {
+			break
+		}
+		omitted := t.tokens(lines[b.start:b.end])
+		marker := bodyIndent(lines[b.start:b.end]) + comment + " " + Marker(b.end-b.start, omitted) + "\n"
+		elided[b.start] = marker
+		spans[b.start] = elision{lines: b.end - b.start, tokens: omitted}
+
+		remaining -= b.end - b.start - 1
+		tokens += t.estimator.EstimateTokens(marker, true) - omitted
+		result.OmittedLines += b.end - b.start
+		result.OmittedTokens += omitted
+	}
+
+	kept := make([]string, 0, remaining)
+	elisions := make(map[int]elision, len(elided))
+	for i := 0; i < len(lines); i++ {
+		if marker, ok := elided[i]; ok {
+			elisions[len(kept)] = spans[i]
+			kept = append(kept, marker)
+			i += spans[i].lines - 1
+			continue
+		}
+		kept = append(kept, lines[i])
+	}
+	return kept, elisions
+}
+
+// bodyIndent returns the indentation of the first line of a body that is not blank
+func bodyIndent(lines []string) string {
+	for _, line := range lines {
+		if trimmed := strings.TrimLeft(line, " \t"); strings.TrimSpace(trimmed) != "" {
+			return line[:len(line)-len(trimmed)]
+		}
+	}
+	return ""
+}
+
+// fitsCount reports whether a content of that many lines and tokens is within the limits
+func (t *truncater) fitsCount(lines, tokens int) bool {
+	return (t.opts.MaxLines <= 0 || lines <= t.opts.MaxLines) &&
+		(t.opts.MaxTokens <= 0 || tokens <= t.opts.MaxTokens)
+}
+
+// headTail keeps the first lines and the last lines that fit the limits, three
+// quarters of them at the head, around a marker. The markers of elided bodies cut
+// with the other lines are counted for the lines and tokens they stand for.
+func (t *truncater) headTail(lines []string, elided map[int]elision, result *Truncation) []string {
+	maxLines, maxTokens := len(lines), -1
+	if t.opts.MaxLines > 0 {
+		maxLines = t.opts.MaxLines - 1 // The marker takes a line
+	}
+	if t.opts.MaxTokens > 0 {
+		maxTokens = max(0, t.opts.MaxTokens-t.estimator.EstimateTokens(Marker(len(lines), t.tokens(lines))+"\n", true))
+	}
+
+	take := func(lineBudget, tokenBudget int, from, step, stop int) int {
+		n := 0
+		for i := from; i != stop && n < lineBudget; i += step {
+			cost := t.estimator.EstimateTokens(lines[i], true)
+			if tokenBudget >= 0 && cost > tokenBudget {
+				break
+			}
+			if tokenBudget >= 0 {
+				tokenBudget -= cost
+			}
+			n++
+		}
+		return n
+	}
+
+	headLines := maxLines - maxLines/4
+	headTokens := -1
+	if maxTokens >= 0 {
+		headTokens = maxTokens - maxTokens/4
+	}
+	head := take(headLines, headTokens, 0, 1, len(lines))
+
+	tailTokens := -1
+	if maxTokens >= 0 {
+		tailTokens = maxTokens - t.tokens(lines[:head])
+	}
+	tail := take(maxLines-head, tailTokens, len(lines)-1, -1, head-1)
+	// Always leave something out
+	if head+tail >= len(lines) {
+		if tail > 0 {
+			tail--
+		} else {
+			head--
+		}
+	}
+
+	kept, omittedLines, omittedTokens := t.keepHeadTail(lines, elided, head, tail)
+	// Estimates of single lines round down: give up lines until the whole fits
+	for t.opts.MaxTokens > 0 && head+tail > 0 && t.tokens(kept) > t.opts.MaxTokens {
+		if tail > 0 {
+			tail--
+		} else {
+			head--
+		}
+		kept, omittedLines, omittedTokens = t.keepHeadTail(lines, elided, head, tail)
+	}
+	result.OmittedLines += omittedLines
+	result.OmittedTokens += omittedTokens
+	return kept
+}
+
+// keepHeadTail returns the first and last lines around the marker of the lines cut,
+// and the lines and tokens cut that were not already elided
+func (t *truncater) keepHeadTail(lines []string, elided map[int]elision, head, tail int) ([]string, int, int) {
+	var cut []string
+	var before elision // Bodies elided among the lines cut
+	for i := head; i < len(lines)-tail; i++ {
+		if e, ok := elided[i]; ok {
+			before.lines += e.lines
+			before.tokens += e.tokens
+			continue
+		}
+		cut = append(cut, lines[i])
+	}
+	omitted := t.tokens(cut)
+
+	kept := make([]string, 0, head+tail+1)
+	kept = append(kept, lines[:head]...)
+	if head > 0 && !strings.HasSuffix(lines[head-1], "\n") {
+		kept[head-1] += "\n"
+	}
+	kept = append(kept, Marker(len(cut)+before.lines, omitted+before.tokens)+"\n")
+	return append(kept, lines[len(lines)-tail:]...), len(cut), omitted
+}
+
+// SplitLines splits a content into lines keeping their line feed, without an empty
+// line after the last line feed
+func SplitLines(content string) []string {
+	lines := strings.SplitAfter(content, "\n")
+	if len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// functionBodies returns the bodies of the outermost functions that are worth eliding
+func functionBodies(path, content string, lines []string) []body {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".go":
+		return goBodies(content)
+	case ".py":
+		return pythonBodies(lines)
+	}
+	return nil
+}
+
+// goBodies returns the bodies of the functions and methods of a Go file
+func goBodies(content string) []body {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", content, parser.SkipObjectResolution)
+	if err != nil {
+		return nil
+	}
+
+	var bodies []body
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Body == nil {
+			continue
+		}
+		// Lines are numbered from 1: the body starts on the line after the opening
+		// brace and ends before the line of the closing brace
+		b := body{start: fset.Position(fn.Body.Lbrace).Line, end: fset.Position(fn.Body.Rbrace).Line - 1}
+		if b.end-b.start >= minBody {
+			bodies = append(bodies, b)
+		}
+	}
+	return bodies
+}
+
+var pythonDef = regexp.MustCompile(`^(\s*)(async\s+)?def\s`)
+
+// pythonBodies returns the bodies of the functions and methods of a Python file,
+// found by their indentation
+func pythonBodies(lines []string) []body {
+	var bodies []body
+	for i := 0; i < len(lines); i++ {
+		match := pythonDef.FindStringSubmatch(lines[i])
+		if match == nil {
+			continue
+		}
+		indent := len(match[1])
+
+		// The signature may span several lines and ends with a colon
+		start, inline := pythonSignatureEnd(lines, i)
+		if inline {
+			continue // One-line function (def f(): return 1)
+		}
+		start++
+		if start >= len(lines) {
+			break
+		}
+
+		end := start
+		for j := start; j < len(lines); j++ {
+			text := strings.TrimRight(lines[j], " \t\r\n")
+			if text == "" {
+				continue
+			}
+			if len(text)-len(strings.TrimLeft(text, " \t")) <= indent {
+				break
+			}
+			end = j + 1
+		}
+
+		if end-start >= minBody {
+			bodies = append(bodies, body{start: start, end: end})
+		}
+		// Functions nested in this one are elided with it
+		i = max(i, end-1)
+	}
+	return bodies
+}
+
+// pythonSignatureEnd returns the line of the colon ending the signature of the
+// function defined at line i, the first one outside of brackets and strings, and
+// whether the body follows it on the same line
+func pythonSignatureEnd(lines []string, i int) (int, bool) {
+	depth := 0
+	for ; i < len(lines); i++ {
+		line := stripComment(lines[i])
+		var quote rune
+		for j, c := range line {
+			switch {
+			case quote != 0:
+				if c == quote {
+					quote = 0
+				}
+			case c == '"' || c == '\'':
+				quote = c
+			case c == '(' || c == '[' || c == '{':
+				depth++
+			case c == ')' || c == ']' || c == '}':
+				depth--
+			case c == ':' && depth == 0:
+				return i, strings.TrimSpace(line[j+1:]) != ""
+			}
+		}
+	}
+	return i, false
+}
+
+// stripComment removes a trailing comment from a line of Python, ignoring the
+// hashes of string literals
+func stripComment(line string) string {
+	var quote rune
+	for i, c := range line {
+		switch {
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote == 0 && (c == '"' || c == '\''):
+			quote = c
+		case quote == 0 && c == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
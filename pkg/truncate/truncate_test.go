@@ -0,0 +1,117 @@
+package truncate
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func numberedLines(n int) string {
+	var b strings.Builder
+	for i := 1; i <= n; i++ {
+		fmt.Fprintf(&b, "line %d\n", i)
+	}
+	return b.String()
+}
+
+func TestTruncateHeadTail(t *testing.T) {
+	got, truncation := Truncate("data.txt", numberedLines(100), Options{MaxLines: 9})
+	lines := strings.Split(strings.TrimSuffix(got, "\n"), "\n")
+	if len(lines) != 9 {
+		t.Fatalf("Truncate() kept %d lines, want 9:\n%s", len(lines), got)
+	}
+	if lines[0] != "line 1" || lines[5] != "line 6" || lines[8] != "line 100" {
+		t.Errorf("Truncate() kept the wrong lines:\n%s", got)
+	}
+	if !strings.HasPrefix(lines[6], "… [92 lines / ~") {
+		t.Errorf("marker = %q, want 92 lines omitted", lines[6])
+	}
+	if truncation == nil || truncation.Mode != ModeHeadTail || truncation.Lines != 100 || truncation.OmittedLines != 92 {
+		t.Errorf("Truncation = %+v", truncation)
+	}
+}
+
+func TestTruncateFits(t *testing.T) {
+	content := numberedLines(5)
+	if got, truncation := Truncate("a.txt", content, Options{MaxLines: 5, MaxTokens: 1000}); got != content || truncation != nil {
+		t.Errorf("Truncate() = %q, %+v, want the content unchanged", got, truncation)
+	}
+}
+
+func TestTruncateGoBodies(t *testing.T) {
+	content := "package a\n\nfunc Small() int {\n\treturn 1\n}\n\nfunc Long() {\n" +
+		strings.Repeat("\tprintln(\"x\")\n", 20) + "}\n"
+	got, truncation := Truncate("a.go", content, Options{MaxLines: 12})
+
+	want := "package a\n\nfunc Small() int {\n\treturn 1\n}\n\nfunc Long() {\n\t// … [20 lines / ~"
+	if !strings.HasPrefix(got, want) || !strings.HasSuffix(got, "tokens omitted] …\n}\n") {
+		t.Errorf("Truncate() =\n%s", got)
+	}
+	if truncation == nil || truncation.Mode != ModeBodies || truncation.OmittedLines != 20 {
+		t.Errorf("Truncation = %+v", truncation)
+	}
+}
+
+func TestTruncatePythonBodies(t *testing.T) {
+	content := "class A:\n    def f(self,\n          x):  # signature\n" +
+		strings.Repeat("        x += 1\n", 10) + "\n    def g(self):\n        return 2\n\nprint('done')\n"
+	got, truncation := Truncate("a.py", content, Options{MaxLines: 10})
+
+	want := "class A:\n    def f(self,\n          x):  # signature\n        # … [10 lines / ~"
+	if !strings.HasPrefix(got, want) || !strings.HasSuffix(got, "omitted] …\n\n    def g(self):\n        return 2\n\nprint('done')\n") {
+		t.Errorf("Truncate() =\n%s", got)
+	}
+	if truncation == nil || truncation.Mode != ModeBodies {
+		t.Errorf("Truncation = %+v", truncation)
+	}
+}
+
+func TestTruncatePythonOneLineDef(t *testing.T) {
+	// The body of a one-line function is on the def line: the block of the next
+	// statement ending with a colon is not taken for it
+	content := "def f(): return 1\n\nx = 1\nif x:\n" + strings.Repeat("    a()\n", 10) + "\ndef g(a=\"):\", b={'k': 1}):\n" +
+		strings.Repeat("    b()\n", 10)
+	got, truncation := Truncate("a.py", content, Options{MaxLines: 20})
+
+	want := "def f(): return 1\n\nx = 1\nif x:\n" + strings.Repeat("    a()\n", 10) + "\ndef g(a=\"):\", b={'k': 1}):\n    # … [10 lines / ~"
+	if !strings.HasPrefix(got, want) {
+		t.Errorf("Truncate() =\n%s", got)
+	}
+	if truncation == nil || truncation.Mode != ModeBodies || truncation.OmittedLines != 10 {
+		t.Errorf("Truncation = %+v", truncation)
+	}
+}
+
+func TestTruncateBodiesHeadTail(t *testing.T) {
+	var b strings.Builder
+	b.WriteString("package a\n")
+	for i := 0; i < 30; i++ {
+		fmt.Fprintf(&b, "\nfunc F%d() {\n%s}\n", i, strings.Repeat("\tprintln(\"x\")\n", 10))
+	}
+	content := b.String()
+	got, truncation := Truncate("a.go", content, Options{MaxLines: 40})
+	if truncation == nil || truncation.Mode != ModeBodiesHeadTail {
+		t.Fatalf("Truncation = %+v", truncation)
+	}
+	if truncation.OmittedLines > truncation.Lines {
+		t.Errorf("%d of %d lines omitted", truncation.OmittedLines, truncation.Lines)
+	}
+
+	// Each marker counts the lines of the file it stands for, even when it cuts the
+	// markers of elided bodies
+	marker := regexp.MustCompile(`… \[(\d+) lines / ~\d+ tokens omitted\] …`)
+	kept, omitted := 0, 0
+	for _, line := range strings.Split(strings.TrimSuffix(got, "\n"), "\n") {
+		if match := marker.FindStringSubmatch(line); match != nil {
+			n, _ := strconv.Atoi(match[1])
+			omitted += n
+		} else {
+			kept++
+		}
+	}
+	if lines := len(SplitLines(content)); kept+omitted != lines || truncation.Lines != lines || truncation.OmittedLines != omitted {
+		t.Errorf("%d lines kept, %d omitted by the markers, Truncation = %+v", kept, omitted, truncation)
+	}
+}
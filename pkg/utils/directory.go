@@ -108,20 +108,25 @@ func printDirectory(dir *Directory, builder *strings.Builder, prefix string, isL
 		}
 	}
 
-	// Get sorted directory names
-	dirNames := make([]string, 0, len(dir.SubDirs))
-	for name := range dir.SubDirs {
-		dirNames = append(dirNames, name)
-	}
-	// strings.Sort(dirNames) // Would need to implement
-
 	// Print subdirectories
+	dirNames := subDirNames(dir)
 	for i, name := range dirNames {
 		isLastDir := i == len(dirNames)-1
 		printDirectory(dir.SubDirs[name], builder, prefix, isLastDir)
 	}
 }
 
+// subDirNames returns the names of the subdirectories in sorted order, so that
+// outputs do not depend on the iteration order of the map
+func subDirNames(dir *Directory) []string {
+	names := make([]string, 0, len(dir.SubDirs))
+	for name := range dir.SubDirs {
+		names = append(names, name)
+	}
+	SortStrings(names)
+	return names
+}
+
 // CountFilesRecursive counts the number of files in a directory and its subdirectories
 func CountFilesRecursive(dir *Directory) int {
 	count := len(dir.Files)
@@ -148,15 +153,18 @@ func GenerateDotOutput(root *Directory) string {
 			parentLabel := fmt.Sprintf("dir_%d", parentID)
 			builder.WriteString(fmt.Sprintf("  %s -> %s;\n", parentLabel, dirLabel))
 		}
-		for _, file := range dir.Files {
+		files := make([]string, len(dir.Files))
+		copy(files, dir.Files)
+		SortStrings(files)
+		for _, file := range files {
 			fileID := id
 			id++
 			fileLabel := fmt.Sprintf("file_%d", fileID)
 			builder.WriteString(fmt.Sprintf("  %s [label=\"%s\", shape=note];\n", fileLabel, file))
 			builder.WriteString(fmt.Sprintf("  %s -> %s;\n", dirLabel, fileLabel))
 		}
-		for _, sub := range dir.SubDirs {
-			walk(sub, myID)
+		for _, name := range subDirNames(dir) {
+			walk(dir.SubDirs[name], myID)
 		}
 		return myID
 	}
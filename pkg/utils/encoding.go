@@ -0,0 +1,30 @@
+package utils
+
+import (
+	"bytes"
+	"unicode/utf8"
+)
+
+// DetectEncoding returns the character encoding of a text file: "ascii", "utf-8",
+// "utf-8-bom", "utf-16le" or "utf-16be" (from their byte order mark), or
+// "unknown-8bit" for text that is not valid UTF-8 (latin-1, windows-1252...)
+func DetectEncoding(content []byte) string {
+	switch {
+	case bytes.HasPrefix(content, []byte{0xEF, 0xBB, 0xBF}):
+		return "utf-8-bom"
+	case bytes.HasPrefix(content, []byte{0xFF, 0xFE}):
+		return "utf-16le"
+	case bytes.HasPrefix(content, []byte{0xFE, 0xFF}):
+		return "utf-16be"
+	}
+
+	for _, c := range content {
+		if c >= utf8.RuneSelf {
+			if utf8.Valid(content) {
+				return "utf-8"
+			}
+			return "unknown-8bit"
+		}
+	}
+	return "ascii"
+}
@@ -2,6 +2,7 @@ package worker
 
 import (
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"sync"
@@ -20,13 +21,14 @@ type Pool struct {
 type Job struct {
 	Index    int
 	FilePath string
-	RootDir  string
+	Source   fs.FS // Read with slash-separated paths
 }
 
 // Result represents the result of processing a single job
 type Result struct {
 	Index   int
 	Content string
+	ModTime time.Time // Last modification of the file
 	Err     error
 }
 
@@ -65,16 +67,25 @@ func (wp *Pool) Start() {
 func (wp *Pool) worker() {
 	defer wp.wg.Done()
 	for job := range wp.jobs {
-		content, err := wp.processFile(job.RootDir, job.FilePath, nil)
-		wp.results <- Result{
-			Index:   job.Index,
-			Content: content,
-			Err:     err,
-		}
+		wp.results <- readSource(job)
 	}
 }
 
-// processFile processes a single file and returns its formatted content
+// readSource reads the file of a job from its source
+func readSource(job Job) Result {
+	name := filepath.ToSlash(job.FilePath)
+	content, err := fs.ReadFile(job.Source, name)
+	if err != nil {
+		return Result{Index: job.Index, Err: fmt.Errorf("error reading file %s: %w", job.FilePath, err)}
+	}
+	result := Result{Index: job.Index, Content: string(content)}
+	if info, err := fs.Stat(job.Source, name); err == nil {
+		result.ModTime = info.ModTime()
+	}
+	return result
+}
+
+// processFile processes a single file and returns its content
 func (wp *Pool) processFile(rootDir, relPath string, buffer []byte) (string, error) {
 	absPath := filepath.Join(rootDir, relPath)
 
@@ -90,13 +101,7 @@ func (wp *Pool) processFile(rootDir, relPath string, buffer []byte) (string, err
 		}
 	}
 
-	// Format the output
-	builder := fmt.Sprintf("File: %s\n", relPath)
-	builder += "================================================\n"
-	builder += string(content)
-	builder += "\n\n"
-
-	return builder, nil
+	return string(content), nil
 }
 
 // Stop stops the worker pool and waits for all workers to finish